@@ -3,27 +3,190 @@ package dbbatch
 import (
 	"context"
 	"errors"
+	"fmt"
 )
 
 type CallbackFn = func(ctx context.Context) error
 
 type Batch struct {
 	callbacks []CallbackFn
+	deps      [][]int // indexes of prerequisites of every callback, nil if there are no ones
+	err       error   // error of adding callbacks, returned on run
+	// final runs after callbacks, its request goes to the last round of the callbacks if it's known, see LastQuery.
+	// It's skipped if any callback failed
+	final CallbackFn
 }
 
-func (b *Batch) Add(cb CallbackFn) {
+// Handle identifies the callback in the batch for AddAfter
+type Handle struct {
+	b *Batch
+	i int
+}
+
+func (b *Batch) Add(cb CallbackFn) Handle {
 	b.callbacks = append(b.callbacks, cb)
+	b.deps = append(b.deps, nil)
+
+	return Handle{b: b, i: len(b.callbacks) - 1}
+}
+
+// AddAfter adds callback starting after all deps finished without error.
+// If any of deps fails, the callback and its dependents are skipped with ErrDependencyFailed.
+// The callback shares round trips with other still running callbacks
+func (b *Batch) AddAfter(deps []Handle, cb CallbackFn) Handle {
+	indexes := make([]int, 0, len(deps))
+	for _, dep := range deps {
+		if dep.b != b {
+			b.err = errors.Join(b.err, fmt.Errorf("dependency of callback %d is not a callback of the batch", len(b.callbacks)))
+			continue
+		}
+		indexes = append(indexes, dep.i)
+	}
+
+	h := b.Add(cb)
+	b.deps[h.i] = indexes
+
+	return h
 }
 
 func (b *Batch) Callbacks() []CallbackFn {
 	return b.callbacks
 }
 
+// RunSequential runs callbacks one by one, dependent callbacks run after their prerequisites
 func (b *Batch) RunSequential(ctx context.Context) (err error) {
-	for _, cb := range b.Callbacks() {
-		cbErr := cb(ctx)
-		err = errors.Join(err, cbErr)
+	q, err := newCallbackQueue(b)
+	if err != nil {
+		return err
+	}
+
+	for {
+		i, ok := q.next()
+		if !ok {
+			if b.final != nil && err == nil {
+				err = b.final(ctx)
+			}
+			return err
+		}
+		cbErr := b.callbacks[i](ctx)
+		err = errors.Join(err, cbErr, q.done(i, cbErr))
+	}
+}
+
+// prepend returns a copy of the batch where cb runs before the other callbacks,
+// so the requests of cb go first in the pipeline of the first round
+func (b *Batch) prepend(cb CallbackFn) *Batch {
+	callbacks := make([]CallbackFn, 0, len(b.callbacks)+1)
+	callbacks = append(callbacks, cb)
+	callbacks = append(callbacks, b.callbacks...)
+
+	deps := make([][]int, 0, len(b.deps)+1)
+	deps = append(deps, nil)
+	for _, indexes := range b.deps {
+		var shifted []int
+		for _, i := range indexes {
+			shifted = append(shifted, i+1)
+		}
+		deps = append(deps, shifted)
+	}
+
+	return &Batch{callbacks: callbacks, deps: deps, err: b.err, final: b.final}
+}
+
+// withFinal returns a copy of the batch with the final callback
+func (b *Batch) withFinal(final CallbackFn) *Batch {
+	return &Batch{callbacks: b.callbacks, deps: b.deps, err: b.err, final: final}
+}
+
+// callbackQueue gives indexes of callbacks in order of adding,
+// dependent callbacks after all their prerequisites finished without error
+type callbackQueue struct {
+	dependents [][]int
+	pending    []int // count of unfinished prerequisites, -1 for skipped callbacks
+	ready      []int
+	waiting    int // count of callbacks waiting for prerequisites
+}
+
+// newCallbackQueue returns the queue of callbacks of the batch.
+// AddAfter takes only handles of added callbacks, so dependencies have no cycles
+func newCallbackQueue(b *Batch) (*callbackQueue, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	q := &callbackQueue{
+		dependents: make([][]int, len(b.callbacks)),
+		pending:    make([]int, len(b.callbacks)),
+		ready:      make([]int, 0, len(b.callbacks)),
+	}
+	for i := range b.callbacks {
+		var deps []int
+		if i < len(b.deps) {
+			deps = b.deps[i]
+		}
+		for _, dep := range deps {
+			if dep < 0 || dep >= len(b.callbacks) {
+				return nil, fmt.Errorf("dependency of callback %d is not a callback of the batch", i)
+			}
+			q.dependents[dep] = append(q.dependents[dep], i)
+		}
+		q.pending[i] = len(deps)
+		if len(deps) == 0 {
+			q.ready = append(q.ready, i)
+		} else {
+			q.waiting++
+		}
+	}
+
+	return q, nil
+}
+
+func (q *callbackQueue) next() (int, bool) {
+	if len(q.ready) == 0 {
+		return 0, false
+	}
+	i := q.ready[0]
+	q.ready = q.ready[1:]
+
+	return i, true
+}
+
+// done marks callback finished, its dependents become ready or skipped if err is not nil.
+// Returns errors of skipped callbacks wrapping ErrDependencyFailed and err
+func (q *callbackQueue) done(i int, err error) (skipErr error) {
+	for _, d := range q.dependents[i] {
+		if q.pending[d] < 0 {
+			continue
+		}
+		if err != nil {
+			skipErr = errors.Join(skipErr, q.skip(d, err))
+			continue
+		}
+		q.pending[d]--
+		if q.pending[d] == 0 {
+			q.waiting--
+			q.ready = append(q.ready, d)
+		}
+	}
+
+	return skipErr
+}
+
+// remaining returns the count of callbacks, which are not started yet and not skipped
+func (q *callbackQueue) remaining() int {
+	return len(q.ready) + q.waiting
+}
+
+func (q *callbackQueue) skip(i int, cause error) error {
+	if q.pending[i] < 0 {
+		return nil
 	}
+	q.pending[i] = -1
+	q.waiting--
 
+	err := fmt.Errorf("callback is skipped: %w: %w", ErrDependencyFailed, cause)
+	for _, d := range q.dependents[i] {
+		err = errors.Join(err, q.skip(d, cause))
+	}
 	return err
 }
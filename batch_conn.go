@@ -3,36 +3,68 @@ package dbbatch
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"errors"
 
 	"github.com/jmoiron/sqlx"
 )
 
 type BatchConn struct {
-	db        *BatchDB
-	ext       Ext
-	conn      *sqlx.Conn
-	tx        *sqlx.Tx
-	br        batchRunnerMachine
-	bindNamed func(query string, arg any) (string, []any, error)
-	done      bool
+	db       *BatchDB
+	ext      Ext
+	conn     *sqlx.Conn
+	tx       *sqlx.Tx
+	txCtx    context.Context // lifetime of the transaction
+	txCancel context.CancelFunc
+	br       batchRunnerMachine
+	binder   binder
+	multi    *multiConns // connections of MultiDB.SendBatch sharing the runner br, nil for other batches
+	checker  RequestChecker
+	driver   driver.Driver // driver of the pool of conn
+	done     bool
+}
+
+// binder is the bindvar part of sqlx.DB API
+type binder interface {
+	DriverName() string
+	Rebind(query string) string
+	BindNamed(query string, arg any) (string, []any, error)
 }
 
 var (
 	_ Ext = &sqlx.Conn{}
 	_ Ext = &sqlx.Tx{}
+
+	_ binder = &sqlx.DB{}
+	_ binder = &BatchDB{}
+	_ binder = &BatchConn{}
+	_ binder = &BatchTx{}
 )
 
-// newBatchConn creates *BatchConn. Must call BatchConn.Close() in the end if err is nil
-func newBatchConn(db *BatchDB, conn *sqlx.Conn) *BatchConn {
+// newBatchConn creates *BatchConn of conn from sqlxDB. Must call BatchConn.Close() in the end if err is nil
+func newBatchConn(db *BatchDB, sqlxDB *sqlx.DB, conn *sqlx.Conn) *BatchConn {
 	bc := &BatchConn{
-		db:        db,
-		ext:       conn,
-		conn:      conn,
-		tx:        nil,
-		br:        nil,
-		bindNamed: db.DB.BindNamed,
-		done:      false,
+		db:       db,
+		ext:      conn,
+		conn:     conn,
+		tx:       nil,
+		txCtx:    nil,
+		txCancel: nil,
+		br:       nil,
+		binder:   sqlxDB,
+		multi:    nil,
+		checker:  nil,
+		driver:   nil,
+		done:     false,
+	}
+	if sqlxDB != nil {
+		bc.driver = sqlxDB.Driver()
+	}
+	if conn != nil {
+		_ = conn.Raw(func(driverConn any) error {
+			bc.checker = requestChecker(driverConn)
+			return nil
+		})
 	}
 
 	return bc
@@ -47,24 +79,71 @@ func (bc *BatchConn) maybeWithoutCancel(ctx context.Context) context.Context {
 		// bc.db used, it will use context without cancel
 		return ctx
 	}
+	if bc.txCtx != nil {
+		return contextWithLifetime(ctx, bc.txCtx)
+	}
 	return bc.db.maybeWithoutCancel(ctx)
 }
 
+// queueAndWait adds the request to the batch and waits for the round trip.
+// After that the query goes through sqlx/sql once, and the driver takes the result from BatchRunner.Result()
+func (bc *BatchConn) queueAndWait(ctx context.Context, query string, args []any) error {
+	request := Request{
+		Query: query,
+	}
+	request.Args, request.Names = requestArgs(args)
+	if bc.checker != nil {
+		if err := bc.checker.CheckRequest(request); err != nil {
+			return err
+		}
+	}
+
+	if err := bc.br.beforeQueue(isLastQuery(ctx)); err != nil {
+		return err
+	}
+
+	if bc.multi != nil {
+		// the runner is shared by shards, the request goes to the connection of this shard
+		bc.br.queueTo(bc, request)
+	} else {
+		bc.br.Queue(request)
+	}
+	return bc.br.roundTrip()
+}
+
+// requestArgs unwraps args like database/sql does for the driver accepting any value in CheckNamedValue.
+// Names of sql.NamedArg are kept for the driver
+func requestArgs(args []any) (values []any, names []string) {
+	values = make([]any, 0, len(args))
+	for i, arg := range args {
+		if namedArg, ok := arg.(sql.NamedArg); ok {
+			if names == nil {
+				names = make([]string, len(args))
+			}
+			names[i] = namedArg.Name
+			arg = namedArg.Value
+		}
+		values = append(values, arg)
+	}
+	return values, names
+}
+
 // SendBatchRequests returns batch result of concrete type. Must close it in the end
 func (bc *BatchConn) SendBatchRequests(ctx context.Context, requests []Request) (res any, closeFn func() error, err error) {
 	if bc.done {
 		return nil, nil, sql.ErrConnDone
 	}
-	err = bc.conn.Raw(func(driverConn any) error {
-		val, ok := driverConn.(BaseConnProvider)
-		if !ok {
-			return nil
-		}
-
-		baseConn := val.BaseConn()
+	if bc.db != nil {
+		bc.db.roundTripHook(ctx, requests)
+	}
+	if bc.multi != nil {
+		// the runner of MultiDB has the context of the batch, the options of the shard apply to its rounds
+		ctx = bc.db.maybeWithoutCancel(ctx)
+	}
 
-		if batchSenderConn, ok := baseConn.(BatchRequestsSender); ok {
-			res, closeFn, err = batchSenderConn.SendBatchRequests(ctx, requests)
+	err = bc.conn.Raw(func(driverConn any) error {
+		if sender := batchRequestsSender(driverConn); sender != nil {
+			res, closeFn, err = sender.SendBatchRequests(ctx, requests)
 		}
 
 		return err
@@ -73,17 +152,32 @@ func (bc *BatchConn) SendBatchRequests(ctx context.Context, requests []Request)
 		return nil, nil, err
 	}
 	if res == nil {
-		return nil, nil, errors.New("batch sending is unsupported by driver")
+		return nil, nil, ErrBatchingNotSupported
 	}
 
 	return res, closeFn, nil
 }
 
+func (bc *BatchConn) queryHook(ctx context.Context, query string) {
+	if bc.db != nil {
+		bc.db.queryHook(ctx, query)
+	}
+}
+
 // BatchRunner Only for using in the driver implementation code!
 func (bc *BatchConn) BatchRunner() BatchRunner {
 	return bc.br
 }
 
+// BufferedRows Only for using in the driver implementation code!
+// Returns whether rows of batched queries must be read into memory and the size limit, see WithBufferedRows
+func (bc *BatchConn) BufferedRows() (enabled bool, maxBytes int) {
+	if bc.db == nil {
+		return false, 0
+	}
+	return bc.db.options.bufferedRows, bc.db.options.bufferedRowsMaxBytes
+}
+
 // BeginBatchTx begins a transaction and allows to send all batch in one transaction.
 // Don't use BatchConn anymore, only BatchTx!
 // During commit or rollback BatchConn will be automatically closed.
@@ -98,8 +192,15 @@ func (bc *BatchConn) BeginBatchTx(ctx context.Context, opts *sql.TxOptions) (*Ba
 		return nil, ErrHasRunningBatch
 	}
 
+	if bc.db.options.withoutCancel {
+		// waiting for the connection is already done, the transaction lives without cancel
+		ctx, bc.txCancel = bc.db.detachTx(ctx)
+		bc.txCtx = ctx
+	}
+
 	tx, err := bc.conn.BeginTxx(ctx, opts)
 	if err != nil {
+		bc.finishTxCtx()
 		return nil, err
 	}
 
@@ -109,8 +210,19 @@ func (bc *BatchConn) BeginBatchTx(ctx context.Context, opts *sql.TxOptions) (*Ba
 	return newBatchTx(bc, tx), nil
 }
 
+// finishTx is called after commit or rollback, BatchConn is closed as documented in BeginBatchTx
 func (bc *BatchConn) finishTx() {
 	bc.tx = nil
+	bc.finishTxCtx()
+	_ = bc.Close()
+}
+
+func (bc *BatchConn) finishTxCtx() {
+	if bc.txCancel != nil {
+		bc.txCancel()
+	}
+	bc.txCtx = nil
+	bc.txCancel = nil
 }
 
 func (bc *BatchConn) isBatchRunning() bool {
@@ -135,30 +247,35 @@ func (bc *BatchConn) SendBatch(ctx context.Context, b *Batch) (err error) {
 	if bc.br != nil {
 		return ErrHasRunningBatch
 	}
-	bc.br = newBatchRunner(bc)
-	ctx = bc.setInCtx(ctx)
+	defer bc.db.enterBatch(ctx)()
+
+	if bc.db.options.sequentialFallback && !bc.supportsBatching() {
+		return bc.sendBatchSequentially(ctx, b)
+	}
+	bc.br = newBatchRunner(bc, bc.db.options.maxConcurrentCallbacks)
+	ctx = bc.setInCtx(bc.maybeWithoutCancel(ctx))
 	err = bc.br.run(ctx, b)
 	bc.br = nil
 
 	return err
 }
 
-// nolint:sqlclosecheck
 func (bc *BatchConn) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
 	if bc.done {
 		return nil, sql.ErrConnDone
 	}
 	if bc.br == nil {
+		bc.queryHook(ctx, query)
 		return bc.ext.QueryContext(bc.maybeWithoutCancel(ctx), query, args...)
 	}
 	ctx = bc.setInCtx(ctx)
 
-	rows, _ := bc.ext.QueryContext(ctx, query, args...)
-	if rows != nil {
-		defer rows.Close()
+	if err := bc.queueAndWait(ctx, query, args); err != nil {
+		return nil, err
+	}
+	if buffered, _ := bc.BufferedRows(); buffered {
+		return bc.queryBuffered(ctx, query, args)
 	}
-
-	bc.br.roundTrip()
 
 	return bc.ext.QueryContext(ctx, query, args...)
 }
@@ -172,13 +289,14 @@ func (bc *BatchConn) ExecContext(ctx context.Context, query string, args ...any)
 		return nil, sql.ErrConnDone
 	}
 	if bc.br == nil {
+		bc.queryHook(ctx, query)
 		return bc.ext.ExecContext(bc.maybeWithoutCancel(ctx), query, args...)
 	}
 	ctx = bc.setInCtx(ctx)
 
-	_, _ = bc.ext.ExecContext(ctx, query, args...)
-
-	bc.br.roundTrip()
+	if err := bc.queueAndWait(ctx, query, args); err != nil {
+		return nil, err
+	}
 
 	return bc.ext.ExecContext(ctx, query, args...)
 }
@@ -189,13 +307,17 @@ func (bc *BatchConn) Exec(query string, args ...any) (sql.Result, error) {
 
 func (bc *BatchConn) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
 	if bc.br == nil {
+		bc.queryHook(ctx, query)
 		return bc.ext.QueryRowContext(bc.maybeWithoutCancel(ctx), query, args...)
 	}
 	ctx = bc.setInCtx(ctx)
 
-	_ = bc.ext.QueryRowContext(ctx, query, args...)
-
-	bc.br.roundTrip()
+	if err := bc.queueAndWait(ctx, query, args); err != nil {
+		return errorRow(err)
+	}
+	if buffered, _ := bc.BufferedRows(); buffered {
+		return bc.queryRowBuffered(ctx, query, args)
+	}
 
 	return bc.ext.QueryRowContext(ctx, query, args...)
 }
@@ -209,16 +331,17 @@ func (bc *BatchConn) QueryxContext(ctx context.Context, query string, args ...an
 		return nil, sql.ErrConnDone
 	}
 	if bc.br == nil {
+		bc.queryHook(ctx, query)
 		return bc.ext.QueryxContext(bc.maybeWithoutCancel(ctx), query, args...)
 	}
 	ctx = bc.setInCtx(ctx)
 
-	rows, _ := bc.ext.QueryxContext(ctx, query, args...)
-	if rows != nil {
-		defer rows.Close()
+	if err := bc.queueAndWait(ctx, query, args); err != nil {
+		return nil, err
+	}
+	if buffered, _ := bc.BufferedRows(); buffered {
+		return bc.queryxBuffered(ctx, query, args)
 	}
-
-	bc.br.roundTrip()
 
 	return bc.ext.QueryxContext(ctx, query, args...)
 }
@@ -229,13 +352,17 @@ func (bc *BatchConn) Queryx(query string, args ...any) (*sqlx.Rows, error) {
 
 func (bc *BatchConn) QueryRowxContext(ctx context.Context, query string, args ...any) *sqlx.Row {
 	if bc.br == nil {
+		bc.queryHook(ctx, query)
 		return bc.ext.QueryRowxContext(bc.maybeWithoutCancel(ctx), query, args...)
 	}
 	ctx = bc.setInCtx(ctx)
 
-	_ = bc.ext.QueryRowxContext(ctx, query, args...)
-
-	bc.br.roundTrip()
+	if err := bc.queueAndWait(ctx, query, args); err != nil {
+		return errorRowx(err)
+	}
+	if buffered, _ := bc.BufferedRows(); buffered {
+		return bc.queryRowxBuffered(ctx, query, args)
+	}
 
 	return bc.ext.QueryRowxContext(ctx, query, args...)
 }
@@ -284,7 +411,7 @@ func (bc *BatchConn) NamedQueryContext(ctx context.Context, query string, arg an
 	if bc.done {
 		return nil, sql.ErrConnDone
 	}
-	q, args, err := bc.bindNamed(query, arg)
+	q, args, err := bc.BindNamed(query, arg)
 	if err != nil {
 		return nil, err
 	}
@@ -302,7 +429,7 @@ func (bc *BatchConn) NamedExecContext(ctx context.Context, query string, arg any
 	if bc.done {
 		return nil, sql.ErrConnDone
 	}
-	q, args, err := bc.bindNamed(query, arg)
+	q, args, err := bc.BindNamed(query, arg)
 	if err != nil {
 		return nil, err
 	}
@@ -316,6 +443,39 @@ func (bc *BatchConn) NamedExec(query string, arg any) (sql.Result, error) {
 	return bc.NamedExecContext(context.Background(), query, arg)
 }
 
+// DriverName returns the driver name of the db
+func (bc *BatchConn) DriverName() string {
+	return bc.binder.DriverName()
+}
+
+// Rebind transforms a query from QUESTION to the bindvar type of the driver
+func (bc *BatchConn) Rebind(query string) string {
+	return bc.binder.Rebind(query)
+}
+
+// BindNamed binds a query with named args using the bindvar type of the driver
+func (bc *BatchConn) BindNamed(query string, arg any) (string, []any, error) {
+	return bc.binder.BindNamed(query, arg)
+}
+
+// InSelectContext expands slice args of `IN (?)` query by sqlx.In, rebinds and selects it
+func (bc *BatchConn) InSelectContext(ctx context.Context, dest any, query string, args ...any) error {
+	q, args, err := sqlx.In(query, args...)
+	if err != nil {
+		return err
+	}
+	return bc.SelectContext(ctx, dest, bc.Rebind(q), args...)
+}
+
+// InGetContext expands slice args of `IN (?)` query by sqlx.In, rebinds and gets it
+func (bc *BatchConn) InGetContext(ctx context.Context, dest any, query string, args ...any) error {
+	q, args, err := sqlx.In(query, args...)
+	if err != nil {
+		return err
+	}
+	return bc.GetContext(ctx, dest, bc.Rebind(q), args...)
+}
+
 func (bc *BatchConn) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
 	if bc.done {
 		return nil, sql.ErrConnDone
@@ -352,7 +512,7 @@ func (bc *BatchConn) PrepareContext(ctx context.Context, query string) (*sql.Stm
 		return nil, ErrStmtNotSupported
 	}
 
-	return bc.ext.PrepareContext(ctx, query)
+	return bc.ext.PrepareContext(bc.maybeWithoutCancel(ctx), query)
 }
 
 func (bc *BatchConn) PreparexContext(ctx context.Context, query string) (*sqlx.Stmt, error) {
@@ -363,5 +523,5 @@ func (bc *BatchConn) PreparexContext(ctx context.Context, query string) (*sqlx.S
 		return nil, ErrStmtNotSupported
 	}
 
-	return bc.ext.PreparexContext(ctx, query)
+	return bc.ext.PreparexContext(bc.maybeWithoutCancel(ctx), query)
 }
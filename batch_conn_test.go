@@ -6,6 +6,7 @@ import (
 	"database/sql/driver"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 	"github.com/stretchr/testify/assert"
@@ -27,9 +28,12 @@ func TestBatchConn_QueryContext(t *testing.T) {
 	wantContext := SetBatchConnToContext(ctx, bc)
 	wantRows := &sql.Rows{}
 
-	extMock.EXPECT().QueryContext(wantContext, "query", 1, 2).Return(nil, errors.New("some error"))
-	extMock.EXPECT().QueryContext(wantContext, "query", 1, 2).Return(wantRows, nil)
-	brMock.EXPECT().roundTrip()
+	gomock.InOrder(
+		brMock.EXPECT().beforeQueue(false).Return(nil),
+		brMock.EXPECT().Queue(Request{Query: "query", Args: []any{1, 2}}),
+		brMock.EXPECT().roundTrip().Return(nil),
+		extMock.EXPECT().QueryContext(wantContext, "query", 1, 2).Return(wantRows, nil),
+	)
 
 	rows, err := bc.QueryContext(ctx, "query", 1, 2)
 	require.NoError(t, err)
@@ -50,9 +54,12 @@ func TestBatchConn_ExecContext(t *testing.T) {
 	wantContext := SetBatchConnToContext(ctx, bc)
 	wantRows := driver.RowsAffected(123)
 
-	extMock.EXPECT().ExecContext(wantContext, "exec", 1, 2).Return(nil, errors.New("some error"))
-	extMock.EXPECT().ExecContext(wantContext, "exec", 1, 2).Return(&wantRows, nil)
-	brMock.EXPECT().roundTrip()
+	gomock.InOrder(
+		brMock.EXPECT().beforeQueue(false).Return(nil),
+		brMock.EXPECT().Queue(Request{Query: "exec", Args: []any{1, 2}}),
+		brMock.EXPECT().roundTrip().Return(nil),
+		extMock.EXPECT().ExecContext(wantContext, "exec", 1, 2).Return(&wantRows, nil),
+	)
 
 	rows, err := bc.ExecContext(ctx, "exec", 1, 2)
 	require.NoError(t, err)
@@ -73,9 +80,12 @@ func TestBatchConn_QueryRowContext(t *testing.T) {
 	wantContext := SetBatchConnToContext(ctx, bc)
 	wantRow := &sql.Row{}
 
-	extMock.EXPECT().QueryRowContext(wantContext, "query", 1, 2).Return(nil)
-	extMock.EXPECT().QueryRowContext(wantContext, "query", 1, 2).Return(wantRow)
-	brMock.EXPECT().roundTrip()
+	gomock.InOrder(
+		brMock.EXPECT().beforeQueue(false).Return(nil),
+		brMock.EXPECT().Queue(Request{Query: "query", Args: []any{1, 2}}),
+		brMock.EXPECT().roundTrip().Return(nil),
+		extMock.EXPECT().QueryRowContext(wantContext, "query", 1, 2).Return(wantRow),
+	)
 
 	row := bc.QueryRowContext(ctx, "query", 1, 2)
 	assert.Same(t, wantRow, row)
@@ -95,9 +105,12 @@ func TestBatchConn_QueryxContext(t *testing.T) {
 	wantContext := SetBatchConnToContext(ctx, bc)
 	wantRows := &sqlx.Rows{}
 
-	extMock.EXPECT().QueryxContext(wantContext, "query", 1, 2).Return(nil, errors.New("some error"))
-	extMock.EXPECT().QueryxContext(wantContext, "query", 1, 2).Return(wantRows, nil)
-	brMock.EXPECT().roundTrip()
+	gomock.InOrder(
+		brMock.EXPECT().beforeQueue(false).Return(nil),
+		brMock.EXPECT().Queue(Request{Query: "query", Args: []any{1, 2}}),
+		brMock.EXPECT().roundTrip().Return(nil),
+		extMock.EXPECT().QueryxContext(wantContext, "query", 1, 2).Return(wantRows, nil),
+	)
 
 	rows, err := bc.QueryxContext(ctx, "query", 1, 2)
 	require.NoError(t, err)
@@ -118,14 +131,88 @@ func TestBatchConn_QueryRowxContext(t *testing.T) {
 	wantContext := SetBatchConnToContext(ctx, bc)
 	wantRow := &sqlx.Row{}
 
-	extMock.EXPECT().QueryRowxContext(wantContext, "query", 1, 2).Return(nil)
-	extMock.EXPECT().QueryRowxContext(wantContext, "query", 1, 2).Return(wantRow)
-	brMock.EXPECT().roundTrip()
+	gomock.InOrder(
+		brMock.EXPECT().beforeQueue(false).Return(nil),
+		brMock.EXPECT().Queue(Request{Query: "query", Args: []any{1, 2}}),
+		brMock.EXPECT().roundTrip().Return(nil),
+		extMock.EXPECT().QueryRowxContext(wantContext, "query", 1, 2).Return(wantRow),
+	)
 
 	row := bc.QueryRowxContext(ctx, "query", 1, 2)
 	assert.Same(t, wantRow, row)
 }
 
+func TestRequestArgs(t *testing.T) {
+	values, names := requestArgs([]any{1, "2"})
+	assert.Equal(t, []any{1, "2"}, values)
+	assert.Nil(t, names)
+
+	values, names = requestArgs([]any{sql.Named("id", 1), sql.Named("name", "2")})
+	assert.Equal(t, []any{1, "2"}, values)
+	assert.Equal(t, []string{"id", "name"}, names)
+
+	values, names = requestArgs([]any{1, sql.Named("name", "2")})
+	assert.Equal(t, []any{1, "2"}, values)
+	assert.Equal(t, []string{"", "name"}, names)
+}
+
+func TestBatchConn_InSelectContext(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	ctx := context.Background()
+
+	extMock := NewMockExt(ctrl)
+	brMock := NewMockbatchRunnerMachine(ctrl)
+
+	bindType := sqlx.BindType("batch_pgx_test")
+	sqlx.BindDriver("batch_pgx_test", sqlx.DOLLAR)
+	t.Cleanup(func() {
+		sqlx.BindDriver("batch_pgx_test", bindType)
+	})
+
+	bc := &BatchConn{
+		ext:    extMock,
+		br:     brMock,
+		binder: sqlx.NewDb(nil, "batch_pgx_test"),
+	}
+	wantContext := SetBatchConnToContext(ctx, bc)
+	wantQuery := "select id from items where user_id = $1 and id in ($2, $3)"
+	wantErr := errors.New("query error")
+
+	gomock.InOrder(
+		brMock.EXPECT().beforeQueue(false).Return(nil),
+		brMock.EXPECT().Queue(Request{Query: wantQuery, Args: []any{10, 1, 2}}),
+		brMock.EXPECT().roundTrip().Return(nil),
+		extMock.EXPECT().QueryxContext(wantContext, wantQuery, 10, 1, 2).Return(nil, wantErr),
+	)
+
+	var ids []int
+	err := bc.InSelectContext(ctx, &ids, "select id from items where user_id = ? and id in (?)", 10, []int{1, 2})
+	assert.ErrorIs(t, err, wantErr)
+
+	assert.Equal(t, "batch_pgx_test", bc.DriverName())
+
+	err = bc.InSelectContext(ctx, &ids, "select id from items where id in (?)", []int{})
+	assert.EqualError(t, err, "empty slice passed to 'in' query")
+}
+
+var registeredDriver = &seqDriver{}
+
+func init() {
+	RegisterDriver("dbbatch_registered", registeredDriver, BindDollar)
+}
+
+func TestRegisterDriver(t *testing.T) {
+	db, err := sqlx.Open("dbbatch_registered", "")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+
+	assert.Equal(t, "select $1", New(db).Rebind("select ?"))
+	assert.Equal(t, "dbbatch_registered", registeredDriverName(registeredDriver))
+	assert.Empty(t, registeredDriverName(noopDriver{}))
+}
+
 //nolint:sqlclosecheck
 func TestBatchConn_DoneState(t *testing.T) {
 	ctx := context.Background()
@@ -229,3 +316,40 @@ func TestBatchConn_DoneState(t *testing.T) {
 		assert.ErrorIs(t, err, sql.ErrConnDone)
 	})
 }
+
+func TestBatchConn_maybeWithoutCancel(t *testing.T) {
+	type key struct{}
+
+	t.Run("detached tx", func(t *testing.T) {
+		bdb := New(nil, WithoutCancel(true), WithoutCancelTimeout(time.Hour))
+
+		beginCtx, cancelBegin := context.WithCancel(context.Background())
+		txCtx, txCancel := bdb.detachTx(beginCtx)
+		cancelBegin()
+
+		bc := &BatchConn{db: bdb, tx: &sqlx.Tx{}, txCtx: txCtx, txCancel: txCancel}
+
+		callCtx, cancelCall := context.WithCancel(context.WithValue(context.Background(), key{}, "value"))
+		cancelCall()
+
+		ctx := bc.maybeWithoutCancel(callCtx)
+		assert.NoError(t, ctx.Err())
+		assert.Equal(t, "value", ctx.Value(key{}))
+		_, hasDeadline := ctx.Deadline()
+		assert.True(t, hasDeadline)
+
+		bc.finishTxCtx()
+		assert.ErrorIs(t, ctx.Err(), context.Canceled)
+	})
+
+	t.Run("without option", func(t *testing.T) {
+		bdb := New(nil)
+		bc := &BatchConn{db: bdb, tx: &sqlx.Tx{}}
+
+		callCtx, cancelCall := context.WithCancel(context.Background())
+		cancelCall()
+
+		ctx := bc.maybeWithoutCancel(callCtx)
+		assert.ErrorIs(t, ctx.Err(), context.Canceled)
+	})
+}
@@ -3,8 +3,10 @@ package dbbatch
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"errors"
 	"fmt"
+	"sync/atomic"
 
 	"github.com/jmoiron/sqlx"
 )
@@ -15,24 +17,49 @@ var (
 	ErrStmtNotSupported     = errors.New("prepared statements are not supported in batch, simple queries")
 	ErrNoRunningBatch       = errors.New("connection has no running batch")
 	ErrHasRunningBatch      = errors.New("connection has running batch")
+	ErrBatchingNotSupported = errors.New("batch sending is unsupported by driver")
+	// ErrForeignBatchConn is returned for the query of BatchDB in the callback of a batch of another BatchDB,
+	// e.g. for the query of another shard in the callback of BatchDB.SendBatch
+	ErrForeignBatchConn = errors.New("context has the batch connection of another BatchDB")
+	// ErrDependencyFailed is wrapped with the error of the prerequisite for every callback skipped by Batch.AddAfter
+	ErrDependencyFailed = errors.New("dependency of the callback failed")
+	// ErrTxCommitRollback is returned by drivers for COMMIT of the failed transaction, which the server rolls back
+	// without error, e.g. after the error of a query ignored by the callback of SendBatchInTx
+	ErrTxCommitRollback = errors.New("commit unexpectedly resulted in rollback")
 )
 
 type BatchDB struct {
 	*sqlx.DB
-	options options
+	options     options
+	origin      *BatchDB       // BatchDB created by New, its copies made by With share batch connections
+	replicaNext *atomic.Uint32 // shared by copies made by With, so they go round the replicas together
+	batchCtxs   *batchContexts // contexts of running batches, tracked in strict batching mode
 }
 
 func New(db *sqlx.DB, opts ...Option) *BatchDB {
 	o := options{
-		withoutCancel: false,
+		withoutCancel:          false,
+		withoutCancelTimeout:   0,
+		maxConcurrentCallbacks: 0,
+		replicas:               nil,
+		replicaPolicy:          ReplicaRoundRobin,
+		bufferedRows:           false,
+		bufferedRowsMaxBytes:   0,
+		hooks:                  nil,
+		strictBatching:         strictBatchingOff,
+		sequentialFallback:     false,
 	}
 	for _, opt := range opts {
 		opt(&o)
 	}
-	return &BatchDB{
-		DB:      db,
-		options: o,
+	bdb := &BatchDB{
+		DB:          db,
+		options:     o,
+		replicaNext: &atomic.Uint32{},
+		batchCtxs:   newBatchContexts(),
 	}
+	bdb.origin = bdb
+	return bdb
 }
 
 func (bdb *BatchDB) maybeWithoutCancel(ctx context.Context) context.Context {
@@ -43,13 +70,27 @@ func (bdb *BatchDB) maybeWithoutCancel(ctx context.Context) context.Context {
 	return ContextWithoutCancel(ctx)
 }
 
+// detachTx returns context for the transaction lifetime, which isn't canceled with ctx.
+// It can be limited by WithoutCancelTimeout option
+func (bdb *BatchDB) detachTx(ctx context.Context) (context.Context, context.CancelFunc) {
+	if bdb.options.withoutCancelTimeout > 0 {
+		return context.WithTimeout(ContextWithoutCancel(ctx), bdb.options.withoutCancelTimeout)
+	}
+
+	return context.WithCancel(ContextWithoutCancel(ctx))
+}
+
 // BatchConn creates *BatchConn. Must call BatchConn.Close() in the end if err is nil
 func (bdb *BatchDB) BatchConn(ctx context.Context) (bc *BatchConn, err error) {
-	if BatchConnFromContext(ctx) != nil {
+	return bdb.batchConn(ctx, bdb.DB)
+}
+
+func (bdb *BatchDB) batchConn(ctx context.Context, db *sqlx.DB) (bc *BatchConn, err error) {
+	if inBatch(ctx) {
 		return nil, errors.New("don't support nested batch")
 	}
 
-	conn, err := bdb.DB.Connx(ctx)
+	conn, err := db.Connx(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("db.Conn(ctx): %w", err)
 	}
@@ -57,7 +98,7 @@ func (bdb *BatchDB) BatchConn(ctx context.Context) (bc *BatchConn, err error) {
 		return nil, errors.New("db.Conn(ctx) returned nil")
 	}
 
-	return newBatchConn(bdb, conn), nil
+	return newBatchConn(bdb, db, conn), nil
 }
 
 func (bdb *BatchDB) BeginBatchTx(ctx context.Context, opts *sql.TxOptions) (*BatchTx, error) {
@@ -70,12 +111,17 @@ func (bdb *BatchDB) BeginBatchTx(ctx context.Context, opts *sql.TxOptions) (*Bat
 }
 
 func (bdb *BatchDB) SendBatch(ctx context.Context, b *Batch) (err error) {
-	bc := BatchConnFromContext(ctx)
+	defer bdb.enterBatch(ctx)()
+
+	bc, err := bdb.ownBatchConn(ctx)
+	if err != nil {
+		return err
+	}
 	if bc != nil {
 		return bc.SendBatch(ctx, b)
 	}
 
-	bc, err = bdb.BatchConn(ctx)
+	bc, err = bdb.batchConn(ctx, bdb.batchDB(ctx))
 	if err != nil {
 		return fmt.Errorf("bdb.BatchConn: %w", err)
 	}
@@ -86,25 +132,161 @@ func (bdb *BatchDB) SendBatch(ctx context.Context, b *Batch) (err error) {
 	return bc.SendBatch(bdb.maybeWithoutCancel(ctx), b)
 }
 
+// SendBatchInTx sends batch in a transaction without separate round trips for BEGIN and COMMIT.
+// BEGIN is queued first in the pipeline of the first round. COMMIT is queued in the last round,
+// if callbacks mark their last queries with LastQuery, otherwise it's sent after the last round,
+// because it's unknown in advance which round is the last one.
+// If the batch fails, the transaction is rolled back. Errors returned by callbacks after COMMIT is queued
+// don't roll back the transaction. If the transaction failed on the server, e.g. a callback ignored the error
+// of its query, COMMIT rolls it back and the error wraps ErrTxCommitRollback
+func (bdb *BatchDB) SendBatchInTx(ctx context.Context, b *Batch, opts *sql.TxOptions) (err error) {
+	if b == nil {
+		return errors.New("batch must be not nil")
+	}
+	begin, err := beginStatement(opts)
+	if err != nil {
+		return err
+	}
+	defer bdb.enterBatch(ctx)()
+
+	bc, err := bdb.BatchConn(ctx)
+	if err != nil {
+		return fmt.Errorf("bdb.BatchConn: %w", err)
+	}
+	defer func() {
+		_ = bc.Close()
+	}()
+
+	ctx = bdb.maybeWithoutCancel(ctx)
+
+	committed := false
+	tb := b.prepend(func(ctx context.Context) error {
+		_, err := bc.ExecContext(LastQuery(ctx), begin)
+		return err
+	}).withFinal(func(ctx context.Context) error {
+		_, err := bc.ExecContext(ContextWithoutCancel(ctx), "commit")
+		if err != nil {
+			return fmt.Errorf("commit: %w", err)
+		}
+		committed = true
+		return nil
+	})
+
+	err = bc.SendBatch(ctx, tb)
+	if err != nil && !committed {
+		return errors.Join(err, bc.rollbackRaw(ctx))
+	}
+
+	return err
+}
+
+// rollbackRaw rolls back the transaction started by BEGIN statement.
+// Such transaction is unknown to database/sql, so the connection is discarded if the rollback fails,
+// it must not return to the pool inside the transaction
+func (bc *BatchConn) rollbackRaw(ctx context.Context) error {
+	_, err := bc.ExecContext(ContextWithoutCancel(ctx), "rollback")
+	if err == nil {
+		return nil
+	}
+
+	_ = bc.conn.Raw(func(any) error {
+		return driver.ErrBadConn
+	})
+
+	return fmt.Errorf("rollback: %w", err)
+}
+
+// beginStatement builds BEGIN statement with isolation level and access mode from opts
+func beginStatement(opts *sql.TxOptions) (string, error) {
+	if opts == nil {
+		return "begin", nil
+	}
+
+	stmt := "begin"
+
+	switch opts.Isolation {
+	case sql.LevelDefault:
+	case sql.LevelReadUncommitted:
+		stmt += " isolation level read uncommitted"
+	case sql.LevelReadCommitted:
+		stmt += " isolation level read committed"
+	case sql.LevelRepeatableRead, sql.LevelSnapshot:
+		stmt += " isolation level repeatable read"
+	case sql.LevelSerializable:
+		stmt += " isolation level serializable"
+	default:
+		return "", fmt.Errorf("unsupported isolation: %v", opts.Isolation)
+	}
+
+	if opts.ReadOnly {
+		stmt += " read only"
+	}
+
+	return stmt, nil
+}
+
+// originDB returns BatchDB created by New, bdb itself if it's not created by New
+func (bdb *BatchDB) originDB() *BatchDB {
+	if bdb.origin == nil {
+		return bdb
+	}
+	return bdb.origin
+}
+
+// ownBatchConn returns the batch connection of bdb from ctx, nil without running batch.
+// In the callback of MultiDB.SendBatch it's the connection of the shard.
+// The connection of another BatchDB is ErrForeignBatchConn, the query must not go to a wrong database.
+// The connection without BatchDB like in Plan is used by any BatchDB
+func (bdb *BatchDB) ownBatchConn(ctx context.Context) (*BatchConn, error) {
+	if mc := multiConnsFromContext(ctx); mc != nil && BatchConnFromContext(ctx) == nil {
+		return mc.conn(ctx, bdb)
+	}
+
+	bc := BatchConnFromContext(ctx)
+	if bc == nil {
+		return nil, nil
+	}
+	if bc.db != nil && bc.db.originDB() != bdb.originDB() {
+		return nil, ErrForeignBatchConn
+	}
+	return bc, nil
+}
+
 // overwrite all methods of DB with context
 // except PrepareContext, PreparexContext, NamedPrepareContext
 // (unsupported in batch, will get error from driver if there batch runner in context)
 // Methods without context reused from sqlx.DB. PingContext reused from sqlx.DB
 
 func (bdb *BatchDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
-	if bc := BatchConnFromContext(ctx); bc != nil {
+	bc, err := bdb.ownBatchConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if bc != nil {
 		return bc.QueryContext(ctx, query, args...)
 	}
 
+	if err = bdb.beforeQuery(ctx, query); err != nil {
+		return nil, err
+	}
+
 	// waiting conn cancelling optimization not implemented as requires breaking API by returning extended row
 	return bdb.DB.QueryContext(bdb.maybeWithoutCancel(ctx), query, args...)
 }
 
 func (bdb *BatchDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
-	if bc := BatchConnFromContext(ctx); bc != nil {
+	bc, err := bdb.ownBatchConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if bc != nil {
 		return bc.ExecContext(ctx, query, args...)
 	}
 
+	if err = bdb.beforeQuery(ctx, query); err != nil {
+		return nil, err
+	}
+
 	// optimization: waiting conn can be canceled
 	if bdb.options.withoutCancel {
 		conn, err := bdb.DB.Conn(ctx)
@@ -120,37 +302,69 @@ func (bdb *BatchDB) ExecContext(ctx context.Context, query string, args ...any)
 }
 
 func (bdb *BatchDB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
-	if bc := BatchConnFromContext(ctx); bc != nil {
+	bc, err := bdb.ownBatchConn(ctx)
+	if err != nil {
+		return errorRow(err)
+	}
+	if bc != nil {
 		return bc.QueryRowContext(ctx, query, args...)
 	}
 
+	if err = bdb.beforeQuery(ctx, query); err != nil {
+		return errorRow(err)
+	}
+
 	// waiting conn cancelling optimization not implemented as requires breaking API by returning extended row
 	return bdb.DB.QueryRowContext(bdb.maybeWithoutCancel(ctx), query, args...)
 }
 
 func (bdb *BatchDB) QueryxContext(ctx context.Context, query string, args ...any) (*sqlx.Rows, error) {
-	if bc := BatchConnFromContext(ctx); bc != nil {
+	bc, err := bdb.ownBatchConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if bc != nil {
 		return bc.QueryxContext(ctx, query, args...)
 	}
 
+	if err = bdb.beforeQuery(ctx, query); err != nil {
+		return nil, err
+	}
+
 	// waiting conn cancelling optimization not implemented as requires breaking API by returning extended row
 	return bdb.DB.QueryxContext(bdb.maybeWithoutCancel(ctx), query, args...)
 }
 
 func (bdb *BatchDB) QueryRowxContext(ctx context.Context, query string, args ...any) *sqlx.Row {
-	if bc := BatchConnFromContext(ctx); bc != nil {
+	bc, err := bdb.ownBatchConn(ctx)
+	if err != nil {
+		return errorRowx(err)
+	}
+	if bc != nil {
 		return bc.QueryRowxContext(ctx, query, args...)
 	}
 
+	if err = bdb.beforeQuery(ctx, query); err != nil {
+		return errorRowx(err)
+	}
+
 	// waiting conn cancelling optimization not implemented as requires breaking API by returning extended row
 	return bdb.DB.QueryRowxContext(bdb.maybeWithoutCancel(ctx), query, args...)
 }
 
 func (bdb *BatchDB) MustExecContext(ctx context.Context, query string, args ...any) sql.Result {
-	if bc := BatchConnFromContext(ctx); bc != nil {
+	bc, err := bdb.ownBatchConn(ctx)
+	if err != nil {
+		panic(err)
+	}
+	if bc != nil {
 		return bc.MustExecContext(ctx, query, args...)
 	}
 
+	if err = bdb.beforeQuery(ctx, query); err != nil {
+		panic(err)
+	}
+
 	// optimization: waiting conn can be canceled
 	if bdb.options.withoutCancel {
 		conn, err := bdb.DB.Connx(ctx)
@@ -166,10 +380,18 @@ func (bdb *BatchDB) MustExecContext(ctx context.Context, query string, args ...a
 }
 
 func (bdb *BatchDB) GetContext(ctx context.Context, dest any, query string, args ...any) error {
-	if bc := BatchConnFromContext(ctx); bc != nil {
+	bc, err := bdb.ownBatchConn(ctx)
+	if err != nil {
+		return err
+	}
+	if bc != nil {
 		return bc.GetContext(ctx, dest, query, args...)
 	}
 
+	if err = bdb.beforeQuery(ctx, query); err != nil {
+		return err
+	}
+
 	// optimization: waiting conn can be canceled
 	if bdb.options.withoutCancel {
 		conn, err := bdb.DB.Connx(ctx)
@@ -185,10 +407,18 @@ func (bdb *BatchDB) GetContext(ctx context.Context, dest any, query string, args
 }
 
 func (bdb *BatchDB) SelectContext(ctx context.Context, dest any, query string, args ...any) error {
-	if bc := BatchConnFromContext(ctx); bc != nil {
+	bc, err := bdb.ownBatchConn(ctx)
+	if err != nil {
+		return err
+	}
+	if bc != nil {
 		return bc.SelectContext(ctx, dest, query, args...)
 	}
 
+	if err = bdb.beforeQuery(ctx, query); err != nil {
+		return err
+	}
+
 	// optimization: waiting conn can be canceled
 	if bdb.options.withoutCancel {
 		conn, err := bdb.DB.Connx(ctx)
@@ -204,18 +434,34 @@ func (bdb *BatchDB) SelectContext(ctx context.Context, dest any, query string, a
 }
 
 func (bdb *BatchDB) NamedQueryContext(ctx context.Context, query string, arg any) (*sqlx.Rows, error) {
-	if bc := BatchConnFromContext(ctx); bc != nil {
+	bc, err := bdb.ownBatchConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if bc != nil {
 		return bc.NamedQueryContext(ctx, query, arg)
 	}
 
+	if err = bdb.beforeQuery(ctx, query); err != nil {
+		return nil, err
+	}
+
 	return bdb.DB.NamedQueryContext(bdb.maybeWithoutCancel(ctx), query, arg)
 }
 
 func (bdb *BatchDB) NamedExecContext(ctx context.Context, query string, arg any) (sql.Result, error) {
-	if bc := BatchConnFromContext(ctx); bc != nil {
+	bc, err := bdb.ownBatchConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if bc != nil {
 		return bc.NamedExecContext(ctx, query, arg)
 	}
 
+	if err = bdb.beforeQuery(ctx, query); err != nil {
+		return nil, err
+	}
+
 	// optimization: waiting conn can be canceled
 	if bdb.options.withoutCancel {
 		conn, err := bdb.DB.Connx(ctx)
@@ -234,6 +480,66 @@ func (bdb *BatchDB) NamedExecContext(ctx context.Context, query string, arg any)
 	return bdb.DB.NamedExecContext(ctx, query, arg)
 }
 
+// Methods without context go through methods with context of BatchDB, so they get hooks and strict batching checks
+
+func (bdb *BatchDB) Query(query string, args ...any) (*sql.Rows, error) {
+	return bdb.QueryContext(context.Background(), query, args...)
+}
+
+func (bdb *BatchDB) Exec(query string, args ...any) (sql.Result, error) {
+	return bdb.ExecContext(context.Background(), query, args...)
+}
+
+func (bdb *BatchDB) QueryRow(query string, args ...any) *sql.Row {
+	return bdb.QueryRowContext(context.Background(), query, args...)
+}
+
+func (bdb *BatchDB) Queryx(query string, args ...any) (*sqlx.Rows, error) {
+	return bdb.QueryxContext(context.Background(), query, args...)
+}
+
+func (bdb *BatchDB) QueryRowx(query string, args ...any) *sqlx.Row {
+	return bdb.QueryRowxContext(context.Background(), query, args...)
+}
+
+func (bdb *BatchDB) MustExec(query string, args ...any) sql.Result {
+	return bdb.MustExecContext(context.Background(), query, args...)
+}
+
+func (bdb *BatchDB) Get(dest any, query string, args ...any) error {
+	return bdb.GetContext(context.Background(), dest, query, args...)
+}
+
+func (bdb *BatchDB) Select(dest any, query string, args ...any) error {
+	return bdb.SelectContext(context.Background(), dest, query, args...)
+}
+
+func (bdb *BatchDB) NamedQuery(query string, arg any) (*sqlx.Rows, error) {
+	return bdb.NamedQueryContext(context.Background(), query, arg)
+}
+
+func (bdb *BatchDB) NamedExec(query string, arg any) (sql.Result, error) {
+	return bdb.NamedExecContext(context.Background(), query, arg)
+}
+
+// InSelectContext expands slice args of `IN (?)` query by sqlx.In, rebinds and selects it
+func (bdb *BatchDB) InSelectContext(ctx context.Context, dest any, query string, args ...any) error {
+	q, args, err := sqlx.In(query, args...)
+	if err != nil {
+		return err
+	}
+	return bdb.SelectContext(ctx, dest, bdb.Rebind(q), args...)
+}
+
+// InGetContext expands slice args of `IN (?)` query by sqlx.In, rebinds and gets it
+func (bdb *BatchDB) InGetContext(ctx context.Context, dest any, query string, args ...any) error {
+	q, args, err := sqlx.In(query, args...)
+	if err != nil {
+		return err
+	}
+	return bdb.GetContext(ctx, dest, bdb.Rebind(q), args...)
+}
+
 func (bdb *BatchDB) MustBeginTx(ctx context.Context, opts *sql.TxOptions) *sqlx.Tx {
 	tx, err := bdb.BeginTxx(ctx, opts)
 	if err != nil {
@@ -243,7 +549,7 @@ func (bdb *BatchDB) MustBeginTx(ctx context.Context, opts *sql.TxOptions) *sqlx.
 }
 
 func (bdb *BatchDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
-	if bc := BatchConnFromContext(ctx); bc != nil {
+	if inBatch(ctx) {
 		return nil, ErrTxNotSupported
 	}
 
@@ -251,7 +557,7 @@ func (bdb *BatchDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx,
 }
 
 func (bdb *BatchDB) BeginTxx(ctx context.Context, opts *sql.TxOptions) (*sqlx.Tx, error) {
-	if bc := BatchConnFromContext(ctx); bc != nil {
+	if inBatch(ctx) {
 		return nil, ErrTxNotSupported
 	}
 
@@ -259,17 +565,17 @@ func (bdb *BatchDB) BeginTxx(ctx context.Context, opts *sql.TxOptions) (*sqlx.Tx
 }
 
 func (bdb *BatchDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
-	if bc := BatchConnFromContext(ctx); bc != nil {
+	if inBatch(ctx) {
 		return nil, ErrStmtNotSupported
 	}
 
-	return bdb.DB.PrepareContext(ctx, query)
+	return bdb.DB.PrepareContext(bdb.maybeWithoutCancel(ctx), query)
 }
 
 func (bdb *BatchDB) PreparexContext(ctx context.Context, query string) (*sqlx.Stmt, error) {
-	if bc := BatchConnFromContext(ctx); bc != nil {
+	if inBatch(ctx) {
 		return nil, ErrStmtNotSupported
 	}
 
-	return bdb.DB.PreparexContext(ctx, query)
+	return bdb.DB.PreparexContext(bdb.maybeWithoutCancel(ctx), query)
 }
@@ -10,13 +10,12 @@ import (
 
 //nolint:sqlclosecheck
 func TestBatchDB_withDoneConn(t *testing.T) {
-	bc := &BatchConn{}
+	bdb := &BatchDB{}
+	bc := &BatchConn{db: bdb}
 	bc.done = true
 
 	ctx := SetBatchConnToContext(context.Background(), bc)
 
-	bdb := &BatchDB{}
-
 	t.Run("BeginBatchTx", func(t *testing.T) {
 		_, err := bdb.BeginBatchTx(ctx, &sql.TxOptions{})
 		assert.EqualError(t, err, "bdb.BatchConn: don't support nested batch")
@@ -27,6 +26,11 @@ func TestBatchDB_withDoneConn(t *testing.T) {
 		assert.ErrorIs(t, err, sql.ErrConnDone)
 	})
 
+	t.Run("SendBatchInTx", func(t *testing.T) {
+		err := bdb.SendBatchInTx(ctx, &Batch{}, &sql.TxOptions{})
+		assert.EqualError(t, err, "bdb.BatchConn: don't support nested batch")
+	})
+
 	t.Run("QueryContext", func(t *testing.T) {
 		_, err := bdb.QueryContext(ctx, "")
 		assert.ErrorIs(t, err, sql.ErrConnDone)
@@ -68,13 +72,12 @@ func TestBatchDB_withDoneConn(t *testing.T) {
 }
 
 func TestBatchDB_TxErrWithConn(t *testing.T) {
-	bc := &BatchConn{}
+	bdb := &BatchDB{}
+	bc := &BatchConn{db: bdb}
 	bc.done = true
 
 	ctx := SetBatchConnToContext(context.Background(), bc)
 
-	bdb := &BatchDB{}
-
 	t.Run("BeginTx", func(t *testing.T) {
 		_, err := bdb.BeginTx(ctx, &sql.TxOptions{})
 		assert.EqualError(t, err, "transaction is not supported in batch, use BeginBatchTx method")
@@ -85,3 +88,46 @@ func TestBatchDB_TxErrWithConn(t *testing.T) {
 		assert.EqualError(t, err, "transaction is not supported in batch, use BeginBatchTx method")
 	})
 }
+
+func TestBeginStatement(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    *sql.TxOptions
+		want    string
+		wantErr string
+	}{
+		{name: "nil", opts: nil, want: "begin"},
+		{name: "default", opts: &sql.TxOptions{}, want: "begin"},
+		{
+			name: "read committed",
+			opts: &sql.TxOptions{Isolation: sql.LevelReadCommitted},
+			want: "begin isolation level read committed",
+		},
+		{
+			name: "serializable read only",
+			opts: &sql.TxOptions{Isolation: sql.LevelSerializable, ReadOnly: true},
+			want: "begin isolation level serializable read only",
+		},
+		{
+			name: "snapshot",
+			opts: &sql.TxOptions{Isolation: sql.LevelSnapshot},
+			want: "begin isolation level repeatable read",
+		},
+		{
+			name:    "linearizable",
+			opts:    &sql.TxOptions{Isolation: sql.LevelLinearizable},
+			wantErr: "unsupported isolation: Linearizable",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := beginStatement(tt.opts)
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
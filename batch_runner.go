@@ -4,40 +4,81 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sync"
 	"time"
 )
 
-const maxAllowedIterations = 10_000_000
+const (
+	maxAllowedIterations = 10_000_000
+	deadlockTimeout      = 120 * time.Second
+)
 
+// batchItem is a worker slot running callbacks one by one.
+// The slot goroutine and channels are reused by the next callbacks and rounds.
 type batchItem struct {
-	i           int
-	cb          CallbackFn
+	i           int // index of the running callback
 	batchResult any
+	start       chan CallbackFn
 	roundTrip   chan struct{}
 	result      chan error
-	isWaiting   bool
-	isFinished  bool
+	group       *Group // group of the child item started by Group.Go, nil for callbacks of the batch
+}
+
+// readyItem is a child item to start with cb or a parent item to resume after Group.Wait if cb is nil
+type readyItem struct {
+	item *batchItem
+	cb   CallbackFn
 }
 type Request struct {
 	Query string
 	Args  []any
+	// Names of args passed as sql.NamedArg, empty for positional args. Nil if there are no named args
+	Names []string
 }
 
 type batchRunner struct {
-	requests    []Request
-	currentItem *batchItem
-	sema        chan struct{} // cap = 1
-	batchSender BatchRequestsSender
+	requests      []Request
+	senders       []BatchRequestsSender // sender of every request, empty if all requests go to batchSender
+	queued        []*batchItem          // items waiting for the round trip, in order of requests
+	freeItems     []*batchItem
+	ready         []readyItem
+	callbacks     *callbackQueue
+	currentItem   *batchItem
+	sema          chan struct{} // cap = 1
+	batchSender   BatchRequestsSender
+	maxConcurrent int
+	deadlockTimer *time.Timer
+	final         CallbackFn // see Batch.final
+	finalItem     *batchItem // item of the final callback, nil until it's started
+	live          int        // count of running callbacks and children of groups
+	lastQueued    int        // count of items queued their last queries to the next round, see LastQuery
+	roundErr      error      // error of sending or closing the round, the batch isn't sent after it
 }
 
+// ErrBatchFinished is returned for the query of the callback after its last query,
+// when the final request of the batch like COMMIT of SendBatchInTx is already sent
+var ErrBatchFinished = errors.New("query after the last query of the callback, the batch is finished")
+
 var _ batchRunnerMachine = &batchRunner{}
 
-func newBatchRunner(batchSender BatchRequestsSender) *batchRunner {
+// newBatchRunner creates batchRunner. maxConcurrentCallbacks <= 0 means no limit
+func newBatchRunner(batchSender BatchRequestsSender, maxConcurrentCallbacks int) *batchRunner {
 	return &batchRunner{
-		requests:    []Request{},
-		currentItem: nil,
-		sema:        make(chan struct{}, 1),
-		batchSender: batchSender,
+		requests:      []Request{},
+		senders:       nil,
+		queued:        nil,
+		freeItems:     nil,
+		ready:         nil,
+		callbacks:     nil,
+		currentItem:   nil,
+		sema:          make(chan struct{}, 1),
+		batchSender:   batchSender,
+		maxConcurrent: maxConcurrentCallbacks,
+		final:         nil,
+		finalItem:     nil,
+		live:          0,
+		lastQueued:    0,
+		roundErr:      nil,
 	}
 }
 
@@ -46,65 +87,115 @@ func (br *batchRunner) run(ctx context.Context, b *Batch) (err error) {
 		return errors.New("batch must be not nil")
 	}
 
-	items := make([]batchItem, 0, len(b.Callbacks()))
-	for i, cb := range b.Callbacks() {
-		items = append(items, batchItem{
-			i:          i,
-			cb:         cb,
-			roundTrip:  make(chan struct{}),
-			result:     make(chan error),
-			isFinished: false,
-		})
+	callbacks := b.Callbacks()
+	br.callbacks, err = newCallbackQueue(b)
+	if err != nil {
+		return err
+	}
+	br.final = b.final
+
+	br.deadlockTimer = time.NewTimer(deadlockTimeout)
+	defer br.deadlockTimer.Stop()
+
+	itemsCount := br.maxConcurrent
+	if itemsCount <= 0 || itemsCount > len(callbacks) {
+		itemsCount = len(callbacks)
 	}
 
-	// run goroutines
+	items := make([]batchItem, itemsCount)
+	br.freeItems = make([]*batchItem, 0, itemsCount)
 	for i := range items {
-		br.currentItem = &items[i]
+		items[i] = batchItem{
+			start:     make(chan CallbackFn),
+			roundTrip: make(chan struct{}),
+			result:    make(chan error),
+		}
+		go br.work(ctx, &items[i])
+		br.freeItems = append(br.freeItems, &items[i])
+	}
+	defer func() {
+		for i := range items {
+			close(items[i].start)
+		}
+	}()
 
-		br.sema <- struct{}{}
+	// run ready callbacks while there are free items
+	startCallbacks := func() {
+		for len(br.freeItems) > 0 && br.roundErr == nil {
+			next, ok := br.callbacks.next()
+			if !ok {
+				return
+			}
 
-		go func() {
-			cbErr := br.currentItem.cb(ctx)
-			br.currentItem.result <- cbErr
-		}()
+			item := br.freeItems[len(br.freeItems)-1]
+			br.freeItems = br.freeItems[:len(br.freeItems)-1]
 
-		resultErr := br.waitForCurrentItemFinishedOrLocked()
-		err = errors.Join(err, resultErr)
+			item.i = next
+			br.live++
+			resultErr := br.startItem(item, callbacks[next])
+			err = errors.Join(err, resultErr)
+		}
 	}
 
-	// do batches while all goroutines not done
+	startCallbacks()
+
+	// do batches while all callbacks not done
 	var (
 		res          any
+		results      []any // result of every request, if requests go to several senders
 		closeFn      func() error
 		sendBatchErr error
+		roundItems   []*batchItem
 		iteration    = 0
 	)
-	for len(br.requests) > 0 {
-		res, closeFn, sendBatchErr = br.batchSender.SendBatchRequests(ctx, br.requests)
-		if sendBatchErr != nil {
-			return fmt.Errorf("batchSender.sendBatch: %w", sendBatchErr)
+	for {
+		if br.final != nil && br.finalItem == nil && err == nil && br.roundErr == nil && br.isLastRound() {
+			err = br.startFinal(ctx)
+		}
+		if len(br.requests) == 0 {
+			break
 		}
-		br.requests = br.requests[:0]
-
-		for i := range items {
-			br.currentItem = &items[i]
 
-			if br.currentItem.isFinished {
-				continue
+		sendCtx := ctx
+		if br.finalItem != nil {
+			// the final request like COMMIT must not be interrupted
+			sendCtx = ContextWithoutCancel(ctx)
+		}
+		if br.roundErr == nil {
+			if len(br.senders) == 0 {
+				res, closeFn, sendBatchErr = br.batchSender.SendBatchRequests(sendCtx, br.requests)
+			} else {
+				results, closeFn, sendBatchErr = br.sendToSenders(sendCtx)
 			}
+			if sendBatchErr != nil {
+				br.roundErr = fmt.Errorf("batchSender.sendBatch: %w", sendBatchErr)
+			}
+		}
+		if br.roundErr != nil {
+			// the round isn't sent, waiting callbacks get the error from roundTrip and their next queries fail with it
+			res, results, closeFn = nil, nil, noopClose
+		}
+		br.requests = br.requests[:0]
+		br.senders = br.senders[:0]
+		br.lastQueued = 0
 
-			br.sema <- struct{}{}
-			br.currentItem.batchResult = res
-			br.currentItem.roundTrip <- struct{}{}
-
-			resultErr := br.waitForCurrentItemFinishedOrLocked()
+		// items read results in the same order as requests were queued
+		roundItems, br.queued = br.queued, roundItems[:0]
+		for k, item := range roundItems {
+			if results != nil {
+				res = results[k]
+			}
+			resultErr := br.resumeItem(item, res)
 			err = errors.Join(err, resultErr)
 		}
 
-		if closeErr := closeFn(); closeErr != nil {
-			return fmt.Errorf("close batch results: %w", closeErr)
+		if closeErr := closeFn(); closeErr != nil && br.roundErr == nil {
+			br.roundErr = fmt.Errorf("close batch results: %w", closeErr)
 		}
 
+		// finished callbacks released items for the rest ones, their requests go to the next round
+		startCallbacks()
+
 		iteration++
 		if iteration >= maxAllowedIterations {
 			return fmt.Errorf("max allowed iterations %d reached", iteration)
@@ -112,17 +203,158 @@ func (br *batchRunner) run(ctx context.Context, b *Batch) (err error) {
 	}
 	// got all results
 
+	if br.roundErr != nil {
+		return br.roundErr
+	}
+
+	return err
+}
+
+func noopClose() error {
+	return nil
+}
+
+// sendToSenders sends requests of every sender concurrently on its connection, so the round costs one round trip time.
+// Returns results in order of requests
+func (br *batchRunner) sendToSenders(ctx context.Context) (results []any, closeFn func() error, err error) {
+	type senderRound struct {
+		requests []Request
+		res      any
+		closeFn  func() error
+		err      error
+	}
+
+	rounds := make(map[BatchRequestsSender]*senderRound)
+	order := make([]BatchRequestsSender, 0, 1)
+	for i, sender := range br.senders {
+		round, ok := rounds[sender]
+		if !ok {
+			round = &senderRound{}
+			rounds[sender] = round
+			order = append(order, sender)
+		}
+		round.requests = append(round.requests, br.requests[i])
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(len(order))
+	for _, sender := range order {
+		go func(sender BatchRequestsSender, round *senderRound) {
+			defer wg.Done()
+			round.res, round.closeFn, round.err = sender.SendBatchRequests(ctx, round.requests)
+		}(sender, rounds[sender])
+	}
+	wg.Wait()
+
+	closeFn = func() (closeErr error) {
+		for _, sender := range order {
+			if round := rounds[sender]; round.closeFn != nil {
+				closeErr = errors.Join(closeErr, round.closeFn())
+			}
+		}
+		return closeErr
+	}
+
+	for _, sender := range order {
+		err = errors.Join(err, rounds[sender].err)
+	}
+	if err != nil {
+		_ = closeFn()
+		return nil, nil, err
+	}
+
+	results = make([]any, len(br.senders))
+	for i, sender := range br.senders {
+		results[i] = rounds[sender].res
+	}
+
+	return results, closeFn, nil
+}
+
+// isLastRound reports whether callbacks make no requests after the next round:
+// all running callbacks queued their last queries and no callbacks wait to start
+func (br *batchRunner) isLastRound() bool {
+	return len(br.ready) == 0 && br.callbacks.remaining() == 0 && br.lastQueued == br.live
+}
+
+// startFinal starts the final callback, its request goes to the next round
+func (br *batchRunner) startFinal(ctx context.Context) error {
+	br.finalItem = &batchItem{
+		i:         -1,
+		start:     make(chan CallbackFn),
+		roundTrip: make(chan struct{}),
+		result:    make(chan error),
+	}
+	go br.work(ctx, br.finalItem)
+
+	return br.startItem(br.finalItem, br.final)
+}
+
+// work runs callbacks of the item one by one
+func (br *batchRunner) work(ctx context.Context, item *batchItem) {
+	for cb := range item.start {
+		item.result <- cb(ctx)
+	}
+}
+
+func (br *batchRunner) startItem(item *batchItem, cb CallbackFn) error {
+	br.currentItem = item
+
+	br.sema <- struct{}{}
+	item.start <- cb
+
+	err := br.waitForCurrentItemFinishedOrLocked()
+	return errors.Join(err, br.runReady())
+}
+
+func (br *batchRunner) resumeItem(item *batchItem, res any) error {
+	br.currentItem = item
+
+	br.sema <- struct{}{}
+	item.batchResult = res
+	item.roundTrip <- struct{}{}
+
+	err := br.waitForCurrentItemFinishedOrLocked()
+	return errors.Join(err, br.runReady())
+}
+
+// runReady starts child items of groups and resumes parents waiting for finished groups
+func (br *batchRunner) runReady() (err error) {
+	for len(br.ready) > 0 {
+		ready := br.ready[0]
+		br.ready = br.ready[1:]
+
+		br.currentItem = ready.item
+
+		br.sema <- struct{}{}
+		if ready.cb != nil {
+			ready.item.start <- ready.cb
+		} else {
+			ready.item.roundTrip <- struct{}{}
+		}
+
+		err = errors.Join(err, br.waitForCurrentItemFinishedOrLocked())
+	}
+
 	return err
 }
 
-// Wait for created item goroutine finished or locked by db query/exec
+// Wait for current item callback finished or locked by db query/exec
 func (br *batchRunner) waitForCurrentItemFinishedOrLocked() (err error) {
+	// timer is reused to avoid allocation for every wait
+	if !br.deadlockTimer.Stop() {
+		select {
+		case <-br.deadlockTimer.C:
+		default:
+		}
+	}
+	br.deadlockTimer.Reset(deadlockTimeout)
+
 	select {
 	case err = <-br.currentItem.result:
-		close(br.currentItem.roundTrip)
-		br.currentItem.isFinished = true
+		err = br.finishItem(br.currentItem, err)
 	case br.sema <- struct{}{}:
-	case <-time.After(120 * time.Second):
+	case <-br.deadlockTimer.C:
 		panic("possible deadlock in waiting for finished batch callbacks")
 	}
 
@@ -131,24 +363,96 @@ func (br *batchRunner) waitForCurrentItemFinishedOrLocked() (err error) {
 	return err
 }
 
-// Queue Only for using in the driver implementation code!
-func (br *batchRunner) Queue(request Request) any {
-	if !br.currentItem.isWaiting {
-		br.currentItem.isWaiting = true
-		br.requests = append(br.requests, request)
+// finishItem releases the item of the finished callback. Error of the child item goes to its group
+func (br *batchRunner) finishItem(item *batchItem, err error) error {
+	item.batchResult = nil
+
+	if item == br.finalItem {
+		close(item.start)
+		return err
+	}
+
+	br.live--
+	g := item.group
+	if g == nil {
+		skipErr := br.callbacks.done(item.i, err)
+		br.freeItems = append(br.freeItems, item)
+		return errors.Join(err, skipErr)
+	}
+
+	close(item.start)
+	g.errs = append(g.errs, err)
+	g.pending--
+	if g.pending == 0 && g.parent != nil {
+		br.ready = append(br.ready, readyItem{item: g.parent, cb: nil})
+	}
+
+	return nil
+}
+
+// spawn adds the child item of the group, it starts after the current item yields
+func (br *batchRunner) spawn(ctx context.Context, g *Group, fn CallbackFn) {
+	item := &batchItem{
+		i:         br.currentItem.i, // child belongs to the callback of the parent
+		start:     make(chan CallbackFn),
+		roundTrip: make(chan struct{}),
+		result:    make(chan error),
+		group:     g,
+	}
+	go br.work(ctx, item)
+
+	br.live++
+	g.pending++
+	br.ready = append(br.ready, readyItem{item: item, cb: fn})
+}
+
+// yield releases the batch without request, until all children of the group finished
+func (br *batchRunner) yield(g *Group) {
+	// important to save currentItem pointer before releasing batchSender.sema
+	currentItem := br.currentItem
+	g.parent = currentItem
+	<-br.sema
+	<-currentItem.roundTrip
+	g.parent = nil
+}
 
-		return nil
+// beforeQueue checks the request of the current callback before queueing, last is set for LastQuery
+func (br *batchRunner) beforeQueue(last bool) error {
+	if br.roundErr != nil {
+		return br.roundErr
 	}
+	if br.finalItem != nil && br.currentItem != br.finalItem {
+		return ErrBatchFinished
+	}
+	if last {
+		br.lastQueued++
+	}
+	return nil
+}
 
-	res := br.currentItem.batchResult // if we read this sema, then batchSender.sema already locked
-	br.currentItem.isWaiting = false
+// Queue adds request of the current callback to the next round trip
+func (br *batchRunner) Queue(request Request) {
+	br.requests = append(br.requests, request)
+	br.queued = append(br.queued, br.currentItem)
+}
+
+// queueTo adds request of the current callback to the next round trip of the sender.
+// The runner doesn't mix it with Queue, all requests go either to its batchSender or to senders of requests
+func (br *batchRunner) queueTo(sender BatchRequestsSender, request Request) {
+	br.senders = append(br.senders, sender)
+	br.Queue(request)
+}
 
-	return res
+// Result Only for using in the driver implementation code!
+func (br *batchRunner) Result() any {
+	return br.currentItem.batchResult // if we read this sema, then batchSender.sema already locked
 }
 
-func (br *batchRunner) roundTrip() {
+// roundTrip waits for the round with the request of the current callback, returns the error if the round failed
+func (br *batchRunner) roundTrip() error {
 	// important to save currentItem pointer before releasing batchSender.sema
 	currentItem := br.currentItem
 	<-br.sema
 	<-currentItem.roundTrip
+	return br.roundErr
 }
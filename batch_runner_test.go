@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/mock/gomock"
 )
 
@@ -25,7 +26,7 @@ func TestBatchRunner_OneStep(t *testing.T) {
 		return nil
 	}, nil)
 
-	br := newBatchRunner(batchSenderMock)
+	br := newBatchRunner(batchSenderMock, 0)
 
 	a := 0
 
@@ -33,12 +34,10 @@ func TestBatchRunner_OneStep(t *testing.T) {
 	b.Add(func(ctx context.Context) error {
 		a += 1
 
-		res := br.Queue(Request{Query: "first", Args: []any{1, 2}})
-		assert.Nil(t, res)
-
+		br.Queue(Request{Query: "first", Args: []any{1, 2}})
 		br.roundTrip()
 
-		res = br.Queue(Request{Query: "first", Args: []any{1, 2}})
+		res := br.Result()
 		assert.Equal(t, result1, res)
 
 		return nil
@@ -46,12 +45,10 @@ func TestBatchRunner_OneStep(t *testing.T) {
 	b.Add(func(ctx context.Context) error {
 		a += 100
 
-		res := br.Queue(Request{Query: "second", Args: []any{3, 4}})
-		assert.Nil(t, res)
-
+		br.Queue(Request{Query: "second", Args: []any{3, 4}})
 		br.roundTrip()
 
-		res = br.Queue(Request{Query: "second", Args: []any{3, 4}})
+		res := br.Result()
 		assert.Equal(t, result1, res)
 
 		return nil
@@ -88,7 +85,7 @@ func TestBatchRunner_MultiStep(t *testing.T) {
 		return nil
 	}, nil)
 
-	br := newBatchRunner(batchSenderMock)
+	br := newBatchRunner(batchSenderMock, 0)
 
 	a := 0
 
@@ -96,20 +93,16 @@ func TestBatchRunner_MultiStep(t *testing.T) {
 	b.Add(func(ctx context.Context) error {
 		a += 1
 
-		res := br.Queue(request1)
-		assert.Nil(t, res)
-
+		br.Queue(request1)
 		br.roundTrip()
 
-		res = br.Queue(request1)
+		res := br.Result()
 		assert.Equal(t, result1, res)
 
-		res = br.Queue(request3)
-		assert.Nil(t, res)
-
+		br.Queue(request3)
 		br.roundTrip()
 
-		res = br.Queue(request3)
+		res = br.Result()
 		assert.Equal(t, result2, res)
 
 		return nil
@@ -117,12 +110,10 @@ func TestBatchRunner_MultiStep(t *testing.T) {
 	b.Add(func(ctx context.Context) error {
 		a += 100
 
-		res := br.Queue(request2)
-		assert.Nil(t, res)
-
+		br.Queue(request2)
 		br.roundTrip()
 
-		res = br.Queue(request2)
+		res := br.Result()
 		assert.Equal(t, result1, res)
 
 		return nil
@@ -159,7 +150,7 @@ func TestBatchRunner_Error(t *testing.T) {
 		return nil
 	}, nil)
 
-	br := newBatchRunner(batchSenderMock)
+	br := newBatchRunner(batchSenderMock, 0)
 
 	a := 0
 
@@ -167,20 +158,16 @@ func TestBatchRunner_Error(t *testing.T) {
 	b.Add(func(ctx context.Context) error {
 		a += 1
 
-		res := br.Queue(request1)
-		assert.Nil(t, res)
-
+		br.Queue(request1)
 		br.roundTrip()
 
-		res = br.Queue(request1)
+		res := br.Result()
 		assert.Equal(t, result1, res)
 
-		res = br.Queue(request3)
-		assert.Nil(t, res)
-
+		br.Queue(request3)
 		br.roundTrip()
 
-		res = br.Queue(request3)
+		res = br.Result()
 		assert.Equal(t, result2, res)
 
 		return nil
@@ -188,12 +175,10 @@ func TestBatchRunner_Error(t *testing.T) {
 	b.Add(func(ctx context.Context) error {
 		a += 100
 
-		res := br.Queue(request2)
-		assert.Nil(t, res)
-
+		br.Queue(request2)
 		br.roundTrip()
 
-		res = br.Queue(request2)
+		res := br.Result()
 		assert.Equal(t, result1, res)
 
 		return errors.New("some error")
@@ -219,28 +204,32 @@ func TestBatchRunner_SendBatchErr(t *testing.T) {
 		return nil
 	}, errors.New("some error"))
 
-	br := newBatchRunner(batchSenderMock)
+	br := newBatchRunner(batchSenderMock, 0)
 
 	a := 0
+	var roundTripErr, nextQueryErr error
 
 	b := &Batch{}
 	b.Add(func(ctx context.Context) error {
 		a += 1
 
-		res := br.Queue(request1)
-		assert.Nil(t, res)
-
-		br.roundTrip()
-
-		res = br.Queue(request1)
-		assert.NotNil(t, res)
+		br.Queue(request1)
+		roundTripErr = br.roundTrip()
+		nextQueryErr = br.beforeQueue(false)
 
+		return roundTripErr
+	})
+	b.Add(func(ctx context.Context) error {
+		a += 1
 		return nil
 	})
 
 	err := br.run(ctx, b)
 	assert.EqualError(t, err, "batchSender.sendBatch: some error")
-	assert.Equal(t, 1, a)
+	assert.EqualError(t, roundTripErr, "batchSender.sendBatch: some error")
+	assert.EqualError(t, nextQueryErr, "batchSender.sendBatch: some error")
+	// the second callback started in the first round
+	assert.Equal(t, 2, a)
 }
 
 func TestBatchRunner_CloseBatchResultsErr(t *testing.T) {
@@ -259,7 +248,7 @@ func TestBatchRunner_CloseBatchResultsErr(t *testing.T) {
 		return errors.New("some error")
 	}, nil)
 
-	br := newBatchRunner(batchSenderMock)
+	br := newBatchRunner(batchSenderMock, 0)
 
 	a := 0
 
@@ -267,18 +256,355 @@ func TestBatchRunner_CloseBatchResultsErr(t *testing.T) {
 	b.Add(func(ctx context.Context) error {
 		a += 1
 
-		res := br.Queue(request1)
-		assert.Nil(t, res)
-
-		br.roundTrip()
+		br.Queue(request1)
+		require.NoError(t, br.roundTrip())
 
-		res = br.Queue(request1)
+		res := br.Result()
 		assert.NotNil(t, res)
 
-		return nil
+		// the next round isn't sent after the error, the callback is released with the error
+		br.Queue(request1)
+		return br.roundTrip()
 	})
 
 	err := br.run(ctx, b)
 	assert.EqualError(t, err, "close batch results: some error")
 	assert.Equal(t, 1, a)
 }
+
+func TestBatchRunner_MaxConcurrentCallbacks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	batchSenderMock := NewMockBatchRequestsSender(ctrl)
+
+	result1 := struct{ name string }{name: "result 1"}
+	result2 := struct{ name string }{name: "result 2"}
+	result3 := struct{ name string }{name: "result 3"}
+
+	requests := make([]Request, 5)
+	for i := range requests {
+		requests[i] = Request{Query: "query", Args: []any{i}}
+	}
+
+	gomock.InOrder(
+		batchSenderMock.EXPECT().SendBatchRequests(gomock.Any(), []Request{
+			requests[0],
+			requests[1],
+		}).Return(result1, func() error {
+			return nil
+		}, nil),
+		batchSenderMock.EXPECT().SendBatchRequests(gomock.Any(), []Request{
+			requests[2],
+			requests[3],
+		}).Return(result2, func() error {
+			return nil
+		}, nil),
+		batchSenderMock.EXPECT().SendBatchRequests(gomock.Any(), []Request{
+			requests[4],
+		}).Return(result3, func() error {
+			return nil
+		}, nil),
+	)
+
+	br := newBatchRunner(batchSenderMock, 2)
+
+	running, maxRunning := 0, 0
+	results := make([]any, len(requests))
+
+	b := &Batch{}
+	for i := range requests {
+		i := i
+		b.Add(func(ctx context.Context) error {
+			running++
+			if running > maxRunning {
+				maxRunning = running
+			}
+
+			br.Queue(requests[i])
+			br.roundTrip()
+
+			results[i] = br.Result()
+			running--
+
+			return nil
+		})
+	}
+
+	err := br.run(ctx, b)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, maxRunning)
+	assert.Equal(t, []any{result1, result1, result2, result2, result3}, results)
+}
+
+func TestBatchRunner_Group(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	batchSenderMock := NewMockBatchRequestsSender(ctrl)
+
+	result1 := struct{ name string }{name: "result 1"}
+	result2 := struct{ name string }{name: "result 2"}
+	result3 := struct{ name string }{name: "result 3"}
+
+	child1 := Request{Query: "child 1"}
+	child1Next := Request{Query: "child 1 next"}
+	child2 := Request{Query: "child 2"}
+	parentNext := Request{Query: "parent next"}
+	other := Request{Query: "other"}
+
+	gomock.InOrder(
+		batchSenderMock.EXPECT().SendBatchRequests(gomock.Any(), []Request{
+			child1,
+			child2,
+			other,
+		}).Return(result1, func() error {
+			return nil
+		}, nil),
+		batchSenderMock.EXPECT().SendBatchRequests(gomock.Any(), []Request{
+			child1Next,
+		}).Return(result2, func() error {
+			return nil
+		}, nil),
+		batchSenderMock.EXPECT().SendBatchRequests(gomock.Any(), []Request{
+			parentNext,
+		}).Return(result3, func() error {
+			return nil
+		}, nil),
+	)
+
+	br := newBatchRunner(batchSenderMock, 0)
+
+	childErr := errors.New("child error")
+
+	b := &Batch{}
+	b.Add(func(ctx context.Context) error {
+		g := &Group{ctx: ctx, br: br}
+		g.Go(func(ctx context.Context) error {
+			br.Queue(child1)
+			br.roundTrip()
+			assert.Equal(t, result1, br.Result())
+
+			br.Queue(child1Next)
+			br.roundTrip()
+			assert.Equal(t, result2, br.Result())
+
+			return childErr
+		})
+		g.Go(func(ctx context.Context) error {
+			br.Queue(child2)
+			br.roundTrip()
+			assert.Equal(t, result1, br.Result())
+
+			return nil
+		})
+
+		err := g.Wait()
+		assert.ErrorIs(t, err, childErr)
+
+		br.Queue(parentNext)
+		br.roundTrip()
+		assert.Equal(t, result3, br.Result())
+
+		return nil
+	})
+	b.Add(func(ctx context.Context) error {
+		br.Queue(other)
+		br.roundTrip()
+		assert.Equal(t, result1, br.Result())
+
+		return nil
+	})
+
+	err := br.run(ctx, b)
+	assert.NoError(t, err)
+}
+
+func TestBatchRunner_AddAfter(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	batchSenderMock := NewMockBatchRequestsSender(ctrl)
+
+	result1 := struct{ name string }{name: "result 1"}
+	result2 := struct{ name string }{name: "result 2"}
+
+	orders := Request{Query: "orders"}
+	items := Request{Query: "items"}
+	users := Request{Query: "users"}
+	usersNext := Request{Query: "users next"}
+
+	gomock.InOrder(
+		batchSenderMock.EXPECT().SendBatchRequests(gomock.Any(), []Request{
+			orders,
+			users,
+		}).Return(result1, func() error {
+			return nil
+		}, nil),
+		batchSenderMock.EXPECT().SendBatchRequests(gomock.Any(), []Request{
+			usersNext,
+			items,
+		}).Return(result2, func() error {
+			return nil
+		}, nil),
+	)
+
+	br := newBatchRunner(batchSenderMock, 0)
+
+	ordersLoaded := false
+
+	b := &Batch{}
+	h := b.Add(func(ctx context.Context) error {
+		br.Queue(orders)
+		br.roundTrip()
+		assert.Equal(t, result1, br.Result())
+		ordersLoaded = true
+
+		return nil
+	})
+	b.AddAfter([]Handle{h}, func(ctx context.Context) error {
+		assert.True(t, ordersLoaded)
+
+		br.Queue(items)
+		br.roundTrip()
+		assert.Equal(t, result2, br.Result())
+
+		return nil
+	})
+	b.Add(func(ctx context.Context) error {
+		br.Queue(users)
+		br.roundTrip()
+		assert.Equal(t, result1, br.Result())
+
+		br.Queue(usersNext)
+		br.roundTrip()
+		assert.Equal(t, result2, br.Result())
+
+		return nil
+	})
+
+	err := br.run(ctx, b)
+	assert.NoError(t, err)
+}
+
+func TestBatchRunner_AddAfterSkipped(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	ctx := context.Background()
+	someErr := errors.New("some error")
+
+	br := newBatchRunner(NewMockBatchRequestsSender(ctrl), 0)
+
+	called := false
+	b := &Batch{}
+	h := b.Add(func(ctx context.Context) error {
+		return someErr
+	})
+	b.AddAfter([]Handle{h}, func(ctx context.Context) error {
+		called = true
+		return nil
+	})
+
+	err := br.run(ctx, b)
+	assert.ErrorIs(t, err, someErr)
+	assert.ErrorIs(t, err, ErrDependencyFailed)
+	assert.False(t, called)
+}
+
+func TestGroup_Sequential(t *testing.T) {
+	ctx := context.Background()
+	someErr := errors.New("some error")
+
+	var calls []int
+
+	g := NewGroup(ctx)
+	g.Go(func(ctx context.Context) error {
+		calls = append(calls, 1)
+		return someErr
+	})
+	g.Go(func(ctx context.Context) error {
+		calls = append(calls, 2)
+		return nil
+	})
+	assert.Empty(t, calls)
+
+	err := g.Wait()
+	assert.ErrorIs(t, err, someErr)
+	assert.Equal(t, []int{1, 2}, calls)
+
+	assert.NoError(t, g.Wait())
+}
+
+func TestGroup_ChildrenBelongToParent(t *testing.T) {
+	ctx := context.Background()
+
+	br := newBatchRunner(nil, 0)
+	ctx = SetBatchConnToContext(ctx, &BatchConn{br: br})
+
+	var children []int
+
+	b := &Batch{}
+	b.Add(func(ctx context.Context) error {
+		return nil
+	})
+	b.Add(func(ctx context.Context) error {
+		g := NewGroup(ctx)
+		for j := 0; j < 2; j++ {
+			g.Go(func(ctx context.Context) error {
+				children = append(children, br.currentItem.i)
+				return nil
+			})
+		}
+		return g.Wait()
+	})
+
+	err := br.run(ctx, b)
+	require.NoError(t, err)
+	// children have the index of the parent callback, e.g. in Plan
+	assert.Equal(t, []int{1, 1}, children)
+}
+
+type benchBatchSender struct{}
+
+func (benchBatchSender) SendBatchRequests(context.Context, []Request) (res any, closeFn func() error, err error) {
+	return struct{}{}, func() error { return nil }, nil
+}
+
+func benchmarkBatchRunner(b *testing.B, callbacksCount, maxConcurrentCallbacks int) {
+	ctx := context.Background()
+
+	for i := 0; i < b.N; i++ {
+		br := newBatchRunner(benchBatchSender{}, maxConcurrentCallbacks)
+
+		batch := &Batch{}
+		for j := 0; j < callbacksCount; j++ {
+			batch.Add(func(ctx context.Context) error {
+				br.Queue(Request{Query: "first"})
+				br.roundTrip()
+				_ = br.Result()
+
+				br.Queue(Request{Query: "second"})
+				br.roundTrip()
+				_ = br.Result()
+
+				return nil
+			})
+		}
+
+		if err := br.run(ctx, batch); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkBatchRunner_10000(b *testing.B) {
+	b.ReportAllocs()
+	benchmarkBatchRunner(b, 10000, 0)
+}
+
+func BenchmarkBatchRunner_10000_MaxConcurrent100(b *testing.B) {
+	b.ReportAllocs()
+	benchmarkBatchRunner(b, 10000, 100)
+}
@@ -3,6 +3,7 @@ package dbbatch
 import (
 	"context"
 	"errors"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -46,3 +47,120 @@ func TestBatch(t *testing.T) {
 	assert.Error(t, err)
 	assert.Equal(t, 12200, a)
 }
+
+func TestBatch_prepend(t *testing.T) {
+	ctx := context.Background()
+
+	var calls []string
+
+	b := &Batch{}
+	b.Add(func(ctx context.Context) error {
+		calls = append(calls, "first")
+		return nil
+	})
+
+	pb := b.prepend(func(ctx context.Context) error {
+		calls = append(calls, "prepended")
+		return nil
+	})
+	assert.Len(t, b.Callbacks(), 1)
+	assert.Len(t, pb.Callbacks(), 2)
+
+	err := pb.RunSequential(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"prepended", "first"}, calls)
+}
+
+func TestBatch_AddAfter(t *testing.T) {
+	ctx := context.Background()
+	someErr := errors.New("some error")
+
+	t.Run("order", func(t *testing.T) {
+		var calls []string
+
+		b := &Batch{}
+		first := b.Add(func(ctx context.Context) error {
+			calls = append(calls, "first")
+			return nil
+		})
+		b.AddAfter([]Handle{first}, func(ctx context.Context) error {
+			calls = append(calls, "after first")
+			return nil
+		})
+		b.Add(func(ctx context.Context) error {
+			calls = append(calls, "second")
+			return nil
+		})
+
+		err := b.RunSequential(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"first", "second", "after first"}, calls)
+	})
+
+	t.Run("skip dependents of failed callback", func(t *testing.T) {
+		var calls []string
+
+		b := &Batch{}
+		failed := b.Add(func(ctx context.Context) error {
+			calls = append(calls, "failed")
+			return someErr
+		})
+		ok := b.Add(func(ctx context.Context) error {
+			calls = append(calls, "ok")
+			return nil
+		})
+		skipped := b.AddAfter([]Handle{ok, failed}, func(ctx context.Context) error {
+			calls = append(calls, "skipped")
+			return nil
+		})
+		b.AddAfter([]Handle{skipped}, func(ctx context.Context) error {
+			calls = append(calls, "skipped transitively")
+			return nil
+		})
+		b.AddAfter([]Handle{ok}, func(ctx context.Context) error {
+			calls = append(calls, "after ok")
+			return nil
+		})
+
+		err := b.RunSequential(ctx)
+		assert.ErrorIs(t, err, someErr)
+		assert.ErrorIs(t, err, ErrDependencyFailed)
+		assert.Equal(t, []string{"failed", "ok", "after ok"}, calls)
+		assert.Equal(t, 2, strings.Count(err.Error(), "callback is skipped: dependency of the callback failed: some error"))
+	})
+
+	t.Run("foreign handle", func(t *testing.T) {
+		other := &Batch{}
+		h := other.Add(func(ctx context.Context) error { return nil })
+
+		b := &Batch{}
+		b.AddAfter([]Handle{h}, func(ctx context.Context) error { return nil })
+
+		err := b.RunSequential(ctx)
+		assert.EqualError(t, err, "dependency of callback 0 is not a callback of the batch")
+	})
+
+	t.Run("prepend", func(t *testing.T) {
+		var calls []string
+
+		b := &Batch{}
+		first := b.Add(func(ctx context.Context) error {
+			calls = append(calls, "first")
+			return nil
+		})
+		b.AddAfter([]Handle{first}, func(ctx context.Context) error {
+			calls = append(calls, "after first")
+			return nil
+		})
+
+		pb := b.prepend(func(ctx context.Context) error {
+			calls = append(calls, "prepended")
+			return nil
+		})
+		assert.Equal(t, [][]int{nil, nil, {1}}, pb.deps)
+
+		err := pb.RunSequential(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"prepended", "first", "after first"}, calls)
+	})
+}
@@ -3,10 +3,14 @@ package dbbatch
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
 
 	"github.com/jmoiron/sqlx"
 )
 
+const batchSavepointName = "dbbatch_batch"
+
 type BatchTx struct {
 	bc   *BatchConn
 	tx   *sqlx.Tx
@@ -29,6 +33,53 @@ func (btx *BatchTx) SendBatch(ctx context.Context, b *Batch) error {
 	return btx.bc.SendBatch(ctx, b)
 }
 
+// SendBatchAtomic sends batch in the transaction wrapped with one savepoint: all changes of the batch are applied
+// or none of them.
+// SAVEPOINT is queued first in the pipeline of the first round, so it doesn't cost an extra round trip.
+// RELEASE SAVEPOINT is queued in the last round if callbacks mark their last queries with LastQuery,
+// otherwise it's sent after the last round.
+// If any callback fails, the transaction is rolled back to the savepoint and stays usable,
+// all changes made by the batch callbacks are discarded.
+// Errors of statement preparation (e.g. syntax error) may happen before the pipeline is executed,
+// the savepoint doesn't exist then and the transaction can't be recovered.
+//
+// Savepoint per callback is not possible: the statements of callbacks are interleaved in the pipelines,
+// postgres savepoints are a stack (releasing or rolling back to one of them destroys all later ones),
+// and after an error postgres skips the rest of the pipeline until Sync.
+func (btx *BatchTx) SendBatchAtomic(ctx context.Context, b *Batch) error {
+	if btx.done {
+		return sql.ErrTxDone
+	}
+	if b == nil {
+		return errors.New("batch must be not nil")
+	}
+
+	released := false
+	sb := b.prepend(func(ctx context.Context) error {
+		_, err := btx.bc.ExecContext(LastQuery(ctx), "savepoint "+batchSavepointName)
+		return err
+	}).withFinal(func(ctx context.Context) error {
+		_, err := btx.bc.ExecContext(ctx, "release savepoint "+batchSavepointName)
+		if err != nil {
+			return fmt.Errorf("release savepoint: %w", err)
+		}
+		released = true
+		return nil
+	})
+
+	err := btx.bc.SendBatch(ctx, sb)
+	if err == nil || released {
+		return err
+	}
+
+	_, rollbackErr := btx.bc.ExecContext(ContextWithoutCancel(ctx), "rollback to savepoint "+batchSavepointName)
+	if rollbackErr != nil {
+		return errors.Join(err, fmt.Errorf("rollback to savepoint: %w", rollbackErr))
+	}
+
+	return err
+}
+
 // Commit commits the transaction and closes the connection.
 func (btx *BatchTx) Commit() error {
 	if btx.done {
@@ -173,6 +224,37 @@ func (btx *BatchTx) NamedExec(query string, arg any) (sql.Result, error) {
 	return btx.bc.NamedExec(query, arg)
 }
 
+// DriverName returns the driver name of the db
+func (btx *BatchTx) DriverName() string {
+	return btx.bc.DriverName()
+}
+
+// Rebind transforms a query from QUESTION to the bindvar type of the driver
+func (btx *BatchTx) Rebind(query string) string {
+	return btx.bc.Rebind(query)
+}
+
+// BindNamed binds a query with named args using the bindvar type of the driver
+func (btx *BatchTx) BindNamed(query string, arg any) (string, []any, error) {
+	return btx.bc.BindNamed(query, arg)
+}
+
+// InSelectContext expands slice args of `IN (?)` query by sqlx.In, rebinds and selects it in the transaction
+func (btx *BatchTx) InSelectContext(ctx context.Context, dest any, query string, args ...any) error {
+	if btx.done {
+		return sql.ErrTxDone
+	}
+	return btx.bc.InSelectContext(ctx, dest, query, args...)
+}
+
+// InGetContext expands slice args of `IN (?)` query by sqlx.In, rebinds and gets it in the transaction
+func (btx *BatchTx) InGetContext(ctx context.Context, dest any, query string, args ...any) error {
+	if btx.done {
+		return sql.ErrTxDone
+	}
+	return btx.bc.InGetContext(ctx, dest, query, args...)
+}
+
 func (btx *BatchTx) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
 	if btx.done {
 		return nil, sql.ErrTxDone
@@ -181,7 +263,7 @@ func (btx *BatchTx) PrepareContext(ctx context.Context, query string) (*sql.Stmt
 		return nil, ErrStmtNotSupported
 	}
 
-	return btx.tx.PrepareContext(ctx, query)
+	return btx.tx.PrepareContext(btx.bc.maybeWithoutCancel(ctx), query)
 }
 
 func (btx *BatchTx) PreparexContext(ctx context.Context, query string) (*sqlx.Stmt, error) {
@@ -192,5 +274,5 @@ func (btx *BatchTx) PreparexContext(ctx context.Context, query string) (*sqlx.St
 		return nil, ErrStmtNotSupported
 	}
 
-	return btx.tx.PreparexContext(ctx, query)
+	return btx.tx.PreparexContext(btx.bc.maybeWithoutCancel(ctx), query)
 }
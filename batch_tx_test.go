@@ -91,6 +91,11 @@ func TestBatchTx_DoneState(t *testing.T) {
 		assert.ErrorIs(t, err, sql.ErrTxDone)
 	})
 
+	t.Run("SendBatchAtomic", func(t *testing.T) {
+		err := btx.SendBatchAtomic(ctx, &Batch{})
+		assert.ErrorIs(t, err, sql.ErrTxDone)
+	})
+
 	t.Run("QueryContext", func(t *testing.T) {
 		rows, err := btx.QueryContext(ctx, "")
 		if rows != nil {
@@ -0,0 +1,222 @@
+package dbbatch
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// detachRows reads rows of the batched query into memory and closes them.
+// *sql.Rows of the connection hold it until they are closed, so buffered rows escaping the batch would block
+// BatchConn.Close. The returned rows are read from memory through the db without database and don't hold the connection
+func detachRows(rows *sql.Rows) (*memRows, error) {
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("rows.Columns: %w", err)
+	}
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, fmt.Errorf("rows.ColumnTypes: %w", err)
+	}
+
+	mr := &memRows{
+		columns: columns,
+		types:   types,
+	}
+	dest := make([]any, len(columns))
+	for rows.Next() {
+		row := make([]any, len(columns))
+		for i := range row {
+			dest[i] = &row[i]
+		}
+		// scan into *any keeps the value of the driver, byte slices are copied
+		if err = rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("rows.Scan: %w", err)
+		}
+		mr.values = append(mr.values, row)
+	}
+	// the error of rows is returned by the detached rows after the read rows, like by the original ones
+	mr.err = rows.Err()
+
+	return mr, rows.Close()
+}
+
+func (bc *BatchConn) queryDetached(ctx context.Context, query string, args []any) (*memRows, error) {
+	rows, err := bc.ext.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return detachRows(rows)
+}
+
+// detachedDB returns the db without database, its queries return memRows passed as the only argument.
+// Must be closed by the caller, rows stay readable after that
+func (bc *BatchConn) detachedDB() *sqlx.DB {
+	db := sqlx.NewDb(sql.OpenDB(memConnector{}), bc.DriverName())
+	db.Mapper = bc.db.DB.Mapper
+	return db
+}
+
+func (bc *BatchConn) queryBuffered(ctx context.Context, query string, args []any) (*sql.Rows, error) {
+	mr, err := bc.queryDetached(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	db := bc.detachedDB()
+	defer db.Close()
+
+	return db.QueryContext(context.Background(), "", mr)
+}
+
+func (bc *BatchConn) queryxBuffered(ctx context.Context, query string, args []any) (*sqlx.Rows, error) {
+	mr, err := bc.queryDetached(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	db := bc.detachedDB()
+	defer db.Close()
+
+	return db.QueryxContext(context.Background(), "", mr)
+}
+
+func (bc *BatchConn) queryRowBuffered(ctx context.Context, query string, args []any) *sql.Row {
+	mr, err := bc.queryDetached(ctx, query, args)
+	if err != nil {
+		return errorRow(err)
+	}
+
+	db := bc.detachedDB()
+	defer db.Close()
+
+	return db.QueryRowContext(context.Background(), "", mr)
+}
+
+func (bc *BatchConn) queryRowxBuffered(ctx context.Context, query string, args []any) *sqlx.Row {
+	mr, err := bc.queryDetached(ctx, query, args)
+	if err != nil {
+		return errorRowx(err)
+	}
+
+	db := bc.detachedDB()
+	defer db.Close()
+
+	return db.QueryRowxContext(context.Background(), "", mr)
+}
+
+// memRows are rows read into memory by detachRows
+type memRows struct {
+	columns []string
+	types   []*sql.ColumnType
+	values  [][]any
+	err     error
+	next    int
+}
+
+var (
+	_ driver.Rows                           = &memRows{}
+	_ driver.RowsColumnTypeDatabaseTypeName = &memRows{}
+	_ driver.RowsColumnTypeScanType         = &memRows{}
+	_ driver.RowsColumnTypeNullable         = &memRows{}
+	_ driver.RowsColumnTypeLength           = &memRows{}
+	_ driver.RowsColumnTypePrecisionScale   = &memRows{}
+)
+
+func (mr *memRows) Columns() []string {
+	return mr.columns
+}
+
+func (mr *memRows) Close() error {
+	return nil
+}
+
+func (mr *memRows) Next(dest []driver.Value) error {
+	if mr.next >= len(mr.values) {
+		if mr.err != nil {
+			return mr.err
+		}
+		return io.EOF
+	}
+	for i, v := range mr.values[mr.next] {
+		dest[i] = v
+	}
+	mr.next++
+	return nil
+}
+
+func (mr *memRows) ColumnTypeDatabaseTypeName(index int) string {
+	return mr.types[index].DatabaseTypeName()
+}
+
+func (mr *memRows) ColumnTypeScanType(index int) reflect.Type {
+	return mr.types[index].ScanType()
+}
+
+func (mr *memRows) ColumnTypeNullable(index int) (nullable, ok bool) {
+	return mr.types[index].Nullable()
+}
+
+func (mr *memRows) ColumnTypeLength(index int) (length int64, ok bool) {
+	return mr.types[index].Length()
+}
+
+func (mr *memRows) ColumnTypePrecisionScale(index int) (precision, scale int64, ok bool) {
+	return mr.types[index].DecimalSize()
+}
+
+// memConnector opens connections of the db without database for memRows
+type memConnector struct{}
+
+func (memConnector) Connect(context.Context) (driver.Conn, error) {
+	return memConn{}, nil
+}
+
+func (memConnector) Driver() driver.Driver {
+	return memDriver{}
+}
+
+type memDriver struct{}
+
+func (memDriver) Open(string) (driver.Conn, error) {
+	return memConn{}, nil
+}
+
+// memConn returns memRows passed as the only argument of the query
+type memConn struct{}
+
+func (memConn) QueryContext(_ context.Context, _ string, args []driver.NamedValue) (driver.Rows, error) {
+	if len(args) != 1 {
+		return nil, errors.New("memory rows expected")
+	}
+	mr, ok := args[0].Value.(*memRows)
+	if !ok {
+		return nil, errors.New("memory rows expected")
+	}
+	return mr, nil
+}
+
+// CheckNamedValue passes memRows to QueryContext as is
+func (memConn) CheckNamedValue(*driver.NamedValue) error {
+	return nil
+}
+
+func (memConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements are not supported by memory rows")
+}
+
+func (memConn) Close() error {
+	return nil
+}
+
+func (memConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions are not supported by memory rows")
+}
@@ -0,0 +1,227 @@
+// Package analyzer is the go/analysis analyzer of dbbatch misuse in batch callbacks
+package analyzer
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/inspector"
+)
+
+const dbbatchPath = "github.com/inna-maikut/dbbatch"
+
+var Analyzer = &analysis.Analyzer{
+	Name: "dbbatchvet",
+	Doc: "reports misuse of dbbatch in batch callbacks: context-less methods of BatchDB, outer ctx, " +
+		"transactions and prepared statements, *sql.Rows escaping the callback",
+	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Run:      run,
+}
+
+// callbackMethods are methods taking the callback as the last argument
+var callbackMethods = map[string]map[string]bool{
+	"Batch": {"Add": true, "AddAfter": true},
+	"Group": {"Go": true},
+}
+
+// contextlessMethods send the query with context.Background(), so the query bypasses the batch
+var contextlessMethods = map[string]bool{
+	"Query": true, "Exec": true, "QueryRow": true, "Queryx": true, "QueryRowx": true, "MustExec": true,
+	"Get": true, "Select": true, "NamedQuery": true, "NamedExec": true,
+}
+
+// unsupportedMethods fail in batch with ErrTxNotSupported or ErrStmtNotSupported
+var unsupportedMethods = map[string]string{
+	"BeginTx":         "ErrTxNotSupported",
+	"BeginTxx":        "ErrTxNotSupported",
+	"PrepareContext":  "ErrStmtNotSupported",
+	"PreparexContext": "ErrStmtNotSupported",
+}
+
+func run(pass *analysis.Pass) (any, error) {
+	insp := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+
+	insp.Preorder([]ast.Node{(*ast.CallExpr)(nil)}, func(n ast.Node) {
+		lit := callbackOf(pass, n.(*ast.CallExpr))
+		if lit == nil {
+			return
+		}
+		checkCallback(pass, lit)
+	})
+
+	return nil, nil
+}
+
+// callbackOf returns the func literal passed as a callback of the batch
+func callbackOf(pass *analysis.Pass, call *ast.CallExpr) *ast.FuncLit {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || len(call.Args) == 0 {
+		return nil
+	}
+	typeName := dbbatchType(pass.TypesInfo.TypeOf(sel.X))
+	if !callbackMethods[typeName][sel.Sel.Name] {
+		return nil
+	}
+
+	lit, _ := call.Args[len(call.Args)-1].(*ast.FuncLit)
+	return lit
+}
+
+// dbbatchType returns the name of the dbbatch type or its pointer, empty for other types
+func dbbatchType(t types.Type) string {
+	if t == nil {
+		return ""
+	}
+	if ptr, ok := t.(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+	named, ok := t.(*types.Named)
+	if !ok || named.Obj().Pkg() == nil || named.Obj().Pkg().Path() != dbbatchPath {
+		return ""
+	}
+	return named.Obj().Name()
+}
+
+func checkCallback(pass *analysis.Pass, lit *ast.FuncLit) {
+	var ctxParam types.Object
+	if params := lit.Type.Params.List; len(params) > 0 && len(params[0].Names) > 0 {
+		ctxParam = pass.TypesInfo.Defs[params[0].Names[0]]
+	}
+
+	ast.Inspect(lit.Body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.CallExpr:
+			if callbackOf(pass, n) != nil {
+				// nested callback of Group.Go is checked with its own ctx
+				for _, arg := range n.Args[:len(n.Args)-1] {
+					ast.Inspect(arg, func(n ast.Node) bool {
+						checkOuterCtx(pass, lit, ctxParam, n)
+						return true
+					})
+				}
+				return false
+			}
+			checkCall(pass, n)
+		case *ast.AssignStmt:
+			checkRowsEscape(pass, lit, n)
+		}
+		checkOuterCtx(pass, lit, ctxParam, n)
+		return true
+	})
+}
+
+func checkCall(pass *analysis.Pass, call *ast.CallExpr) {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return
+	}
+	method := sel.Sel.Name
+
+	if fn, ok := pass.TypesInfo.Uses[sel.Sel].(*types.Func); ok && fn.Pkg() != nil && fn.Pkg().Path() == "context" &&
+		(method == "Background" || method == "TODO") {
+		pass.Reportf(call.Pos(), "context.%s() in batch callback, use the callback's ctx parameter so queries go to the batch",
+			method)
+		return
+	}
+
+	switch dbbatchType(pass.TypesInfo.TypeOf(sel.X)) {
+	case "BatchDB", "SQLDB":
+		if contextlessMethods[method] {
+			pass.Reportf(call.Pos(), "%s without context in batch callback bypasses the batch, use %sContext(ctx, ...)",
+				method, method)
+			return
+		}
+		fallthrough
+	case "BatchConn", "BatchTx", "SQLConn", "SQLTx":
+		if errName, ok := unsupportedMethods[method]; ok {
+			pass.Reportf(call.Pos(), "%s in batch callback fails with %s", method, errName)
+		}
+	}
+}
+
+// checkOuterCtx reports context.Context declared outside the callback instead of the callback's ctx
+func checkOuterCtx(pass *analysis.Pass, lit *ast.FuncLit, ctxParam types.Object, n ast.Node) {
+	ident, ok := n.(*ast.Ident)
+	if !ok {
+		return
+	}
+	obj, ok := pass.TypesInfo.Uses[ident].(*types.Var)
+	if !ok || obj == ctxParam || !isContext(obj.Type()) || obj.IsField() {
+		return
+	}
+	if within(lit, obj.Pos()) || obj.Pkg() != pass.Pkg {
+		return
+	}
+
+	pass.Reportf(ident.Pos(), "outer %s in batch callback, use the callback's ctx parameter so queries go to the batch",
+		ident.Name)
+}
+
+// checkRowsEscape reports rows assigned to a variable declared outside the callback
+func checkRowsEscape(pass *analysis.Pass, lit *ast.FuncLit, assign *ast.AssignStmt) {
+	for _, lhs := range assign.Lhs {
+		if !isRows(pass.TypesInfo.TypeOf(lhs)) {
+			continue
+		}
+		root := rootIdent(lhs)
+		if root == nil {
+			continue
+		}
+		obj := pass.TypesInfo.ObjectOf(root)
+		if obj == nil || within(lit, obj.Pos()) {
+			continue
+		}
+
+		pass.Reportf(lhs.Pos(), "rows escape the batch callback, they are closed after the batch round, "+
+			"scan them in the callback or use WithBufferedRows")
+	}
+}
+
+func isContext(t types.Type) bool {
+	named, ok := t.(*types.Named)
+	return ok && named.Obj().Pkg() != nil && named.Obj().Pkg().Path() == "context" && named.Obj().Name() == "Context"
+}
+
+// isRows reports whether t is *sql.Rows or *sqlx.Rows
+func isRows(t types.Type) bool {
+	ptr, ok := t.(*types.Pointer)
+	if !ok {
+		return false
+	}
+	named, ok := ptr.Elem().(*types.Named)
+	if !ok || named.Obj().Pkg() == nil || named.Obj().Name() != "Rows" {
+		return false
+	}
+	path := named.Obj().Pkg().Path()
+	return path == "database/sql" || path == "github.com/jmoiron/sqlx"
+}
+
+// rootIdent returns the variable of the expression like v, v.field, v[i], *v
+func rootIdent(expr ast.Expr) *ast.Ident {
+	for {
+		switch e := expr.(type) {
+		case *ast.Ident:
+			if e.Name == "_" {
+				return nil
+			}
+			return e
+		case *ast.SelectorExpr:
+			expr = e.X
+		case *ast.IndexExpr:
+			expr = e.X
+		case *ast.StarExpr:
+			expr = e.X
+		case *ast.ParenExpr:
+			expr = e.X
+		default:
+			return nil
+		}
+	}
+}
+
+func within(n ast.Node, pos token.Pos) bool {
+	return n.Pos() <= pos && pos < n.End()
+}
@@ -0,0 +1,114 @@
+package a
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/inna-maikut/dbbatch"
+	"github.com/jmoiron/sqlx"
+)
+
+func contextless(db *dbbatch.BatchDB, sdb *dbbatch.SQLDB) {
+	b := &dbbatch.Batch{}
+	b.Add(func(ctx context.Context) error {
+		_, err := db.Exec("update items set name = $1", "x") // want `Exec without context in batch callback bypasses the batch, use ExecContext\(ctx, \.\.\.\)`
+		return err
+	})
+	b.Add(func(ctx context.Context) error {
+		var name string
+		return db.Get(&name, "select name from items") // want `Get without context in batch callback`
+	})
+	b.AddAfter(nil, func(ctx context.Context) error {
+		var names []string
+		return db.Select(&names, "select name from items") // want `Select without context in batch callback`
+	})
+	b.Add(func(ctx context.Context) error {
+		_, err := sdb.Exec("delete from items") // want `Exec without context in batch callback`
+		return err
+	})
+	b.Add(func(ctx context.Context) error {
+		_, err := db.ExecContext(ctx, "delete from items")
+		return err
+	})
+
+	// outside of the callback queries are not batched anyway
+	_, _ = db.Exec("delete from items")
+}
+
+func outerCtx(ctx context.Context, db *dbbatch.BatchDB) {
+	b := &dbbatch.Batch{}
+	b.Add(func(_ context.Context) error {
+		_, err := db.ExecContext(ctx, "delete from items") // want `outer ctx in batch callback, use the callback's ctx parameter`
+		return err
+	})
+	b.Add(func(context.Context) error {
+		_, err := db.ExecContext(context.Background(), "delete from items") // want `context.Background\(\) in batch callback`
+		return err
+	})
+	b.Add(func(cbCtx context.Context) error {
+		queryCtx, cancel := context.WithCancel(cbCtx)
+		defer cancel()
+		_, err := db.ExecContext(queryCtx, "delete from items")
+		return err
+	})
+}
+
+func group(db *dbbatch.BatchDB, g *dbbatch.Group) {
+	b := &dbbatch.Batch{}
+	b.Add(func(ctx context.Context) error {
+		g.Go(func(ctx context.Context) error {
+			_, err := db.ExecContext(ctx, "delete from items")
+			return err
+		})
+		g.Go(func(gctx context.Context) error {
+			_, err := db.ExecContext(ctx, "delete from items") // want `outer ctx in batch callback`
+			return err
+		})
+		return nil
+	})
+}
+
+func unsupported(db *dbbatch.BatchDB, tx *dbbatch.BatchTx) {
+	b := &dbbatch.Batch{}
+	b.Add(func(ctx context.Context) error {
+		_, err := db.BeginTx(ctx, nil) // want `BeginTx in batch callback fails with ErrTxNotSupported`
+		return err
+	})
+	b.Add(func(ctx context.Context) error {
+		_, err := db.PrepareContext(ctx, "select 1") // want `PrepareContext in batch callback fails with ErrStmtNotSupported`
+		return err
+	})
+	b.Add(func(ctx context.Context) error {
+		_, err := tx.PreparexContext(ctx, "select 1") // want `PreparexContext in batch callback fails with ErrStmtNotSupported`
+		return err
+	})
+}
+
+type result struct {
+	rows *sqlx.Rows
+}
+
+func rowsEscape(db *dbbatch.BatchDB) {
+	var rows *sql.Rows
+	var res result
+	b := &dbbatch.Batch{}
+	b.Add(func(ctx context.Context) error {
+		var err error
+		rows, err = db.QueryContext(ctx, "select name from items") // want `rows escape the batch callback`
+		return err
+	})
+	b.Add(func(ctx context.Context) error {
+		var err error
+		res.rows, err = db.QueryxContext(ctx, "select name from items") // want `rows escape the batch callback`
+		return err
+	})
+	b.Add(func(ctx context.Context) error {
+		rows, err := db.QueryContext(ctx, "select name from items")
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		return nil
+	})
+	_ = rows
+}
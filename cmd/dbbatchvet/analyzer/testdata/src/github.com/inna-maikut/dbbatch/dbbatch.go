@@ -0,0 +1,55 @@
+package dbbatch
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type CallbackFn = func(ctx context.Context) error
+
+type Batch struct{}
+
+type Handle struct{}
+
+func (b *Batch) Add(cb CallbackFn) Handle                     { return Handle{} }
+func (b *Batch) AddAfter(deps []Handle, cb CallbackFn) Handle { return Handle{} }
+
+type Group struct{}
+
+func (g *Group) Go(fn CallbackFn) {}
+
+type BatchDB struct{}
+
+func (bdb *BatchDB) Exec(query string, args ...any) (sql.Result, error) { return nil, nil }
+func (bdb *BatchDB) Get(dest any, query string, args ...any) error      { return nil }
+func (bdb *BatchDB) Select(dest any, query string, args ...any) error   { return nil }
+func (bdb *BatchDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return nil, nil
+}
+func (bdb *BatchDB) GetContext(ctx context.Context, dest any, query string, args ...any) error {
+	return nil
+}
+func (bdb *BatchDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return nil, nil
+}
+func (bdb *BatchDB) QueryxContext(ctx context.Context, query string, args ...any) (*sqlx.Rows, error) {
+	return nil, nil
+}
+func (bdb *BatchDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	return nil, nil
+}
+func (bdb *BatchDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return nil, nil
+}
+
+type BatchTx struct{}
+
+func (btx *BatchTx) PreparexContext(ctx context.Context, query string) (*sqlx.Stmt, error) {
+	return nil, nil
+}
+
+type SQLDB struct{}
+
+func (sdb *SQLDB) Exec(query string, args ...any) (sql.Result, error) { return nil, nil }
@@ -0,0 +1,5 @@
+package sqlx
+
+type Rows struct{}
+
+type Stmt struct{}
@@ -0,0 +1,15 @@
+// Command dbbatchvet reports misuse of dbbatch in batch callbacks.
+//
+//	go install github.com/inna-maikut/dbbatch/cmd/dbbatchvet@latest
+//	dbbatchvet ./...
+package main
+
+import (
+	"golang.org/x/tools/go/analysis/singlechecker"
+
+	"github.com/inna-maikut/dbbatch/cmd/dbbatchvet/analyzer"
+)
+
+func main() {
+	singlechecker.Main(analyzer.Analyzer)
+}
@@ -0,0 +1,28 @@
+// Package plugin registers dbbatchvet as a golangci-lint module plugin
+package plugin
+
+import (
+	"github.com/golangci/plugin-module-register/register"
+	"golang.org/x/tools/go/analysis"
+
+	"github.com/inna-maikut/dbbatch/cmd/dbbatchvet/analyzer"
+)
+
+func init() {
+	register.Plugin("dbbatchvet", New)
+}
+
+// New creates the plugin, it has no settings
+func New(any) (register.LinterPlugin, error) {
+	return plugin{}, nil
+}
+
+type plugin struct{}
+
+func (plugin) BuildAnalyzers() ([]*analysis.Analyzer, error) {
+	return []*analysis.Analyzer{analyzer.Analyzer}, nil
+}
+
+func (plugin) GetLoadMode() string {
+	return register.LoadModeTypesInfo
+}
@@ -25,3 +25,20 @@ func BatchConnFromContext(ctx context.Context) *BatchConn {
 func SetBatchConnToContext(ctx context.Context, b *BatchConn) context.Context {
 	return context.WithValue(ctx, contextKeyBatchConn, b)
 }
+
+type contextKeyLastQueryType struct{}
+
+var contextKeyLastQuery = contextKeyLastQueryType{}
+
+// LastQuery marks the query with ctx as the last query of the callback, the callback makes no queries after it.
+// When all running callbacks queued their last queries and no callbacks wait to start, the round is the last one:
+// SendBatchInTx appends COMMIT to it, so a one-round batch costs a single round trip.
+// A query of the callback after its last query fails with ErrBatchFinished
+func LastQuery(ctx context.Context) context.Context {
+	return context.WithValue(ctx, contextKeyLastQuery, true)
+}
+
+func isLastQuery(ctx context.Context) bool {
+	last, _ := ctx.Value(contextKeyLastQuery).(bool)
+	return last
+}
@@ -0,0 +1,143 @@
+package dbbatchtest
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+
+	"github.com/inna-maikut/dbbatch"
+	"github.com/inna-maikut/dbbatch/internal/fakedriver"
+)
+
+var (
+	_ driver.Driver               = &Driver{}
+	_ driver.Conn                 = &Conn{}
+	_ driver.QueryerContext       = &Conn{}
+	_ driver.ExecerContext        = &Conn{}
+	_ driver.ConnBeginTx          = &Conn{}
+	_ driver.NamedValueChecker    = &Conn{}
+	_ dbbatch.BaseConnProvider    = &Conn{}
+	_ dbbatch.BatchRequestsSender = &Conn{}
+)
+
+// Driver is the fake driver, DSN is the name of Fake
+type Driver struct{}
+
+func (d *Driver) Open(name string) (driver.Conn, error) {
+	fakesMu.Lock()
+	f, ok := fakes[name]
+	fakesMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("dbbatchtest: unknown fake %q, use dbbatchtest.New", name)
+	}
+
+	return &Conn{fake: f}, nil
+}
+
+type Conn struct {
+	fake *Fake
+}
+
+// BaseConn returns the conn itself, it sends batches
+func (c *Conn) BaseConn() any {
+	return c
+}
+
+func (c *Conn) SendBatchRequests(_ context.Context, requests []dbbatch.Request) (res any, closeFn func() error, err error) {
+	rr := c.fake.sendBatch(requests)
+	return rr, rr.closeErr, nil
+}
+
+func (c *Conn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("dbbatchtest: prepared statements are not supported")
+}
+
+func (c *Conn) Close() error {
+	return nil
+}
+
+func (c *Conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *Conn) BeginTx(ctx context.Context, _ driver.TxOptions) (driver.Tx, error) {
+	if dbbatch.BatchConnFromContext(ctx) != nil {
+		return nil, errors.New("transactions are not supported in batch")
+	}
+	return tx{}, nil
+}
+
+func (c *Conn) CheckNamedValue(*driver.NamedValue) error {
+	return nil
+}
+
+// result returns the result of the round for batched query, otherwise matches the query
+func (c *Conn) result(
+	ctx context.Context,
+	kind expectationKind,
+	query string,
+	argsV []driver.NamedValue,
+) (matchResult, error) {
+	if bc := dbbatch.BatchConnFromContext(ctx); bc != nil {
+		rr, ok := bc.BatchRunner().Result().(*roundResult)
+		if !ok {
+			return matchResult{}, fmt.Errorf("dbbatchtest: unknown type of batch result: %+v", bc.BatchRunner().Result())
+		}
+		return rr.nextResult(kind)
+	}
+
+	args := make([]any, 0, len(argsV))
+	for _, v := range argsV {
+		args = append(args, v.Value)
+	}
+	e, err := c.fake.match(kind, query, args)
+
+	return matchResult{query: query, e: e, err: err}, nil
+}
+
+func (c *Conn) ExecContext(ctx context.Context, query string, argsV []driver.NamedValue) (driver.Result, error) {
+	res, err := c.result(ctx, kindExec, query, argsV)
+	if err != nil {
+		return nil, err
+	}
+	if res.err != nil {
+		return nil, res.err
+	}
+	if res.e.kind != kindExec {
+		return nil, fmt.Errorf("dbbatchtest: %s is executed as exec", res.e)
+	}
+	if res.e.err != nil {
+		return nil, res.e.err
+	}
+
+	return driver.RowsAffected(res.e.rowsAffected), nil
+}
+
+func (c *Conn) QueryContext(ctx context.Context, query string, argsV []driver.NamedValue) (driver.Rows, error) {
+	res, err := c.result(ctx, kindQuery, query, argsV)
+	if err != nil {
+		return nil, err
+	}
+	if res.err != nil {
+		return nil, res.err
+	}
+	if res.e.kind != kindQuery {
+		return nil, fmt.Errorf("dbbatchtest: %s is executed as query", res.e)
+	}
+	if res.e.err != nil {
+		return nil, res.e.err
+	}
+
+	return &fakedriver.Rows{Cols: res.e.columns, Types: res.e.types, Values: res.e.rows}, nil
+}
+
+type tx struct{}
+
+func (tx) Commit() error {
+	return nil
+}
+
+func (tx) Rollback() error {
+	return nil
+}
@@ -0,0 +1,312 @@
+// Package dbbatchtest provides the fake batch driver for unit tests of code using dbbatch.
+// Batches run by the real batch runner, round trips happen in memory.
+package dbbatchtest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/inna-maikut/dbbatch"
+	"github.com/inna-maikut/dbbatch/internal/fakedriver"
+)
+
+// DriverName is the name of the registered fake driver
+const DriverName = "dbbatchtest"
+
+var (
+	fakesMu  sync.Mutex
+	fakes    = map[string]*Fake{}
+	fakesSeq atomic.Int64
+)
+
+func init() {
+	dbbatch.RegisterDriver(DriverName, &Driver{}, dbbatch.BindDollar)
+}
+
+// Fake is the fake database with expectations of queries
+type Fake struct {
+	mu           sync.Mutex
+	expectations []*Expectation
+	unexpected   []string
+	rounds       [][]dbbatch.Request
+	db           *sqlx.DB
+}
+
+// New creates Fake. Unmet expectations and unexpected queries are reported in the end of the test
+func New(t testing.TB) *Fake {
+	f := &Fake{}
+
+	name := strconv.FormatInt(fakesSeq.Add(1), 10)
+	fakesMu.Lock()
+	fakes[name] = f
+	fakesMu.Unlock()
+
+	f.db = sqlx.MustOpen(DriverName, name)
+
+	t.Cleanup(func() {
+		f.AssertExpectations(t)
+
+		_ = f.db.Close()
+		fakesMu.Lock()
+		delete(fakes, name)
+		fakesMu.Unlock()
+	})
+
+	return f
+}
+
+// DB returns *sqlx.DB of the fake driver
+func (f *Fake) DB() *sqlx.DB {
+	return f.db
+}
+
+// BatchDB returns dbbatch.BatchDB over the fake driver
+func (f *Fake) BatchDB(opts ...dbbatch.Option) *dbbatch.BatchDB {
+	return dbbatch.New(f.db, opts...)
+}
+
+// ExpectQuery adds expectation of the query matching regexp pattern
+func (f *Fake) ExpectQuery(pattern string) *Expectation {
+	return f.expect(kindQuery, pattern)
+}
+
+// ExpectExec adds expectation of the exec matching regexp pattern
+func (f *Fake) ExpectExec(pattern string) *Expectation {
+	return f.expect(kindExec, pattern)
+}
+
+func (f *Fake) expect(kind expectationKind, pattern string) *Expectation {
+	e := &Expectation{
+		kind:    kind,
+		pattern: regexp.MustCompile(pattern),
+		times:   1,
+	}
+
+	f.mu.Lock()
+	f.expectations = append(f.expectations, e)
+	f.mu.Unlock()
+
+	return e
+}
+
+// Rounds returns requests of the batch round trips
+func (f *Fake) Rounds() [][]dbbatch.Request {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([][]dbbatch.Request(nil), f.rounds...)
+}
+
+// ExpectationsWereMet returns error if there are unmet expectations or unexpected queries
+func (f *Fake) ExpectationsWereMet() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var errs []error
+	for _, e := range f.expectations {
+		if e.called < e.times {
+			errs = append(errs, fmt.Errorf("dbbatchtest: %s is called %d of %d times", e, e.called, e.times))
+		}
+	}
+	for _, q := range f.unexpected {
+		errs = append(errs, fmt.Errorf("dbbatchtest: unexpected %s", q))
+	}
+
+	return errors.Join(errs...)
+}
+
+// AssertExpectations reports unmet expectations and unexpected queries
+func (f *Fake) AssertExpectations(t testing.TB) {
+	t.Helper()
+
+	if err := f.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// match finds the expectation of the query of the kind, transaction control statements are expected implicitly
+func (f *Fake) match(kind expectationKind, query string, args []any) (*Expectation, error) {
+	if isTxControl(query) {
+		return &Expectation{kind: kindExec}, nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var otherKind *Expectation
+	for _, e := range f.expectations {
+		if e.called >= e.times || !e.matches(query, args) {
+			continue
+		}
+		if e.kind != kind {
+			otherKind = e
+			continue
+		}
+		e.called++
+		return e, nil
+	}
+
+	unexpected := fmt.Sprintf("%s %q with args %v", kind, query, args)
+	if otherKind != nil {
+		unexpected += fmt.Sprintf(", it matches %s", otherKind)
+	}
+	f.unexpected = append(f.unexpected, unexpected)
+
+	return nil, fmt.Errorf("dbbatchtest: unexpected %s", unexpected)
+}
+
+// sendBatch records the round. Requests are matched when the driver reads their results,
+// because only then it's known whether the request is a query or an exec
+func (f *Fake) sendBatch(requests []dbbatch.Request) *roundResult {
+	rr := &roundResult{fake: f}
+	rr.Results = append([]dbbatch.Request(nil), requests...)
+
+	f.mu.Lock()
+	f.rounds = append(f.rounds, append([]dbbatch.Request(nil), requests...))
+	f.mu.Unlock()
+
+	return rr
+}
+
+func isTxControl(query string) bool {
+	q := strings.ToLower(strings.TrimSpace(query))
+	for _, prefix := range []string{"begin", "commit", "rollback", "savepoint", "release"} {
+		if strings.HasPrefix(q, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+type expectationKind int
+
+const (
+	kindQuery expectationKind = iota
+	kindExec
+)
+
+func (k expectationKind) String() string {
+	if k == kindExec {
+		return "exec"
+	}
+	return "query"
+}
+
+// Expectation is the expected query and its result
+type Expectation struct {
+	kind         expectationKind
+	pattern      *regexp.Regexp
+	args         []any
+	withArgs     bool
+	argsJSON     []json.RawMessage // args of the recorded request, matched by JSON
+	columns      []string
+	types        []string
+	rows         [][]any
+	rowsAffected int64
+	err          error
+	closeErr     error // error of closing results of the recorded round
+	times        int
+	called       int
+}
+
+// WithArgs sets expected args, any args match by default
+func (e *Expectation) WithArgs(args ...any) *Expectation {
+	e.args = args
+	e.withArgs = true
+	return e
+}
+
+// WillReturnRows sets columns and rows of the query result
+func (e *Expectation) WillReturnRows(columns []string, rows ...[]any) *Expectation {
+	e.columns = columns
+	e.rows = rows
+	return e
+}
+
+// WillReturnResult sets rows affected of the exec result
+func (e *Expectation) WillReturnResult(rowsAffected int64) *Expectation {
+	e.rowsAffected = rowsAffected
+	return e
+}
+
+// WillReturnError sets error of the query
+func (e *Expectation) WillReturnError(err error) *Expectation {
+	e.err = err
+	return e
+}
+
+// Times sets how many times the query is expected, 1 by default
+func (e *Expectation) Times(n int) *Expectation {
+	e.times = n
+	return e
+}
+
+func (e *Expectation) matches(query string, args []any) bool {
+	if !e.pattern.MatchString(query) {
+		return false
+	}
+	if e.argsJSON != nil {
+		return argsJSONEqual(e.argsJSON, recordArgs(args))
+	}
+	if !e.withArgs {
+		return true
+	}
+	if len(args) == 0 && len(e.args) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(e.args, args)
+}
+
+func (e *Expectation) String() string {
+	if e.withArgs {
+		return fmt.Sprintf("%s %q with args %v", e.kind, e.pattern, e.args)
+	}
+	return fmt.Sprintf("%s %q", e.kind, e.pattern)
+}
+
+type matchResult struct {
+	query string
+	e     *Expectation
+	err   error
+}
+
+// roundResult gives results in order of requests like pgx.BatchResults
+type roundResult struct {
+	fakedriver.Round[dbbatch.Request]
+	fake    *Fake
+	matched []*Expectation
+}
+
+// closeErr returns the error of closing results of the round
+func (rr *roundResult) closeErr() error {
+	for _, e := range rr.matched {
+		if e.closeErr != nil {
+			return e.closeErr
+		}
+	}
+	return nil
+}
+
+// nextResult matches the next request of the round as the query of the kind
+func (rr *roundResult) nextResult(kind expectationKind) (matchResult, error) {
+	request, err := rr.Next()
+	if err != nil {
+		return matchResult{}, fmt.Errorf("dbbatchtest: %w", err)
+	}
+
+	e, err := rr.fake.match(kind, request.Query, request.Args)
+	if e != nil {
+		rr.matched = append(rr.matched, e)
+	}
+	return matchResult{query: request.Query, e: e, err: err}, nil
+}
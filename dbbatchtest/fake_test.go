@@ -0,0 +1,450 @@
+package dbbatchtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/inna-maikut/dbbatch"
+)
+
+func TestFake_SendBatch(t *testing.T) {
+	ctx := context.Background()
+	fake := New(t)
+	db := fake.BatchDB()
+
+	wantErr := errors.New("exec error")
+	fake.ExpectQuery(`select name from users where id = \$1`).WithArgs(1).
+		WillReturnRows([]string{"name"}, []any{"alice"})
+	fake.ExpectQuery(`select name from users where id = \$1`).WithArgs(2).
+		WillReturnRows([]string{"name"}, []any{"bob"})
+	fake.ExpectExec(`update users`).WillReturnResult(3)
+	fake.ExpectExec(`delete from users`).WillReturnError(wantErr)
+
+	var names [2]string
+	var affected int64
+	b := &dbbatch.Batch{}
+	for i := range names {
+		i := i
+		b.Add(func(ctx context.Context) error {
+			return db.GetContext(ctx, &names[i], "select name from users where id = $1", i+1)
+		})
+	}
+	b.Add(func(ctx context.Context) error {
+		res, err := db.ExecContext(ctx, "update users set name = $1", "x")
+		if err != nil {
+			return err
+		}
+		affected, err = res.RowsAffected()
+		return err
+	})
+	b.Add(func(ctx context.Context) error {
+		_, err := db.ExecContext(ctx, "delete from users")
+		return err
+	})
+
+	err := db.SendBatch(ctx, b)
+	assert.ErrorIs(t, err, wantErr)
+	assert.Equal(t, [2]string{"alice", "bob"}, names)
+	assert.Equal(t, int64(3), affected)
+
+	rounds := fake.Rounds()
+	require.Len(t, rounds, 1)
+	assert.Len(t, rounds[0], 4)
+}
+
+func TestFake_WithoutBatch(t *testing.T) {
+	ctx := context.Background()
+	fake := New(t)
+	db := fake.BatchDB()
+
+	fake.ExpectQuery(`select count`).WillReturnRows([]string{"count"}, []any{int64(5)})
+
+	var count int64
+	require.NoError(t, db.DB.GetContext(ctx, &count, "select count(*) from users"))
+	assert.Equal(t, int64(5), count)
+	assert.Empty(t, fake.Rounds())
+}
+
+func TestFake_ExpectationsWereMet(t *testing.T) {
+	ctx := context.Background()
+	fake := New(t)
+	db := fake.BatchDB()
+
+	fake.ExpectExec(`update users`).Times(2)
+
+	b := &dbbatch.Batch{}
+	b.Add(func(ctx context.Context) error {
+		_, err := db.ExecContext(ctx, "update users set name = $1", "x")
+		return err
+	})
+	b.Add(func(ctx context.Context) error {
+		_, err := db.ExecContext(ctx, "insert into users (name) values ($1)", "y")
+		return err
+	})
+
+	err := db.SendBatch(ctx, b)
+	assert.EqualError(t, err, `dbbatchtest: unexpected exec "insert into users (name) values ($1)" with args [y]`)
+
+	err = fake.ExpectationsWereMet()
+	assert.EqualError(t, err, `dbbatchtest: exec "update users" is called 1 of 2 times
+dbbatchtest: unexpected exec "insert into users (name) values ($1)" with args [y]`)
+
+	// reset to pass the assertion in cleanup
+	fake.mu.Lock()
+	fake.expectations, fake.unexpected = nil, nil
+	fake.mu.Unlock()
+}
+
+func TestFake_kindMismatch(t *testing.T) {
+	ctx := context.Background()
+	fake := New(t)
+	db := fake.BatchDB()
+
+	fake.ExpectExec(`update users`).WillReturnResult(1)
+	fake.ExpectQuery(`select name from users`).WillReturnRows([]string{"name"}, []any{"alice"})
+
+	b := &dbbatch.Batch{}
+	b.Add(func(ctx context.Context) error {
+		var names []string
+		return db.SelectContext(ctx, &names, "update users set name = $1 returning name", "x")
+	})
+	b.Add(func(ctx context.Context) error {
+		_, err := db.ExecContext(ctx, "select name from users")
+		return err
+	})
+
+	err := db.SendBatch(ctx, b)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(),
+		`dbbatchtest: unexpected query "update users set name = $1 returning name" with args [x], it matches exec "update users"`)
+	assert.Contains(t, err.Error(),
+		`dbbatchtest: unexpected exec "select name from users" with args [], it matches query "select name from users"`)
+
+	// the expectations aren't satisfied by the requests of the other kind
+	_, err = db.ExecContext(ctx, "update users set name = $1", "x")
+	require.NoError(t, err)
+	var name string
+	err = db.GetContext(ctx, &name, "select name from users")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", name)
+
+	// reset to pass the assertion in cleanup
+	fake.mu.Lock()
+	fake.unexpected = nil
+	fake.mu.Unlock()
+}
+
+func TestFake_SendBatchInTx(t *testing.T) {
+	ctx := context.Background()
+	fake := New(t)
+	db := fake.BatchDB()
+
+	fake.ExpectExec(`insert into users`).WillReturnResult(1)
+
+	b := &dbbatch.Batch{}
+	b.Add(func(ctx context.Context) error {
+		_, err := db.ExecContext(ctx, "insert into users (name) values ($1)", "x")
+		return err
+	})
+
+	require.NoError(t, db.SendBatchInTx(ctx, b, nil))
+	require.Equal(t, [][]string{{"begin", "insert into users (name) values ($1)"}, {"commit"}}, roundQueries(fake))
+}
+
+func TestFake_SendBatchInTx_lastQuery(t *testing.T) {
+	ctx := context.Background()
+	fake := New(t)
+	db := fake.BatchDB()
+
+	fake.ExpectExec(`insert into users`).WillReturnResult(1).Times(2)
+
+	var errAfterLast error
+	b := &dbbatch.Batch{}
+	b.Add(func(ctx context.Context) error {
+		_, err := db.ExecContext(dbbatch.LastQuery(ctx), "insert into users (name) values ($1)", "x")
+		return err
+	})
+	b.Add(func(ctx context.Context) error {
+		_, err := db.ExecContext(dbbatch.LastQuery(ctx), "insert into users (name) values ($1)", "y")
+		if err != nil {
+			return err
+		}
+		_, errAfterLast = db.ExecContext(ctx, "insert into users (name) values ($1)", "z")
+		return nil
+	})
+
+	require.NoError(t, db.SendBatchInTx(ctx, b, nil))
+	require.ErrorIs(t, errAfterLast, dbbatch.ErrBatchFinished)
+	require.Equal(t, [][]string{{
+		"begin",
+		"insert into users (name) values ($1)",
+		"insert into users (name) values ($1)",
+		"commit",
+	}}, roundQueries(fake))
+}
+
+func TestFake_SendBatchAtomic(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("released in the last round", func(t *testing.T) {
+		fake := New(t)
+		db := fake.BatchDB()
+
+		fake.ExpectExec(`insert into users`).WillReturnResult(1)
+
+		tx, err := db.BeginBatchTx(ctx, nil)
+		require.NoError(t, err)
+
+		b := &dbbatch.Batch{}
+		b.Add(func(ctx context.Context) error {
+			_, err := tx.ExecContext(dbbatch.LastQuery(ctx), "insert into users (name) values ($1)", "x")
+			return err
+		})
+
+		require.NoError(t, tx.SendBatchAtomic(ctx, b))
+		require.NoError(t, tx.Commit())
+		require.Equal(t, [][]string{{
+			"savepoint dbbatch_batch",
+			"insert into users (name) values ($1)",
+			"release savepoint dbbatch_batch",
+		}}, roundQueries(fake))
+	})
+
+	t.Run("released after the last round", func(t *testing.T) {
+		fake := New(t)
+		db := fake.BatchDB()
+
+		fake.ExpectExec(`insert into users`).WillReturnResult(1)
+
+		tx, err := db.BeginBatchTx(ctx, nil)
+		require.NoError(t, err)
+
+		b := &dbbatch.Batch{}
+		b.Add(func(ctx context.Context) error {
+			_, err := tx.ExecContext(ctx, "insert into users (name) values ($1)", "x")
+			return err
+		})
+
+		require.NoError(t, tx.SendBatchAtomic(ctx, b))
+		require.NoError(t, tx.Commit())
+		require.Equal(t, [][]string{
+			{"savepoint dbbatch_batch", "insert into users (name) values ($1)"},
+			{"release savepoint dbbatch_batch"},
+		}, roundQueries(fake))
+	})
+
+	t.Run("rolled back to savepoint on error", func(t *testing.T) {
+		fake := New(t)
+		var queries []string
+		db := fake.BatchDB(dbbatch.WithHooks(dbbatch.Hooks{
+			Query: func(_ context.Context, query string) {
+				queries = append(queries, query)
+			},
+		}))
+
+		errInsert := errors.New("insert failed")
+		fake.ExpectExec(`insert into users`).WillReturnError(errInsert)
+
+		tx, err := db.BeginBatchTx(ctx, nil)
+		require.NoError(t, err)
+
+		b := &dbbatch.Batch{}
+		b.Add(func(ctx context.Context) error {
+			_, err := tx.ExecContext(ctx, "insert into users (name) values ($1)", "x")
+			return err
+		})
+
+		require.ErrorIs(t, tx.SendBatchAtomic(ctx, b), errInsert)
+		require.NoError(t, tx.Rollback())
+		require.Equal(t, [][]string{{"savepoint dbbatch_batch", "insert into users (name) values ($1)"}}, roundQueries(fake))
+		require.Equal(t, []string{"rollback to savepoint dbbatch_batch"}, queries)
+	})
+}
+
+type sqlStateError string
+
+func (e sqlStateError) Error() string {
+	return "sqlstate " + string(e)
+}
+
+func (e sqlStateError) SQLState() string {
+	return string(e)
+}
+
+func TestFake_RunInBatchTx_releasesConn(t *testing.T) {
+	ctx := context.Background()
+	fake := New(t)
+	db := fake.BatchDB()
+
+	fake.ExpectExec(`insert into users`).WillReturnError(sqlStateError("40001")).Times(2)
+	fake.ExpectExec(`insert into users`).WillReturnResult(1)
+
+	attempts := 0
+	err := db.RunInBatchTx(ctx, nil, func(tx *dbbatch.BatchTx) error {
+		attempts++
+		// every attempt must get a free connection, rolled back attempts return theirs to the pool
+		assert.Equal(t, 1, fake.DB().Stats().InUse)
+
+		b := &dbbatch.Batch{}
+		b.Add(func(ctx context.Context) error {
+			_, err := tx.ExecContext(ctx, "insert into users (name) values ($1)", "x")
+			return err
+		})
+		return tx.SendBatch(ctx, b)
+	}, dbbatch.RetryPolicy{MaxAttempts: 3})
+
+	require.NoError(t, err)
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, 0, fake.DB().Stats().InUse)
+}
+
+func TestFake_SQLDB_RunInBatchTx(t *testing.T) {
+	ctx := context.Background()
+	fake := New(t)
+	sdb := dbbatch.NewSQL(fake.DB().DB)
+
+	fake.ExpectExec(`insert into users`).WillReturnError(sqlStateError("40001"))
+	fake.ExpectExec(`insert into users`).WillReturnResult(1)
+
+	attempts := 0
+	err := sdb.RunInBatchTx(ctx, nil, func(tx *dbbatch.SQLTx) error {
+		attempts++
+
+		b := &dbbatch.Batch{}
+		b.Add(func(ctx context.Context) error {
+			_, err := tx.ExecContext(ctx, "insert into users (name) values ($1)", "x")
+			return err
+		})
+		return tx.SendBatch(ctx, b)
+	}, dbbatch.RetryPolicy{MaxAttempts: 2})
+
+	require.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+	assert.Equal(t, 0, fake.DB().Stats().InUse)
+}
+
+func roundQueries(fake *Fake) [][]string {
+	var rounds [][]string
+	for _, round := range fake.Rounds() {
+		var queries []string
+		for _, request := range round {
+			queries = append(queries, request.Query)
+		}
+		rounds = append(rounds, queries)
+	}
+	return rounds
+}
+
+func TestFake_MultiDB(t *testing.T) {
+	ctx := context.Background()
+	fakeA, fakeB := New(t), New(t)
+	multi := dbbatch.NewMultiDB(map[string]*dbbatch.BatchDB{
+		"a": fakeA.BatchDB(),
+		"b": fakeB.BatchDB(),
+	})
+
+	fakeA.ExpectQuery(`select name from users where id = \$1`).WithArgs(1).
+		WillReturnRows([]string{"name"}, []any{"alice"})
+	fakeA.ExpectExec(`update users`).WillReturnResult(1)
+	fakeB.ExpectQuery(`select name from users where id = \$1`).WithArgs(2).
+		WillReturnRows([]string{"name"}, []any{"bob"})
+	fakeB.ExpectExec(`update users`).WillReturnResult(1)
+
+	var names [2]string
+	b := &dbbatch.Batch{}
+	for i, key := range []string{"a", "b"} {
+		i, key := i, key
+		b.Add(func(ctx context.Context) error {
+			return multi.Shard(key).GetContext(ctx, &names[i], "select name from users where id = $1", i+1)
+		})
+	}
+	// the callback queries both shards in one round
+	b.Add(func(ctx context.Context) error {
+		g := dbbatch.NewGroup(ctx)
+		for _, key := range []string{"a", "b"} {
+			key := key
+			g.Go(func(ctx context.Context) error {
+				_, err := multi.Shard(key).ExecContext(ctx, "update users set name = $1", key)
+				return err
+			})
+		}
+		return g.Wait()
+	})
+
+	err := multi.SendBatch(ctx, b)
+	require.NoError(t, err)
+	assert.Equal(t, [2]string{"alice", "bob"}, names)
+
+	for _, fake := range []*Fake{fakeA, fakeB} {
+		rounds := fake.Rounds()
+		require.Len(t, rounds, 1)
+		assert.Len(t, rounds[0], 2)
+	}
+}
+
+func TestFake_MultiDB_wrongShard(t *testing.T) {
+	ctx := context.Background()
+	fakeA, fakeB := New(t), New(t)
+	dbA, dbB := fakeA.BatchDB(), fakeB.BatchDB()
+
+	b := &dbbatch.Batch{}
+	b.Add(func(ctx context.Context) error {
+		_, err := dbB.ExecContext(ctx, "update users set name = $1", "x")
+		return err
+	})
+
+	err := dbA.SendBatch(ctx, b)
+	assert.ErrorIs(t, err, dbbatch.ErrForeignBatchConn)
+	assert.Empty(t, fakeA.Rounds())
+	assert.Empty(t, fakeB.Rounds())
+}
+
+func TestFake_MultiDB_shardOptions(t *testing.T) {
+	t.Run("limited shard", func(t *testing.T) {
+		ctx := context.Background()
+		fakeA, fakeB := New(t), New(t)
+		multi := dbbatch.NewMultiDB(map[string]*dbbatch.BatchDB{
+			"a": fakeA.BatchDB(dbbatch.WithMaxConcurrentCallbacks(1)),
+			"b": fakeB.BatchDB(),
+		})
+
+		b := &dbbatch.Batch{}
+		for i := 0; i < 3; i++ {
+			fakeB.ExpectExec(`update users`).WillReturnResult(1)
+			b.Add(func(ctx context.Context) error {
+				_, err := multi.Shard("b").ExecContext(ctx, "update users set name = $1", "x")
+				return err
+			})
+		}
+
+		err := multi.SendBatch(ctx, b)
+		require.NoError(t, err)
+		// the limit of the shard holds for the whole batch
+		assert.Len(t, fakeB.Rounds(), 3)
+		assert.Empty(t, fakeA.Rounds())
+	})
+
+	t.Run("strict shard", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		fakeA, fakeB := New(t), New(t)
+		multi := dbbatch.NewMultiDB(map[string]*dbbatch.BatchDB{
+			"a": fakeA.BatchDB(dbbatch.WithStrictBatching()),
+			"b": fakeB.BatchDB(),
+		})
+
+		b := &dbbatch.Batch{}
+		b.Add(func(context.Context) error {
+			_, err := multi.Shard("a").ExecContext(ctx, "update users set name = $1", "x")
+			return err
+		})
+
+		err := multi.SendBatch(ctx, b)
+		assert.ErrorIs(t, err, dbbatch.ErrBypassedBatch)
+		assert.Empty(t, fakeA.Rounds())
+	})
+}
@@ -0,0 +1,479 @@
+package dbbatchtest
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/inna-maikut/dbbatch"
+	"github.com/inna-maikut/dbbatch/internal/fakedriver"
+)
+
+// RecordVersion is the version of the record file format, it's written in the first line of the file
+const RecordVersion = 1
+
+var (
+	_ driver.Connector            = &recordConnector{}
+	_ driver.Conn                 = &recordConn{}
+	_ driver.QueryerContext       = &recordConn{}
+	_ driver.ExecerContext        = &recordConn{}
+	_ driver.ConnBeginTx          = &recordConn{}
+	_ driver.NamedValueChecker    = &recordConn{}
+	_ dbbatch.BatchRequestsSender = &recordConn{}
+)
+
+// recordHeader is the first line of the record file
+type recordHeader struct {
+	Version int `json:"version"`
+}
+
+// RecordedRoundTrip is the line of the record file: requests of the batch round or one query without batch
+type RecordedRoundTrip struct {
+	Batch    bool               `json:"batch"`
+	Requests []*RecordedRequest `json:"requests"`
+	// CloseError is the error of closing batch results of the round, the runner stops the batch on it
+	CloseError *RecordedError `json:"close_error,omitempty"`
+}
+
+// RecordedRequest is the query and its result
+type RecordedRequest struct {
+	Kind  string            `json:"kind"` // query or exec
+	Query string            `json:"query"`
+	Args  []json.RawMessage `json:"args,omitempty"`
+	// Columns and Types are names and database type names of the columns of query result
+	Columns      []string          `json:"columns,omitempty"`
+	Types        []string          `json:"types,omitempty"`
+	Rows         [][]RecordedValue `json:"rows,omitempty"`
+	RowsAffected int64             `json:"rows_affected,omitempty"`
+	Error        *RecordedError    `json:"error,omitempty"`
+}
+
+// RecordedValue is the driver value with its type, so replay returns the same Go type
+type RecordedValue struct {
+	Type  string          `json:"type"` // null, int64, float64, bool, string, bytes or time
+	Value json.RawMessage `json:"value,omitempty"`
+	// Location of time, e.g. Local or UTC
+	Location string `json:"location,omitempty"`
+}
+
+// RecordedError is the error of the recorded query, it's returned by replay
+type RecordedError struct {
+	Message string `json:"message"`
+	Code    string `json:"code,omitempty"`
+}
+
+func (e *RecordedError) Error() string {
+	return e.Message
+}
+
+// SQLState returns SQLSTATE code of the error like pgconn.PgError
+func (e *RecordedError) SQLState() string {
+	return e.Code
+}
+
+// Recorder writes round trips of the driver to the file in JSONL format, see Replay
+type Recorder struct {
+	mu   sync.Mutex
+	file *os.File
+	w    *bufio.Writer
+	db   *sqlx.DB
+}
+
+// Record opens DB of the registered driver with dsn, e.g. batch_pgx.
+// Every round trip of the DB is written to the file of path. Must call Recorder.Close in the end
+func Record(driverName, dsn, path string) (*Recorder, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	d := db.Driver()
+	_ = db.Close()
+
+	var connector driver.Connector
+	if dc, ok := d.(driver.DriverContext); ok {
+		connector, err = dc.OpenConnector(dsn)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		connector = dsnConnector{dsn: dsn, driver: d}
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Recorder{
+		file: file,
+		w:    bufio.NewWriter(file),
+	}
+	if err = r.write(recordHeader{Version: RecordVersion}); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	r.db = sqlx.NewDb(sql.OpenDB(&recordConnector{base: connector, rec: r}), driverName)
+
+	return r, nil
+}
+
+// DB returns DB of the recording driver
+func (r *Recorder) DB() *sqlx.DB {
+	return r.db
+}
+
+// Close closes DB and the file
+func (r *Recorder) Close() error {
+	dbErr := r.db.Close()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return errors.Join(dbErr, r.w.Flush(), r.file.Close())
+}
+
+func (r *Recorder) write(line any) error {
+	data, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, err = r.w.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return nil
+}
+
+type dsnConnector struct {
+	dsn    string
+	driver driver.Driver
+}
+
+func (c dsnConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+type recordConnector struct {
+	base driver.Connector
+	rec  *Recorder
+}
+
+func (c *recordConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.base.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &recordConn{base: conn, rec: c.rec}, nil
+}
+
+func (c *recordConnector) Driver() driver.Driver {
+	return c.base.Driver()
+}
+
+// recordConn records results of the base conn. Results of a round are taken in order of requests
+type recordConn struct {
+	base  driver.Conn
+	rec   *Recorder
+	round *RecordedRoundTrip
+	next  int
+}
+
+func (c *recordConn) SendBatchRequests(ctx context.Context, requests []dbbatch.Request) (res any, closeFn func() error, err error) {
+	baseConn := any(c.base)
+	if val, ok := c.base.(dbbatch.BaseConnProvider); ok {
+		baseConn = val.BaseConn()
+	}
+	sender, ok := baseConn.(dbbatch.BatchRequestsSender)
+	if !ok {
+		return nil, nil, dbbatch.ErrBatchingNotSupported
+	}
+
+	res, baseClose, err := sender.SendBatchRequests(ctx, requests)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c.round = &RecordedRoundTrip{Batch: true, Requests: make([]*RecordedRequest, len(requests))}
+	c.next = 0
+	for i, request := range requests {
+		c.round.Requests[i] = &RecordedRequest{Query: request.Query, Args: recordArgs(request.Args)}
+	}
+
+	closeFn = func() error {
+		round := c.round
+		c.round = nil
+
+		closeErr := baseClose()
+		if closeErr != nil {
+			round.CloseError = recordError(closeErr)
+		}
+		return errors.Join(closeErr, c.rec.write(round))
+	}
+
+	return res, closeFn, nil
+}
+
+// request returns the recorded request of the round or the new round trip for the query without batch
+func (c *recordConn) request(ctx context.Context, kind string, query string, argsV []driver.NamedValue) (*RecordedRequest, func() error) {
+	if c.round != nil && dbbatch.BatchConnFromContext(ctx) != nil && c.next < len(c.round.Requests) {
+		request := c.round.Requests[c.next]
+		c.next++
+		request.Kind = kind
+		return request, func() error { return nil }
+	}
+
+	args := make([]any, 0, len(argsV))
+	for _, v := range argsV {
+		args = append(args, v.Value)
+	}
+	request := &RecordedRequest{Kind: kind, Query: query, Args: recordArgs(args)}
+
+	return request, func() error {
+		return c.rec.write(&RecordedRoundTrip{Batch: false, Requests: []*RecordedRequest{request}})
+	}
+}
+
+func (c *recordConn) ExecContext(ctx context.Context, query string, argsV []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.base.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	request, write := c.request(ctx, kindExecName, query, argsV)
+
+	res, err := execer.ExecContext(ctx, query, argsV)
+	if err != nil {
+		request.Error = recordError(err)
+		return nil, errors.Join(err, write())
+	}
+	request.RowsAffected, _ = res.RowsAffected()
+
+	if err = write(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c *recordConn) QueryContext(ctx context.Context, query string, argsV []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.base.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	request, write := c.request(ctx, kindQueryName, query, argsV)
+
+	baseRows, err := queryer.QueryContext(ctx, query, argsV)
+	if err != nil {
+		request.Error = recordError(err)
+		return nil, errors.Join(err, write())
+	}
+
+	rows, err := readRows(baseRows)
+	if err != nil {
+		request.Error = recordError(err)
+		return nil, errors.Join(err, write())
+	}
+
+	request.Columns = rows.Cols
+	request.Types = rows.Types
+	request.Rows = make([][]RecordedValue, len(rows.Values))
+	for i, row := range rows.Values {
+		request.Rows[i] = make([]RecordedValue, len(row))
+		for j, v := range row {
+			request.Rows[i][j] = recordValue(v)
+		}
+	}
+
+	if err = write(); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func (c *recordConn) Prepare(query string) (driver.Stmt, error) {
+	return c.base.Prepare(query)
+}
+
+func (c *recordConn) Close() error {
+	return c.base.Close()
+}
+
+func (c *recordConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *recordConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if beginner, ok := c.base.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.base.Begin() //nolint:staticcheck
+}
+
+func (c *recordConn) CheckNamedValue(v *driver.NamedValue) error {
+	if checker, ok := c.base.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(v)
+	}
+	return driver.ErrSkip
+}
+
+func (c *recordConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.base.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+const (
+	kindQueryName = "query"
+	kindExecName  = "exec"
+)
+
+// recordArgs encodes args to JSON, replay matches args by their JSON
+func recordArgs(args []any) []json.RawMessage {
+	recorded := make([]json.RawMessage, len(args))
+	for i, arg := range args {
+		data, err := json.Marshal(arg)
+		if err != nil {
+			data, _ = json.Marshal(fmt.Sprint(arg))
+		}
+		recorded[i] = data
+	}
+	return recorded
+}
+
+func recordError(err error) *RecordedError {
+	recorded := &RecordedError{Message: err.Error()}
+
+	var sqlStateErr interface{ SQLState() string }
+	if errors.As(err, &sqlStateErr) {
+		recorded.Code = sqlStateErr.SQLState()
+	}
+
+	return recorded
+}
+
+func recordValue(v any) RecordedValue {
+	var (
+		typ string
+		val any
+	)
+	switch v := v.(type) {
+	case nil:
+		return RecordedValue{Type: "null"}
+	case int64:
+		typ, val = "int64", v
+	case float64:
+		typ, val = "float64", v
+	case bool:
+		typ, val = "bool", v
+	case string:
+		typ, val = "string", v
+	case []byte:
+		typ, val = "bytes", base64.StdEncoding.EncodeToString(v)
+	case time.Time:
+		data, _ := json.Marshal(v.Format(time.RFC3339Nano))
+		return RecordedValue{Type: "time", Value: data, Location: v.Location().String()}
+	default:
+		typ, val = "string", fmt.Sprint(v)
+	}
+
+	data, _ := json.Marshal(val)
+	return RecordedValue{Type: typ, Value: data}
+}
+
+func (v RecordedValue) value() (any, error) {
+	var err error
+	switch v.Type {
+	case "null":
+		return nil, nil
+	case "int64":
+		var val int64
+		err = json.Unmarshal(v.Value, &val)
+		return val, err
+	case "float64":
+		var val float64
+		err = json.Unmarshal(v.Value, &val)
+		return val, err
+	case "bool":
+		var val bool
+		err = json.Unmarshal(v.Value, &val)
+		return val, err
+	case "string":
+		var val string
+		err = json.Unmarshal(v.Value, &val)
+		return val, err
+	case "bytes":
+		var val string
+		if err = json.Unmarshal(v.Value, &val); err != nil {
+			return nil, err
+		}
+		return base64.StdEncoding.DecodeString(val)
+	case "time":
+		var val string
+		if err = json.Unmarshal(v.Value, &val); err != nil {
+			return nil, err
+		}
+		t, err := time.Parse(time.RFC3339Nano, val)
+		if err != nil || v.Location == "" {
+			return t, err
+		}
+		loc, err := time.LoadLocation(v.Location)
+		if err != nil {
+			return nil, err
+		}
+		return t.In(loc), nil
+	}
+	return nil, fmt.Errorf("unknown type of recorded value %q", v.Type)
+}
+
+// readRows reads all rows of the base rows, because the base rows are invalid after the end of the round
+func readRows(baseRows driver.Rows) (*fakedriver.Rows, error) {
+	defer baseRows.Close()
+
+	r := &fakedriver.Rows{Cols: baseRows.Columns()}
+	if typer, ok := baseRows.(driver.RowsColumnTypeDatabaseTypeName); ok {
+		r.Types = make([]string, len(r.Cols))
+		for i := range r.Cols {
+			r.Types[i] = typer.ColumnTypeDatabaseTypeName(i)
+		}
+	}
+
+	for {
+		dest := make([]driver.Value, len(r.Cols))
+		err := baseRows.Next(dest)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		row := make([]any, len(dest))
+		for i, v := range dest {
+			if b, ok := v.([]byte); ok {
+				v = append([]byte(nil), b...)
+			}
+			row[i] = v
+		}
+		r.Values = append(r.Values, row)
+	}
+
+	return r, nil
+}
@@ -0,0 +1,146 @@
+package dbbatchtest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/inna-maikut/dbbatch"
+	"github.com/inna-maikut/dbbatch/internal/pgfake"
+	_ "github.com/inna-maikut/dbbatch/pgx_v5"
+)
+
+type recordItem struct {
+	ID   int64  `db:"id"`
+	Name string `db:"name"`
+}
+
+type recordResult struct {
+	items    [][]recordItem
+	affected int64
+	err      error
+	count    int64
+}
+
+func runRecordScenario(ctx context.Context, db *dbbatch.BatchDB) (res recordResult) {
+	res.items = make([][]recordItem, 2)
+
+	b := &dbbatch.Batch{}
+	for i := range res.items {
+		i := i
+		b.Add(func(ctx context.Context) error {
+			return db.SelectContext(ctx, &res.items[i], "select id, name from items where user_id = $1", int64(i+1))
+		})
+	}
+	b.Add(func(ctx context.Context) error {
+		r, err := db.ExecContext(ctx, "update items set name = $1", "x")
+		if err != nil {
+			return err
+		}
+		res.affected, err = r.RowsAffected()
+		return err
+	})
+	b.Add(func(ctx context.Context) error {
+		var x string
+		return db.GetContext(ctx, &x, "select fail")
+	})
+	res.err = db.SendBatch(ctx, b)
+
+	b = &dbbatch.Batch{}
+	b.Add(func(ctx context.Context) error {
+		_, err := db.ExecContext(ctx, "update items set name = $1", "y")
+		return err
+	})
+	if err := db.SendBatchInTx(ctx, b, nil); err != nil {
+		res.err = err
+	}
+
+	if err := db.GetContext(ctx, &res.count, "select count(*) from items"); err != nil {
+		res.err = err
+	}
+
+	return res
+}
+
+func recordHandler(query string, args []any) pgfake.Result {
+	switch {
+	case strings.HasPrefix(query, "select id"):
+		result := pgfake.Result{Columns: []string{"id", "name"}, ParamOIDs: []uint32{pgtype.Int8OID}}
+		if args != nil {
+			result.Rows = [][]any{{args[0], fmt.Sprintf("name %d", args[0])}}
+		}
+		return result
+	case strings.HasPrefix(query, "select count"):
+		return pgfake.Result{Columns: []string{"count"}, Rows: [][]any{{5}}}
+	case strings.HasPrefix(query, "select fail"):
+		return pgfake.Result{Columns: []string{"x"}, Err: &pgfake.Error{Code: "42P01", Message: "relation does not exist"}}
+	case strings.HasPrefix(query, "update"):
+		return pgfake.Result{RowsAffected: 2}
+	}
+	return pgfake.Result{}
+}
+
+func TestRecordReplay(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "batch.jsonl")
+
+	server, err := pgfake.Start(recordHandler)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = server.Close()
+	})
+
+	recorder, err := Record("batch_pgx", server.DSN(), path)
+	require.NoError(t, err)
+
+	recorded := runRecordScenario(ctx, dbbatch.New(recorder.DB()))
+	require.NoError(t, recorder.Close())
+
+	assert.ErrorContains(t, recorded.err, "relation does not exist")
+	assert.Equal(t, [][]recordItem{{{ID: 1, Name: "name 1"}}, {{ID: 2, Name: "name 2"}}}, recorded.items)
+	assert.Equal(t, int64(2), recorded.affected)
+	assert.Equal(t, int64(5), recorded.count)
+
+	fake := Replay(t, path)
+	replayed := runRecordScenario(ctx, fake.BatchDB())
+
+	assert.Equal(t, recorded.items, replayed.items)
+	assert.Equal(t, recorded.affected, replayed.affected)
+	assert.Equal(t, recorded.count, replayed.count)
+	assert.EqualError(t, replayed.err, recorded.err.Error())
+
+	var sqlStateErr interface{ SQLState() string }
+	require.ErrorAs(t, replayed.err, &sqlStateErr)
+	assert.Equal(t, "42P01", sqlStateErr.SQLState())
+}
+
+func TestRecordValue(t *testing.T) {
+	for _, v := range []any{
+		nil,
+		int64(1) << 60,
+		1.5,
+		true,
+		"str",
+		[]byte{0, 1, 2},
+		time.Date(2024, 1, 2, 3, 4, 5, 6, time.Local),
+		time.Date(2024, 1, 2, 3, 4, 5, 6, time.UTC),
+	} {
+		data, err := json.Marshal(recordValue(v))
+		require.NoError(t, err)
+
+		var recorded RecordedValue
+		require.NoError(t, json.Unmarshal(data, &recorded))
+
+		got, err := recorded.value()
+		require.NoError(t, err)
+		assert.Equal(t, v, got)
+	}
+}
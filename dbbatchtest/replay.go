@@ -0,0 +1,122 @@
+package dbbatchtest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"testing"
+)
+
+// Replay creates Fake serving responses recorded by Record. Requests are matched by query and args,
+// transaction control statements are expected implicitly like for any Fake
+func Replay(t testing.TB, path string) *Fake {
+	t.Helper()
+
+	f := New(t)
+	if err := f.load(path); err != nil {
+		t.Fatalf("dbbatchtest: replay %s: %v", path, err)
+	}
+
+	return f
+}
+
+func (f *Fake) load(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 64*1024*1024)
+
+	if !scanner.Scan() {
+		if err = scanner.Err(); err != nil {
+			return err
+		}
+		return fmt.Errorf("empty file")
+	}
+	var header recordHeader
+	if err = json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		return fmt.Errorf("header: %w", err)
+	}
+	if header.Version != RecordVersion {
+		return fmt.Errorf("unsupported version %d, want %d", header.Version, RecordVersion)
+	}
+
+	for line := 2; scanner.Scan(); line++ {
+		var roundTrip RecordedRoundTrip
+		if err = json.Unmarshal(scanner.Bytes(), &roundTrip); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+
+		for _, request := range roundTrip.Requests {
+			if isTxControl(request.Query) {
+				continue
+			}
+
+			e, err := replayExpectation(request)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", line, err)
+			}
+			if roundTrip.CloseError != nil {
+				e.closeErr = roundTrip.CloseError
+			}
+			f.mu.Lock()
+			f.expectations = append(f.expectations, e)
+			f.mu.Unlock()
+		}
+	}
+
+	return scanner.Err()
+}
+
+func replayExpectation(request *RecordedRequest) (*Expectation, error) {
+	e := &Expectation{
+		kind:         kindQuery,
+		pattern:      regexp.MustCompile("^" + regexp.QuoteMeta(request.Query) + "$"),
+		argsJSON:     request.Args,
+		columns:      request.Columns,
+		types:        request.Types,
+		rowsAffected: request.RowsAffected,
+		times:        1,
+	}
+	if e.argsJSON == nil {
+		e.argsJSON = []json.RawMessage{}
+	}
+	if request.Kind == kindExecName {
+		e.kind = kindExec
+	}
+	if request.Error != nil {
+		e.err = request.Error
+	}
+
+	e.rows = make([][]any, len(request.Rows))
+	for i, row := range request.Rows {
+		e.rows[i] = make([]any, len(row))
+		for j, v := range row {
+			val, err := v.value()
+			if err != nil {
+				return nil, err
+			}
+			e.rows[i][j] = val
+		}
+	}
+
+	return e, nil
+}
+
+func argsJSONEqual(a, b []json.RawMessage) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
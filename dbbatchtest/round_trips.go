@@ -0,0 +1,95 @@
+package dbbatchtest
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/inna-maikut/dbbatch"
+)
+
+// RoundTripCounter counts round trips of BatchDB: batch rounds and queries sent without batch
+type RoundTripCounter struct {
+	db *dbbatch.BatchDB
+
+	mu         sync.Mutex
+	rounds     int
+	notBatched []string
+}
+
+// CountRoundTrips returns the counter wrapping db. Code under test must use RoundTripCounter.DB(),
+// queries of callbacks are counted for any BatchDB, because the batch connection is taken from the context.
+// Works with any batch driver, the fake one or pgx_v4/pgx_v5
+func CountRoundTrips(db *dbbatch.BatchDB) *RoundTripCounter {
+	c := &RoundTripCounter{}
+	c.db = db.With(dbbatch.WithHooks(dbbatch.Hooks{
+		RoundTrip: c.roundTrip,
+		Query:     c.query,
+	}))
+
+	return c
+}
+
+// DB returns the wrapped BatchDB
+func (c *RoundTripCounter) DB() *dbbatch.BatchDB {
+	return c.db
+}
+
+func (c *RoundTripCounter) roundTrip(context.Context, []dbbatch.Request) {
+	c.mu.Lock()
+	c.rounds++
+	c.mu.Unlock()
+}
+
+func (c *RoundTripCounter) query(_ context.Context, query string) {
+	c.mu.Lock()
+	c.notBatched = append(c.notBatched, query)
+	c.mu.Unlock()
+}
+
+// RoundTrips returns the number of batch rounds and queries sent without batch
+func (c *RoundTripCounter) RoundTrips() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.rounds + len(c.notBatched)
+}
+
+// NotBatched returns queries sent without batch
+func (c *RoundTripCounter) NotBatched() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]string(nil), c.notBatched...)
+}
+
+// Reset sets counters to zero, e.g. after preparing test data
+func (c *RoundTripCounter) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.rounds = 0
+	c.notBatched = nil
+}
+
+// AssertMaxRoundTrips reports error if there were more than n round trips
+func (c *RoundTripCounter) AssertMaxRoundTrips(t testing.TB, n int) bool {
+	t.Helper()
+
+	if got := c.RoundTrips(); got > n {
+		t.Errorf("dbbatchtest: expected at most %d round trips, got %d, not batched queries: %q", n, got, c.NotBatched())
+		return false
+	}
+	return true
+}
+
+// AssertAllBatched reports error if there were queries sent without batch
+func (c *RoundTripCounter) AssertAllBatched(t testing.TB) bool {
+	t.Helper()
+
+	if notBatched := c.NotBatched(); len(notBatched) > 0 {
+		t.Errorf("dbbatchtest: expected all queries batched, not batched queries: %q", notBatched)
+		return false
+	}
+	return true
+}
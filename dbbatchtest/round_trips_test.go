@@ -0,0 +1,50 @@
+package dbbatchtest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/inna-maikut/dbbatch"
+)
+
+func TestCountRoundTrips(t *testing.T) {
+	ctx := context.Background()
+	fake := New(t)
+	counter := CountRoundTrips(fake.BatchDB())
+	db := counter.DB()
+
+	fake.ExpectQuery(`select name`).Times(3).WillReturnRows([]string{"name"}, []any{"alice"})
+	fake.ExpectExec(`update users`).Times(2).WillReturnResult(1)
+
+	b := &dbbatch.Batch{}
+	for i := 0; i < 2; i++ {
+		b.Add(func(ctx context.Context) error {
+			var name string
+			if err := db.GetContext(ctx, &name, "select name from users where id = $1", 1); err != nil {
+				return err
+			}
+			_, err := db.ExecContext(ctx, "update users set name = $1", name)
+			return err
+		})
+	}
+
+	require.NoError(t, db.SendBatch(ctx, b))
+	assert.Equal(t, 2, counter.RoundTrips())
+
+	mockT := &testing.T{}
+	assert.True(t, counter.AssertMaxRoundTrips(mockT, 2))
+	assert.False(t, counter.AssertMaxRoundTrips(mockT, 1))
+	assert.True(t, counter.AssertAllBatched(mockT))
+
+	var name string
+	require.NoError(t, db.GetContext(ctx, &name, "select name from users where id = $1", 2))
+	assert.Equal(t, 3, counter.RoundTrips())
+	assert.Equal(t, []string{"select name from users where id = $1"}, counter.NotBatched())
+	assert.False(t, counter.AssertAllBatched(mockT))
+
+	counter.Reset()
+	assert.Equal(t, 0, counter.RoundTrips())
+}
@@ -3,12 +3,45 @@ package dbbatch
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"reflect"
+	"sync"
 
 	"github.com/jmoiron/sqlx"
 )
 
 //go:generate mockgen -source deps.go -package $GOPACKAGE -typed -destination mock_deps_test.go
 
+// Types of placeholders of the driver queries for RegisterDriver
+const (
+	BindQuestion = sqlx.QUESTION // ?
+	BindDollar   = sqlx.DOLLAR   // $1
+)
+
+// driverNames are the first names of drivers registered by RegisterDriver, keys are comparable driver values
+var driverNames sync.Map // driver.Driver -> string
+
+// RegisterDriver registers the batch driver like sql.Register and binds its placeholders for sqlx,
+// so sqlx.NewDb(db, name), Rebind and In queries work with the driver name
+func RegisterDriver(name string, drv driver.Driver, bindType int) {
+	sql.Register(name, drv)
+	sqlx.BindDriver(name, bindType)
+
+	if reflect.ValueOf(drv).Comparable() {
+		driverNames.LoadOrStore(drv, name)
+	}
+}
+
+// registeredDriverName returns the name of the driver registered by RegisterDriver, empty string for other drivers
+func registeredDriverName(drv driver.Driver) string {
+	if drv == nil || !reflect.ValueOf(drv).Comparable() {
+		return ""
+	}
+	name, _ := driverNames.Load(drv)
+	s, _ := name.(string)
+	return s
+}
+
 type BaseConnProvider interface {
 	BaseConn() any
 }
@@ -17,15 +50,27 @@ type BatchRequestsSender interface {
 	SendBatchRequests(ctx context.Context, requests []Request) (res any, close func() error, err error)
 }
 
+// RequestChecker is implemented by the driver connection rejecting some requests, e.g. with unsupported args.
+// BatchConn checks the request before queueing, so the error goes only to the query instead of the whole round
+type RequestChecker interface {
+	CheckRequest(request Request) error
+}
+
 type BatchRunner interface {
-	// Queue Only for using in the driver implementation code!
-	Queue(request Request) any
+	// Result Only for using in the driver implementation code!
+	// Returns batch result of the round trip with the request queued by the current callback.
+	Result() any
 }
 
 type batchRunnerMachine interface {
 	run(ctx context.Context, b *Batch) (err error)
-	Queue(request Request) any
-	roundTrip()
+	beforeQueue(last bool) error
+	Queue(request Request)
+	queueTo(sender BatchRequestsSender, request Request)
+	Result() any
+	roundTrip() error
+	spawn(ctx context.Context, g *Group, fn CallbackFn)
+	yield(g *Group)
 }
 
 type Ext interface {
@@ -0,0 +1,47 @@
+package dbbatch
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// errorRow returns *sql.Row carrying err, Row can't be created outside database/sql.
+// The query goes to the db, which fails to connect with err, so nothing is sent
+func errorRow(err error) *sql.Row {
+	db := sql.OpenDB(errConnector{err: err})
+	defer db.Close()
+
+	return db.QueryRowContext(context.Background(), "")
+}
+
+// errorRowx returns *sqlx.Row carrying err like errorRow
+func errorRowx(err error) *sqlx.Row {
+	db := sqlx.NewDb(sql.OpenDB(errConnector{err: err}), "")
+	defer db.Close()
+
+	return db.QueryRowxContext(context.Background(), "")
+}
+
+// errConnector fails every connection with err
+type errConnector struct {
+	err error
+}
+
+func (c errConnector) Connect(context.Context) (driver.Conn, error) {
+	return nil, c.err
+}
+
+func (c errConnector) Driver() driver.Driver {
+	return errDriver(c)
+}
+
+type errDriver struct {
+	err error
+}
+
+func (d errDriver) Open(string) (driver.Conn, error) {
+	return nil, d.err
+}
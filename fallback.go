@@ -0,0 +1,103 @@
+package dbbatch
+
+import (
+	"context"
+	"database/sql/driver"
+	"reflect"
+	"sync"
+)
+
+// WithSequentialFallback runs batches with Batch.RunSequential semantics, if the driver can't batch.
+// Queries of callbacks go directly to the connection of the batch, Hooks.SequentialFallback is called for every batch.
+// Without the option the first round of such a batch fails with ErrBatchingNotSupported
+func WithSequentialFallback() Option {
+	return func(o *options) {
+		o.sequentialFallback = true
+	}
+}
+
+// SupportsBatching reports whether the driver of the db sends batches.
+// The driver is checked on the first call, the check takes a connection from the pool but doesn't query the database.
+// The result is cached by the driver, if its type is comparable. If the connection can't be taken, it reports false
+// and the driver is checked again on the next call
+func (bdb *BatchDB) SupportsBatching() bool {
+	if supported, ok := cachedBatching(bdb.Driver()); ok {
+		return supported
+	}
+
+	bc, err := bdb.BatchConn(context.Background())
+	if err != nil {
+		return false
+	}
+	defer func() {
+		_ = bc.Close()
+	}()
+
+	return bc.supportsBatching()
+}
+
+// batchRequestsSender returns the sender of driverConn, nil if the driver can't batch.
+// Driver conn sends batches itself or wraps the conn of the batch driver
+func batchRequestsSender(driverConn any) BatchRequestsSender {
+	baseConn := driverConn
+	if val, ok := driverConn.(BaseConnProvider); ok {
+		baseConn = val.BaseConn()
+	}
+
+	sender, _ := baseConn.(BatchRequestsSender)
+	return sender
+}
+
+// requestChecker returns the checker of requests of the driver connection, nil if it doesn't check requests
+func requestChecker(driverConn any) RequestChecker {
+	baseConn := driverConn
+	if val, ok := driverConn.(BaseConnProvider); ok {
+		baseConn = val.BaseConn()
+	}
+
+	checker, _ := baseConn.(RequestChecker)
+	return checker
+}
+
+// batchingDrivers caches supportsBatching by the driver, drivers of non-comparable types are checked every time
+var batchingDrivers sync.Map // driver.Driver -> bool
+
+func cacheableDriver(drv driver.Driver) bool {
+	return drv != nil && reflect.ValueOf(drv).Comparable()
+}
+
+func cachedBatching(drv driver.Driver) (supported, ok bool) {
+	if !cacheableDriver(drv) {
+		return false, false
+	}
+	cached, ok := batchingDrivers.Load(drv)
+	if !ok {
+		return false, false
+	}
+	return cached.(bool), true
+}
+
+func (bc *BatchConn) supportsBatching() bool {
+	if supported, ok := cachedBatching(bc.driver); ok {
+		return supported
+	}
+
+	supported := false
+	_ = bc.conn.Raw(func(driverConn any) error {
+		supported = batchRequestsSender(driverConn) != nil
+		return nil
+	})
+
+	if cacheableDriver(bc.driver) {
+		batchingDrivers.Store(bc.driver, supported)
+	}
+	return supported
+}
+
+// sendBatchSequentially runs the batch without the batch runner, so queries of callbacks go directly to bc
+func (bc *BatchConn) sendBatchSequentially(ctx context.Context, b *Batch) error {
+	ctx = bc.setInCtx(bc.maybeWithoutCancel(ctx))
+	bc.db.sequentialFallbackHook(ctx)
+
+	return b.RunSequential(ctx)
+}
@@ -0,0 +1,218 @@
+package dbbatch
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// seqDriver executes queries one by one without batching and records them
+type seqDriver struct {
+	mu      sync.Mutex
+	queries []string
+}
+
+func (d *seqDriver) Open(string) (driver.Conn, error) { return seqConn{d: d}, nil }
+
+func (d *seqDriver) Queries() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.queries...)
+}
+
+type seqConn struct {
+	d *seqDriver
+}
+
+func (seqConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not implemented") }
+func (seqConn) Close() error                        { return nil }
+func (seqConn) Begin() (driver.Tx, error)           { return nil, errors.New("not implemented") }
+
+func (c seqConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	c.d.queries = append(c.d.queries, query)
+	return driver.RowsAffected(1), nil
+}
+
+var seqDriverInstance = &seqDriver{}
+
+func init() {
+	sql.Register("dbbatch_seq", seqDriverInstance)
+}
+
+func newSeqDB(t *testing.T) (*sqlx.DB, *seqDriver) {
+	db, err := sqlx.Open("dbbatch_seq", "")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = db.Close()
+		seqDriverInstance.mu.Lock()
+		seqDriverInstance.queries = nil
+		seqDriverInstance.mu.Unlock()
+	})
+
+	return db, seqDriverInstance
+}
+
+func TestBatchDB_SupportsBatching(t *testing.T) {
+	senderDB := newSenderDB(t)
+	assert.True(t, New(senderDB).SupportsBatching())
+
+	db, _ := newSeqDB(t)
+	assert.False(t, New(db).SupportsBatching())
+
+	// the result is cached by the driver
+	for _, d := range []driver.Driver{senderDB.Driver(), db.Driver()} {
+		cached, ok := batchingDrivers.Load(d)
+		require.True(t, ok)
+		assert.Equal(t, d == senderDB.Driver(), cached)
+	}
+
+	// the cached result doesn't take a connection
+	require.NoError(t, senderDB.Close())
+	assert.True(t, New(senderDB).SupportsBatching())
+}
+
+func TestSequentialFallback(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("error without option", func(t *testing.T) {
+		db, d := newSeqDB(t)
+		bdb := New(db)
+
+		var queryErr error
+		b := &Batch{}
+		b.Add(func(ctx context.Context) error {
+			_, queryErr = bdb.ExecContext(ctx, "update items set name = 'a'")
+			return nil
+		})
+
+		err := bdb.SendBatch(ctx, b)
+		assert.ErrorIs(t, err, ErrBatchingNotSupported)
+		// the error comes from the first round
+		assert.ErrorIs(t, queryErr, ErrBatchingNotSupported)
+		assert.Empty(t, d.Queries())
+	})
+
+	t.Run("sequential", func(t *testing.T) {
+		db, d := newSeqDB(t)
+		fallbacks := 0
+		bdb := New(db, WithSequentialFallback(), WithHooks(Hooks{
+			SequentialFallback: func(ctx context.Context) {
+				fallbacks++
+			},
+		}))
+
+		errCallback := errors.New("callback error")
+		b := &Batch{}
+		first := b.Add(func(ctx context.Context) error {
+			assert.NotNil(t, BatchConnFromContext(ctx))
+			_, err := bdb.ExecContext(ctx, "update items set name = 'a'")
+			return err
+		})
+		b.AddAfter([]Handle{first}, func(ctx context.Context) error {
+			g := NewGroup(ctx)
+			g.Go(func(ctx context.Context) error {
+				_, err := bdb.ExecContext(ctx, "update items set name = 'b'")
+				return err
+			})
+			g.Go(func(ctx context.Context) error {
+				_, err := bdb.ExecContext(ctx, "update items set name = 'c'")
+				return err
+			})
+			return g.Wait()
+		})
+		b.Add(func(ctx context.Context) error {
+			return errCallback
+		})
+
+		err := bdb.SendBatch(ctx, b)
+		assert.ErrorIs(t, err, errCallback)
+		assert.Equal(t, 1, fallbacks)
+		assert.Equal(t, []string{
+			"update items set name = 'a'",
+			"update items set name = 'b'",
+			"update items set name = 'c'",
+		}, d.Queries())
+	})
+
+	t.Run("in tx", func(t *testing.T) {
+		db, d := newSeqDB(t)
+		bdb := New(db, WithSequentialFallback())
+
+		b := &Batch{}
+		b.Add(func(ctx context.Context) error {
+			_, err := bdb.ExecContext(ctx, "update items set name = 'a'")
+			return err
+		})
+
+		err := bdb.SendBatchInTx(ctx, b, nil)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"begin", "update items set name = 'a'", "commit"}, d.Queries())
+	})
+}
+
+// senderDriver opens conns sending batches and checking requests themselves, sending always fails
+type senderDriver struct{}
+
+func (senderDriver) Open(string) (driver.Conn, error) { return senderConn{}, nil }
+
+type senderConn struct {
+	noopConn
+}
+
+func (senderConn) SendBatchRequests(context.Context, []Request) (any, func() error, error) {
+	return nil, nil, errors.New("not implemented")
+}
+
+func (senderConn) CheckRequest(Request) error { return nil }
+
+func init() {
+	sql.Register("dbbatch_sender", senderDriver{})
+}
+
+func newSenderDB(t *testing.T) *sqlx.DB {
+	db, err := sqlx.Open("dbbatch_sender", "")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+
+	return db
+}
+
+// wrapperConn wraps the conn of the batch driver like stdlib conns of pgx
+type wrapperConn struct {
+	seqConn
+	base any
+}
+
+func (c wrapperConn) BaseConn() any { return c.base }
+
+func Test_batchRequestsSender(t *testing.T) {
+	sender := senderConn{}
+
+	tests := []struct {
+		name       string
+		driverConn any
+		want       bool
+	}{
+		{name: "conn sends batches", driverConn: sender, want: true},
+		{name: "wrapped conn sends batches", driverConn: wrapperConn{base: sender}, want: true},
+		{name: "wrapped conn can't batch", driverConn: wrapperConn{base: seqConn{}}},
+		{name: "conn can't batch", driverConn: seqConn{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, batchRequestsSender(tt.driverConn) != nil)
+			assert.Equal(t, tt.want, requestChecker(tt.driverConn) != nil)
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package dbbatch
+
+import (
+	"context"
+	"errors"
+)
+
+// Group runs child callbacks concurrently inside a batch callback.
+// Children are items of the batch like callbacks, so their queries go to the shared pipelines.
+// Go and Wait must be called from the callback or the child, which created the group.
+// Without running batch children run sequentially in Wait
+type Group struct {
+	ctx     context.Context
+	br      batchRunnerMachine
+	fns     []CallbackFn // children to run sequentially without batch
+	pending int
+	parent  *batchItem // item waiting in Wait
+	errs    []error
+}
+
+// NewGroup creates Group for the batch of ctx
+func NewGroup(ctx context.Context) *Group {
+	g := &Group{
+		ctx: ctx,
+	}
+	if bc := BatchConnFromContext(ctx); bc != nil {
+		g.br = bc.br
+	} else if mc := multiConnsFromContext(ctx); mc != nil {
+		g.br = mc.br
+	}
+
+	return g
+}
+
+// Go adds the child callback. Children don't count for WithMaxConcurrentCallbacks limit
+func (g *Group) Go(fn CallbackFn) {
+	if g.br == nil {
+		g.fns = append(g.fns, fn)
+		return
+	}
+
+	g.br.spawn(g.ctx, g, fn)
+}
+
+// Wait waits for all children and returns their joined errors.
+// The waiting callback doesn't hold the batch: children queue requests and the rounds go on
+func (g *Group) Wait() error {
+	if g.br == nil {
+		fns := g.fns
+		g.fns = nil
+		for _, fn := range fns {
+			g.errs = append(g.errs, fn(g.ctx))
+		}
+	} else if g.pending > 0 {
+		g.br.yield(g)
+	}
+
+	err := errors.Join(g.errs...)
+	g.errs = nil
+
+	return err
+}
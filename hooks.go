@@ -0,0 +1,73 @@
+package dbbatch
+
+import (
+	"context"
+)
+
+// Hooks observe queries of BatchDB, for example to count round trips in tests.
+// Hooks are called from goroutines of callbacks, so they must be safe for concurrent use
+type Hooks struct {
+	// RoundTrip is called before sending requests of a batch round
+	RoundTrip func(ctx context.Context, requests []Request)
+	// Query is called before a query sent without batch
+	Query func(ctx context.Context, query string)
+	// BypassedBatch is called in strict batching mode for a query bypassing the running batch
+	BypassedBatch func(ctx context.Context, query string)
+	// SequentialFallback is called before running a batch sequentially, because the driver can't batch
+	SequentialFallback func(ctx context.Context)
+}
+
+// WithHooks adds hooks. Hooks of several options are called in order of the options
+func WithHooks(hooks Hooks) Option {
+	return func(o *options) {
+		// full slice expression, so BatchDB.With doesn't share hooks with the parent
+		o.hooks = append(o.hooks[:len(o.hooks):len(o.hooks)], hooks)
+	}
+}
+
+// With returns BatchDB over the same *sqlx.DB with options of bdb and opts
+func (bdb *BatchDB) With(opts ...Option) *BatchDB {
+	o := bdb.options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &BatchDB{
+		DB:          bdb.DB,
+		options:     o,
+		origin:      bdb.origin,
+		replicaNext: bdb.replicaNext,
+		batchCtxs:   bdb.batchCtxs, // batches of the copy are running batches of bdb
+	}
+}
+
+func (bdb *BatchDB) roundTripHook(ctx context.Context, requests []Request) {
+	for _, hooks := range bdb.options.hooks {
+		if hooks.RoundTrip != nil {
+			hooks.RoundTrip(ctx, requests)
+		}
+	}
+}
+
+func (bdb *BatchDB) queryHook(ctx context.Context, query string) {
+	for _, hooks := range bdb.options.hooks {
+		if hooks.Query != nil {
+			hooks.Query(ctx, query)
+		}
+	}
+}
+
+func (bdb *BatchDB) bypassedBatchHook(ctx context.Context, query string) {
+	for _, hooks := range bdb.options.hooks {
+		if hooks.BypassedBatch != nil {
+			hooks.BypassedBatch(ctx, query)
+		}
+	}
+}
+
+func (bdb *BatchDB) sequentialFallbackHook(ctx context.Context) {
+	for _, hooks := range bdb.options.hooks {
+		if hooks.SequentialFallback != nil {
+			hooks.SequentialFallback(ctx)
+		}
+	}
+}
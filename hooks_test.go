@@ -0,0 +1,38 @@
+package dbbatch
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchDB_WithHooks(t *testing.T) {
+	ctx := context.Background()
+
+	var calls []string
+	hook := func(name string) Hooks {
+		return Hooks{
+			Query: func(_ context.Context, query string) {
+				calls = append(calls, name+": "+query)
+			},
+		}
+	}
+
+	bdb := New(newNoopDB(t), WithHooks(hook("first")))
+	withSecond := bdb.With(WithHooks(hook("second")))
+	withThird := bdb.With(WithHooks(hook("third")))
+	assert.Same(t, bdb.DB, withSecond.DB)
+
+	_, _ = withSecond.ExecContext(ctx, "query 1")
+	_, _ = withThird.ExecContext(ctx, "query 2")
+	_, _ = bdb.ExecContext(ctx, "query 3")
+
+	assert.Equal(t, []string{
+		"first: query 1",
+		"second: query 1",
+		"first: query 2",
+		"third: query 2",
+		"first: query 3",
+	}, calls)
+}
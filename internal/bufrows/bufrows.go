@@ -0,0 +1,94 @@
+// Package bufrows reads rows of pgx v4 and v5 into memory for dbbatch.WithBufferedRows
+package bufrows
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrTooLarge is returned when rows of the query exceed the limit of dbbatch.WithBufferedRows
+var ErrTooLarge = errors.New("buffered rows are too large")
+
+// Source is the part of pgx.Rows read by Read, F is the field description type of the pgx version
+type Source[F any] interface {
+	Close()
+	Err() error
+	FieldDescriptions() []F
+	Next() bool
+	RawValues() [][]byte
+}
+
+// Rows holds all rows of the query in memory, they don't depend on pgx.BatchResults
+type Rows[F any] struct {
+	fields []F
+	values [][][]byte
+	next   int
+}
+
+var _ Source[struct{}] = &Rows[struct{}]{}
+
+// Read reads all rows into memory and closes them. maxBytes <= 0 means no limit.
+// copyField copies the field description if it references the buffer of the message, nil if it doesn't
+func Read[F any](rows Source[F], maxBytes int, copyField func(F) F) (*Rows[F], error) {
+	defer rows.Close()
+
+	fields := rows.FieldDescriptions()
+	br := &Rows[F]{
+		fields: make([]F, len(fields)),
+	}
+	for i, fd := range fields {
+		if copyField != nil {
+			fd = copyField(fd)
+		}
+		br.fields[i] = fd
+	}
+
+	size := 0
+	for rows.Next() {
+		raw := rows.RawValues()
+		row := make([][]byte, len(raw))
+		for i, v := range raw {
+			if v != nil {
+				// pgx reuses the buffer of raw values
+				row[i] = append(make([]byte, 0, len(v)), v...)
+				size += len(v)
+			}
+		}
+		if maxBytes > 0 && size > maxBytes {
+			return nil, fmt.Errorf("%w: more than %d bytes", ErrTooLarge, maxBytes)
+		}
+		br.values = append(br.values, row)
+	}
+
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return br, nil
+}
+
+func (br *Rows[F]) Close() {}
+
+func (br *Rows[F]) Err() error {
+	return nil
+}
+
+func (br *Rows[F]) FieldDescriptions() []F {
+	return br.fields
+}
+
+func (br *Rows[F]) Next() bool {
+	if br.next >= len(br.values) {
+		return false
+	}
+	br.next++
+	return true
+}
+
+func (br *Rows[F]) RawValues() [][]byte {
+	if br.next == 0 || br.next > len(br.values) {
+		return nil
+	}
+	return br.values[br.next-1]
+}
@@ -0,0 +1,74 @@
+// Package fakedriver has parts of the drivers of dbbatch.Plan and dbbatchtest running batches without database
+package fakedriver
+
+import (
+	"database/sql/driver"
+	"errors"
+	"io"
+)
+
+// ErrNoMoreResults is returned when the driver reads more results than requests of the round
+var ErrNoMoreResults = errors.New("no more results in the round")
+
+// Round gives results of the round in order of requests like pgx.BatchResults
+type Round[R any] struct {
+	Results []R
+	next    int
+}
+
+// Next returns the result of the next request of the round
+func (r *Round[R]) Next() (R, error) {
+	if r.next >= len(r.Results) {
+		var zero R
+		return zero, ErrNoMoreResults
+	}
+	res := r.Results[r.next]
+	r.next++
+
+	return res, nil
+}
+
+// Rows are rows of the scripted result, missing values of a row are NULL
+type Rows struct {
+	Cols   []string
+	Types  []string // database type names of columns, may be empty
+	Values [][]any
+	next   int
+}
+
+var (
+	_ driver.Rows                           = &Rows{}
+	_ driver.RowsColumnTypeDatabaseTypeName = &Rows{}
+)
+
+func (r *Rows) ColumnTypeDatabaseTypeName(index int) string {
+	if index < len(r.Types) {
+		return r.Types[index]
+	}
+	return ""
+}
+
+func (r *Rows) Columns() []string {
+	return r.Cols
+}
+
+func (r *Rows) Close() error {
+	return nil
+}
+
+func (r *Rows) Next(dest []driver.Value) error {
+	if r.next >= len(r.Values) {
+		return io.EOF
+	}
+	row := r.Values[r.next]
+	r.next++
+
+	for i := range dest {
+		if i < len(row) {
+			dest[i] = row[i]
+		} else {
+			dest[i] = nil
+		}
+	}
+	return nil
+}
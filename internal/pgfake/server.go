@@ -0,0 +1,623 @@
+// Package pgfake is the in-process fake PostgreSQL server for driver tests without a database.
+// It speaks the startup, simple query with several statements and extended query protocols
+// (Parse/Bind/Describe/Execute/Sync, pipelining) and answers statements with responses of the Handler.
+package pgfake
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgproto3"
+)
+
+// OIDs of types supported in binary format
+const (
+	BoolOID        = 16
+	Int8OID        = 20
+	Int4OID        = 23
+	textOID        = 25
+	Float8OID      = 701
+	TimestamptzOID = 1184
+)
+
+// Result is the response to the query. Values of rows are sent in text format as fmt.Sprint of the value,
+// time.Time in the text format of timestamptz, or in binary format if the client asks for it. nil is NULL
+type Result struct {
+	Columns []string
+	// ColumnOIDs are types of columns, text by default
+	ColumnOIDs []uint32
+	Rows       [][]any
+	// RowsAffected of insert, update and delete. The number of rows is used for select
+	RowsAffected int64
+	Err          *Error
+	// ParamOIDs are types of params in Describe of the statement, text by default.
+	// E.g. pgx can't encode int into text param
+	ParamOIDs []uint32
+}
+
+// Error is the error response of the server
+type Error struct {
+	Code    string
+	Message string
+}
+
+// Handler answers the query. Describe of a statement calls it with nil args to get the columns
+type Handler func(query string, args []any) Result
+
+// Server is the fake PostgreSQL server listening on localhost
+type Server struct {
+	ln      net.Listener
+	handler Handler
+
+	mu      sync.Mutex
+	conns   map[net.Conn]struct{}
+	queries []string
+	wg      sync.WaitGroup
+}
+
+// Start starts the server on a random localhost port
+func Start(handler Handler) (*Server, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		ln:      ln,
+		handler: handler,
+		conns:   map[net.Conn]struct{}{},
+	}
+
+	s.wg.Add(1)
+	go s.serve()
+
+	return s, nil
+}
+
+// DSN returns the connection string of the server
+func (s *Server) DSN() string {
+	return fmt.Sprintf("postgres://fake@%s/fake?sslmode=disable", s.ln.Addr())
+}
+
+// Queries returns executed queries in order of execution
+func (s *Server) Queries() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.queries...)
+}
+
+// Close stops the server and closes its connections
+func (s *Server) Close() error {
+	err := s.ln.Close()
+
+	s.mu.Lock()
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.conns[conn] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer func() {
+				s.mu.Lock()
+				delete(s.conns, conn)
+				s.mu.Unlock()
+				_ = conn.Close()
+			}()
+
+			c := &serverConn{
+				server:     s,
+				backend:    pgproto3.NewBackend(conn, conn),
+				statements: map[string]statement{},
+				portals:    map[string]portal{},
+				txStatus:   'I',
+			}
+			_ = c.serve(conn)
+		}()
+	}
+}
+
+func (s *Server) handle(query string, args []any) Result {
+	if args != nil {
+		s.mu.Lock()
+		s.queries = append(s.queries, query)
+		s.mu.Unlock()
+	}
+
+	return s.handler(query, args)
+}
+
+type statement struct {
+	query     string
+	paramOIDs []uint32
+}
+
+type portal struct {
+	statement     statement
+	args          []any
+	resultFormats []int16
+}
+
+type serverConn struct {
+	server     *Server
+	backend    *pgproto3.Backend
+	statements map[string]statement
+	portals    map[string]portal
+	txStatus   byte
+	failed     bool // error in extended query, messages are skipped until Sync
+}
+
+func (c *serverConn) serve(conn net.Conn) error {
+	if err := c.startup(conn); err != nil {
+		return err
+	}
+
+	for {
+		msg, err := c.backend.Receive()
+		if err != nil {
+			return err
+		}
+
+		if _, ok := msg.(*pgproto3.Terminate); ok {
+			return nil
+		}
+		if _, ok := msg.(*pgproto3.Sync); ok {
+			c.failed = false
+			c.backend.Send(&pgproto3.ReadyForQuery{TxStatus: c.txStatus})
+			if err = c.backend.Flush(); err != nil {
+				return err
+			}
+			continue
+		}
+		if c.failed {
+			continue
+		}
+
+		switch msg := msg.(type) {
+		case *pgproto3.Query:
+			c.simpleQuery(msg.String)
+			c.backend.Send(&pgproto3.ReadyForQuery{TxStatus: c.txStatus})
+		case *pgproto3.Parse:
+			c.parse(msg)
+		case *pgproto3.Bind:
+			c.bind(msg)
+		case *pgproto3.Describe:
+			c.describe(msg)
+		case *pgproto3.Execute:
+			c.execute(msg)
+		case *pgproto3.Close:
+			if msg.ObjectType == 'S' {
+				delete(c.statements, msg.Name)
+			} else {
+				delete(c.portals, msg.Name)
+			}
+			c.backend.Send(&pgproto3.CloseComplete{})
+		case *pgproto3.Flush:
+		default:
+			c.fail(&Error{Code: "08P01", Message: fmt.Sprintf("unsupported message %T", msg)})
+		}
+
+		if err = c.backend.Flush(); err != nil {
+			return err
+		}
+	}
+}
+
+func (c *serverConn) startup(conn net.Conn) error {
+	for {
+		msg, err := c.backend.ReceiveStartupMessage()
+		if err != nil {
+			return err
+		}
+
+		switch msg.(type) {
+		case *pgproto3.SSLRequest, *pgproto3.GSSEncRequest:
+			if _, err = conn.Write([]byte("N")); err != nil {
+				return err
+			}
+			continue
+		case *pgproto3.StartupMessage:
+		default:
+			return fmt.Errorf("unsupported startup message %T", msg)
+		}
+		break
+	}
+
+	c.backend.Send(&pgproto3.AuthenticationOk{})
+	for name, value := range map[string]string{
+		"server_version":              "16.0",
+		"server_encoding":             "UTF8",
+		"client_encoding":             "UTF8",
+		"DateStyle":                   "ISO, MDY",
+		"integer_datetimes":           "on",
+		"standard_conforming_strings": "on",
+		"TimeZone":                    "UTC",
+	} {
+		c.backend.Send(&pgproto3.ParameterStatus{Name: name, Value: value})
+	}
+	c.backend.Send(&pgproto3.BackendKeyData{ProcessID: 1, SecretKey: 1})
+	c.backend.Send(&pgproto3.ReadyForQuery{TxStatus: c.txStatus})
+
+	return c.backend.Flush()
+}
+
+// handle executes the query like the server: in the failed transaction only COMMIT and ROLLBACK are executed,
+// COMMIT rolls back the transaction
+func (c *serverConn) handle(query string, args []any) Result {
+	if c.txStatus == 'E' {
+		fields := strings.Fields(strings.ToUpper(query))
+		if len(fields) == 0 || (fields[0] != "COMMIT" && fields[0] != "END" && fields[0] != "ROLLBACK") {
+			return Result{Err: &Error{
+				Code:    "25P02",
+				Message: "current transaction is aborted, commands ignored until end of transaction block",
+			}}
+		}
+	}
+
+	return c.server.handle(query, args)
+}
+
+func (c *serverConn) fail(err *Error) {
+	c.backend.Send(&pgproto3.ErrorResponse{Severity: "ERROR", Code: err.Code, Message: err.Message})
+	c.failed = true
+	if c.txStatus == 'T' {
+		c.txStatus = 'E'
+	}
+}
+
+// simpleQuery handles statements of the query one by one, the error skips the rest of statements
+func (c *serverConn) simpleQuery(query string) {
+	statements := splitStatements(query)
+	if len(statements) == 0 {
+		c.backend.Send(&pgproto3.EmptyQueryResponse{})
+		return
+	}
+
+	for _, statement := range statements {
+		res := c.handle(statement, []any{})
+		if res.Err != nil {
+			c.fail(res.Err)
+			c.failed = false
+			return
+		}
+		if res.Columns != nil {
+			c.backend.Send(rowDescription(res, nil))
+		}
+		c.sendResult(statement, res, nil)
+	}
+}
+
+// splitStatements splits the simple query by semicolons outside of quotes and line comments
+func splitStatements(query string) []string {
+	var statements []string
+	start := 0
+	for i := 0; i < len(query); i++ {
+		switch query[i] {
+		case '\'', '"':
+			quote := query[i]
+			escape := quote == '\'' && i > 0 && (query[i-1] == 'E' || query[i-1] == 'e')
+			for i++; i < len(query); i++ {
+				if escape && query[i] == '\\' {
+					i++
+				} else if query[i] == quote {
+					break
+				}
+			}
+		case '-':
+			if strings.HasPrefix(query[i:], "--") {
+				for i < len(query) && query[i] != '\n' {
+					i++
+				}
+			}
+		case ';':
+			statements = appendStatement(statements, query[start:i])
+			start = i + 1
+		}
+	}
+
+	return appendStatement(statements, query[start:])
+}
+
+func appendStatement(statements []string, statement string) []string {
+	if strings.TrimSpace(statement) == "" {
+		return statements
+	}
+	return append(statements, statement)
+}
+
+func (c *serverConn) parse(msg *pgproto3.Parse) {
+	paramOIDs := make([]uint32, paramsCount(msg.Query))
+	for i := range paramOIDs {
+		paramOIDs[i] = textOID
+		if i < len(msg.ParameterOIDs) && msg.ParameterOIDs[i] != 0 {
+			paramOIDs[i] = msg.ParameterOIDs[i]
+		}
+	}
+
+	c.statements[msg.Name] = statement{query: msg.Query, paramOIDs: paramOIDs}
+	c.backend.Send(&pgproto3.ParseComplete{})
+}
+
+func (c *serverConn) bind(msg *pgproto3.Bind) {
+	st, ok := c.statements[msg.PreparedStatement]
+	if !ok {
+		c.fail(&Error{Code: "26000", Message: fmt.Sprintf("prepared statement %q does not exist", msg.PreparedStatement)})
+		return
+	}
+	if len(msg.Parameters) != len(st.paramOIDs) {
+		c.fail(&Error{Code: "08P01", Message: fmt.Sprintf(
+			"bind message supplies %d parameters, but prepared statement requires %d", len(msg.Parameters), len(st.paramOIDs))})
+		return
+	}
+
+	args := make([]any, len(msg.Parameters))
+	for i, param := range msg.Parameters {
+		format := int16(0)
+		switch len(msg.ParameterFormatCodes) {
+		case 0:
+		case 1:
+			format = msg.ParameterFormatCodes[0]
+		default:
+			format = msg.ParameterFormatCodes[i]
+		}
+
+		arg, err := decodeParam(st.paramOIDs[i], format, param)
+		if err != nil {
+			c.fail(&Error{Code: "22P03", Message: err.Error()})
+			return
+		}
+		args[i] = arg
+	}
+
+	c.portals[msg.DestinationPortal] = portal{statement: st, args: args, resultFormats: msg.ResultFormatCodes}
+	c.backend.Send(&pgproto3.BindComplete{})
+}
+
+func (c *serverConn) describe(msg *pgproto3.Describe) {
+	if msg.ObjectType == 'S' {
+		st, ok := c.statements[msg.Name]
+		if !ok {
+			c.fail(&Error{Code: "26000", Message: fmt.Sprintf("prepared statement %q does not exist", msg.Name)})
+			return
+		}
+		res := c.server.handler(st.query, nil)
+		for i, oid := range res.ParamOIDs {
+			if i < len(st.paramOIDs) {
+				st.paramOIDs[i] = oid
+			}
+		}
+		c.backend.Send(&pgproto3.ParameterDescription{ParameterOIDs: st.paramOIDs})
+		c.sendRowDescription(res, nil)
+		return
+	}
+
+	p, ok := c.portals[msg.Name]
+	if !ok {
+		c.fail(&Error{Code: "34000", Message: fmt.Sprintf("portal %q does not exist", msg.Name)})
+		return
+	}
+	c.sendRowDescription(c.server.handler(p.statement.query, nil), p.resultFormats)
+}
+
+func (c *serverConn) sendRowDescription(res Result, formats []int16) {
+	if res.Columns == nil {
+		c.backend.Send(&pgproto3.NoData{})
+		return
+	}
+	c.backend.Send(rowDescription(res, formats))
+}
+
+func (c *serverConn) execute(msg *pgproto3.Execute) {
+	p, ok := c.portals[msg.Portal]
+	if !ok {
+		c.fail(&Error{Code: "34000", Message: fmt.Sprintf("portal %q does not exist", msg.Portal)})
+		return
+	}
+
+	res := c.handle(p.statement.query, p.args)
+	if res.Err != nil {
+		c.fail(res.Err)
+		return
+	}
+	c.sendResult(p.statement.query, res, p.resultFormats)
+}
+
+func (c *serverConn) sendResult(query string, res Result, formats []int16) {
+	for _, row := range res.Rows {
+		values := make([][]byte, len(row))
+		for i, v := range row {
+			value, err := encodeValue(columnOID(res, i), resultFormat(formats, i), v)
+			if err != nil {
+				c.fail(&Error{Code: "XX000", Message: err.Error()})
+				return
+			}
+			values[i] = value
+		}
+		c.backend.Send(&pgproto3.DataRow{Values: values})
+	}
+
+	command := strings.ToUpper(strings.Fields(query)[0])
+	var tag string
+	switch command {
+	case "SELECT":
+		tag = fmt.Sprintf("SELECT %d", len(res.Rows))
+	case "INSERT":
+		tag = fmt.Sprintf("INSERT 0 %d", res.RowsAffected)
+	case "UPDATE", "DELETE":
+		tag = fmt.Sprintf("%s %d", command, res.RowsAffected)
+	case "BEGIN", "START":
+		tag = "BEGIN"
+		c.txStatus = 'T'
+	case "COMMIT", "END":
+		tag = "COMMIT"
+		if c.txStatus == 'E' {
+			tag = "ROLLBACK"
+		}
+		c.txStatus = 'I'
+	case "ROLLBACK":
+		tag = "ROLLBACK"
+		if strings.Contains(strings.ToUpper(query), " TO ") {
+			c.txStatus = 'T'
+		} else {
+			c.txStatus = 'I'
+		}
+	default:
+		tag = command
+	}
+	c.backend.Send(&pgproto3.CommandComplete{CommandTag: []byte(tag)})
+}
+
+func rowDescription(res Result, formats []int16) *pgproto3.RowDescription {
+	fields := make([]pgproto3.FieldDescription, len(res.Columns))
+	for i, name := range res.Columns {
+		fields[i] = pgproto3.FieldDescription{
+			Name:         []byte(name),
+			DataTypeOID:  columnOID(res, i),
+			DataTypeSize: -1,
+			TypeModifier: -1,
+			Format:       resultFormat(formats, i),
+		}
+	}
+	return &pgproto3.RowDescription{Fields: fields}
+}
+
+func columnOID(res Result, i int) uint32 {
+	if i < len(res.ColumnOIDs) && res.ColumnOIDs[i] != 0 {
+		return res.ColumnOIDs[i]
+	}
+	return textOID
+}
+
+// resultFormat returns the format of the column i by format codes of Bind: none means text, one is for all columns
+func resultFormat(formats []int16, i int) int16 {
+	switch len(formats) {
+	case 0:
+		return 0
+	case 1:
+		return formats[0]
+	default:
+		return formats[i]
+	}
+}
+
+// postgresEpoch is the zero of binary timestamptz
+var postgresEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// encodeValue encodes the value of the column in text or binary format
+func encodeValue(oid uint32, format int16, v any) ([]byte, error) {
+	if v == nil {
+		return nil, nil
+	}
+	if format == 0 {
+		if t, ok := v.(time.Time); ok {
+			return []byte(t.Format("2006-01-02 15:04:05.999999Z07:00")), nil
+		}
+		return []byte(fmt.Sprint(v)), nil
+	}
+
+	switch oid {
+	case BoolOID:
+		if b, ok := v.(bool); ok && b {
+			return []byte{1}, nil
+		}
+		return []byte{0}, nil
+	case Int4OID:
+		n, err := strconv.ParseInt(fmt.Sprint(v), 10, 32)
+		return binary.BigEndian.AppendUint32(nil, uint32(n)), err
+	case Int8OID:
+		n, err := strconv.ParseInt(fmt.Sprint(v), 10, 64)
+		return binary.BigEndian.AppendUint64(nil, uint64(n)), err
+	case Float8OID:
+		f, err := strconv.ParseFloat(fmt.Sprint(v), 64)
+		return binary.BigEndian.AppendUint64(nil, math.Float64bits(f)), err
+	case TimestamptzOID:
+		t, ok := v.(time.Time)
+		if !ok {
+			return nil, fmt.Errorf("timestamptz value must be time.Time, got %T", v)
+		}
+		return binary.BigEndian.AppendUint64(nil, uint64(t.Sub(postgresEpoch).Microseconds())), nil
+	default:
+		return []byte(fmt.Sprint(v)), nil
+	}
+}
+
+var paramRe = regexp.MustCompile(`\$(\d+)`)
+
+// paramsCount returns the max number of $n placeholder in the query
+func paramsCount(query string) int {
+	count := 0
+	for _, m := range paramRe.FindAllStringSubmatch(query, -1) {
+		n, _ := strconv.Atoi(m[1])
+		if n > count {
+			count = n
+		}
+	}
+	return count
+}
+
+// decodeParam decodes text params as string and binary params of basic types
+func decodeParam(oid uint32, format int16, param []byte) (any, error) {
+	if param == nil {
+		return nil, nil
+	}
+	if format == 0 {
+		return string(param), nil
+	}
+
+	switch oid {
+	case 16: // bool
+		return len(param) == 1 && param[0] == 1, nil
+	case 21: // int2
+		if len(param) == 2 {
+			return int64(int16(binary.BigEndian.Uint16(param))), nil
+		}
+	case 23: // int4
+		if len(param) == 4 {
+			return int64(int32(binary.BigEndian.Uint32(param))), nil
+		}
+	case 20: // int8
+		if len(param) == 8 {
+			return int64(binary.BigEndian.Uint64(param)), nil
+		}
+	case 700: // float4
+		if len(param) == 4 {
+			return float64(math.Float32frombits(binary.BigEndian.Uint32(param))), nil
+		}
+	case 701: // float8
+		if len(param) == 8 {
+			return math.Float64frombits(binary.BigEndian.Uint64(param)), nil
+		}
+	default:
+		return append([]byte(nil), param...), nil
+	}
+
+	return nil, errors.New("invalid binary param of oid " + strconv.Itoa(int(oid)))
+}
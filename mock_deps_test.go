@@ -141,6 +141,67 @@ func (c *BatchRequestsSenderSendBatchRequestsCall) DoAndReturn(f func(context.Co
 	return c
 }
 
+// MockRequestChecker is a mock of RequestChecker interface.
+type MockRequestChecker struct {
+	ctrl     *gomock.Controller
+	recorder *MockRequestCheckerMockRecorder
+}
+
+// MockRequestCheckerMockRecorder is the mock recorder for MockRequestChecker.
+type MockRequestCheckerMockRecorder struct {
+	mock *MockRequestChecker
+}
+
+// NewMockRequestChecker creates a new mock instance.
+func NewMockRequestChecker(ctrl *gomock.Controller) *MockRequestChecker {
+	mock := &MockRequestChecker{ctrl: ctrl}
+	mock.recorder = &MockRequestCheckerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRequestChecker) EXPECT() *MockRequestCheckerMockRecorder {
+	return m.recorder
+}
+
+// CheckRequest mocks base method.
+func (m *MockRequestChecker) CheckRequest(request Request) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CheckRequest", request)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CheckRequest indicates an expected call of CheckRequest.
+func (mr *MockRequestCheckerMockRecorder) CheckRequest(request any) *RequestCheckerCheckRequestCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckRequest", reflect.TypeOf((*MockRequestChecker)(nil).CheckRequest), request)
+	return &RequestCheckerCheckRequestCall{Call: call}
+}
+
+// RequestCheckerCheckRequestCall wrap *gomock.Call
+type RequestCheckerCheckRequestCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *RequestCheckerCheckRequestCall) Return(arg0 error) *RequestCheckerCheckRequestCall {
+	c.Call = c.Call.Return(arg0)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *RequestCheckerCheckRequestCall) Do(f func(Request) error) *RequestCheckerCheckRequestCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *RequestCheckerCheckRequestCall) DoAndReturn(f func(Request) error) *RequestCheckerCheckRequestCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
 // MockBatchRunner is a mock of BatchRunner interface.
 type MockBatchRunner struct {
 	ctrl     *gomock.Controller
@@ -164,40 +225,40 @@ func (m *MockBatchRunner) EXPECT() *MockBatchRunnerMockRecorder {
 	return m.recorder
 }
 
-// Queue mocks base method.
-func (m *MockBatchRunner) Queue(request Request) any {
+// Result mocks base method.
+func (m *MockBatchRunner) Result() any {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Queue", request)
+	ret := m.ctrl.Call(m, "Result")
 	ret0, _ := ret[0].(any)
 	return ret0
 }
 
-// Queue indicates an expected call of Queue.
-func (mr *MockBatchRunnerMockRecorder) Queue(request any) *BatchRunnerQueueCall {
+// Result indicates an expected call of Result.
+func (mr *MockBatchRunnerMockRecorder) Result() *BatchRunnerResultCall {
 	mr.mock.ctrl.T.Helper()
-	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Queue", reflect.TypeOf((*MockBatchRunner)(nil).Queue), request)
-	return &BatchRunnerQueueCall{Call: call}
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Result", reflect.TypeOf((*MockBatchRunner)(nil).Result))
+	return &BatchRunnerResultCall{Call: call}
 }
 
-// BatchRunnerQueueCall wrap *gomock.Call
-type BatchRunnerQueueCall struct {
+// BatchRunnerResultCall wrap *gomock.Call
+type BatchRunnerResultCall struct {
 	*gomock.Call
 }
 
 // Return rewrite *gomock.Call.Return
-func (c *BatchRunnerQueueCall) Return(arg0 any) *BatchRunnerQueueCall {
+func (c *BatchRunnerResultCall) Return(arg0 any) *BatchRunnerResultCall {
 	c.Call = c.Call.Return(arg0)
 	return c
 }
 
 // Do rewrite *gomock.Call.Do
-func (c *BatchRunnerQueueCall) Do(f func(Request) any) *BatchRunnerQueueCall {
+func (c *BatchRunnerResultCall) Do(f func() any) *BatchRunnerResultCall {
 	c.Call = c.Call.Do(f)
 	return c
 }
 
 // DoAndReturn rewrite *gomock.Call.DoAndReturn
-func (c *BatchRunnerQueueCall) DoAndReturn(f func(Request) any) *BatchRunnerQueueCall {
+func (c *BatchRunnerResultCall) DoAndReturn(f func() any) *BatchRunnerResultCall {
 	c.Call = c.Call.DoAndReturn(f)
 	return c
 }
@@ -226,11 +287,9 @@ func (m *MockbatchRunnerMachine) EXPECT() *MockbatchRunnerMachineMockRecorder {
 }
 
 // Queue mocks base method.
-func (m *MockbatchRunnerMachine) Queue(request Request) any {
+func (m *MockbatchRunnerMachine) Queue(request Request) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Queue", request)
-	ret0, _ := ret[0].(any)
-	return ret0
+	m.ctrl.Call(m, "Queue", request)
 }
 
 // Queue indicates an expected call of Queue.
@@ -246,27 +305,141 @@ type batchRunnerMachineQueueCall struct {
 }
 
 // Return rewrite *gomock.Call.Return
-func (c *batchRunnerMachineQueueCall) Return(arg0 any) *batchRunnerMachineQueueCall {
+func (c *batchRunnerMachineQueueCall) Return() *batchRunnerMachineQueueCall {
+	c.Call = c.Call.Return()
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *batchRunnerMachineQueueCall) Do(f func(Request)) *batchRunnerMachineQueueCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *batchRunnerMachineQueueCall) DoAndReturn(f func(Request)) *batchRunnerMachineQueueCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// Result mocks base method.
+func (m *MockbatchRunnerMachine) Result() any {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Result")
+	ret0, _ := ret[0].(any)
+	return ret0
+}
+
+// Result indicates an expected call of Result.
+func (mr *MockbatchRunnerMachineMockRecorder) Result() *batchRunnerMachineResultCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Result", reflect.TypeOf((*MockbatchRunnerMachine)(nil).Result))
+	return &batchRunnerMachineResultCall{Call: call}
+}
+
+// batchRunnerMachineResultCall wrap *gomock.Call
+type batchRunnerMachineResultCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *batchRunnerMachineResultCall) Return(arg0 any) *batchRunnerMachineResultCall {
+	c.Call = c.Call.Return(arg0)
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *batchRunnerMachineResultCall) Do(f func() any) *batchRunnerMachineResultCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *batchRunnerMachineResultCall) DoAndReturn(f func() any) *batchRunnerMachineResultCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// beforeQueue mocks base method.
+func (m *MockbatchRunnerMachine) beforeQueue(last bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "beforeQueue", last)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// beforeQueue indicates an expected call of beforeQueue.
+func (mr *MockbatchRunnerMachineMockRecorder) beforeQueue(last any) *batchRunnerMachinebeforeQueueCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "beforeQueue", reflect.TypeOf((*MockbatchRunnerMachine)(nil).beforeQueue), last)
+	return &batchRunnerMachinebeforeQueueCall{Call: call}
+}
+
+// batchRunnerMachinebeforeQueueCall wrap *gomock.Call
+type batchRunnerMachinebeforeQueueCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *batchRunnerMachinebeforeQueueCall) Return(arg0 error) *batchRunnerMachinebeforeQueueCall {
 	c.Call = c.Call.Return(arg0)
 	return c
 }
 
 // Do rewrite *gomock.Call.Do
-func (c *batchRunnerMachineQueueCall) Do(f func(Request) any) *batchRunnerMachineQueueCall {
+func (c *batchRunnerMachinebeforeQueueCall) Do(f func(bool) error) *batchRunnerMachinebeforeQueueCall {
 	c.Call = c.Call.Do(f)
 	return c
 }
 
 // DoAndReturn rewrite *gomock.Call.DoAndReturn
-func (c *batchRunnerMachineQueueCall) DoAndReturn(f func(Request) any) *batchRunnerMachineQueueCall {
+func (c *batchRunnerMachinebeforeQueueCall) DoAndReturn(f func(bool) error) *batchRunnerMachinebeforeQueueCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// queueTo mocks base method.
+func (m *MockbatchRunnerMachine) queueTo(sender BatchRequestsSender, request Request) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "queueTo", sender, request)
+}
+
+// queueTo indicates an expected call of queueTo.
+func (mr *MockbatchRunnerMachineMockRecorder) queueTo(sender, request any) *batchRunnerMachinequeueToCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "queueTo", reflect.TypeOf((*MockbatchRunnerMachine)(nil).queueTo), sender, request)
+	return &batchRunnerMachinequeueToCall{Call: call}
+}
+
+// batchRunnerMachinequeueToCall wrap *gomock.Call
+type batchRunnerMachinequeueToCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *batchRunnerMachinequeueToCall) Return() *batchRunnerMachinequeueToCall {
+	c.Call = c.Call.Return()
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *batchRunnerMachinequeueToCall) Do(f func(BatchRequestsSender, Request)) *batchRunnerMachinequeueToCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *batchRunnerMachinequeueToCall) DoAndReturn(f func(BatchRequestsSender, Request)) *batchRunnerMachinequeueToCall {
 	c.Call = c.Call.DoAndReturn(f)
 	return c
 }
 
 // roundTrip mocks base method.
-func (m *MockbatchRunnerMachine) roundTrip() {
+func (m *MockbatchRunnerMachine) roundTrip() error {
 	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "roundTrip")
+	ret := m.ctrl.Call(m, "roundTrip")
+	ret0, _ := ret[0].(error)
+	return ret0
 }
 
 // roundTrip indicates an expected call of roundTrip.
@@ -282,19 +455,19 @@ type batchRunnerMachineroundTripCall struct {
 }
 
 // Return rewrite *gomock.Call.Return
-func (c *batchRunnerMachineroundTripCall) Return() *batchRunnerMachineroundTripCall {
-	c.Call = c.Call.Return()
+func (c *batchRunnerMachineroundTripCall) Return(arg0 error) *batchRunnerMachineroundTripCall {
+	c.Call = c.Call.Return(arg0)
 	return c
 }
 
 // Do rewrite *gomock.Call.Do
-func (c *batchRunnerMachineroundTripCall) Do(f func()) *batchRunnerMachineroundTripCall {
+func (c *batchRunnerMachineroundTripCall) Do(f func() error) *batchRunnerMachineroundTripCall {
 	c.Call = c.Call.Do(f)
 	return c
 }
 
 // DoAndReturn rewrite *gomock.Call.DoAndReturn
-func (c *batchRunnerMachineroundTripCall) DoAndReturn(f func()) *batchRunnerMachineroundTripCall {
+func (c *batchRunnerMachineroundTripCall) DoAndReturn(f func() error) *batchRunnerMachineroundTripCall {
 	c.Call = c.Call.DoAndReturn(f)
 	return c
 }
@@ -337,6 +510,78 @@ func (c *batchRunnerMachinerunCall) DoAndReturn(f func(context.Context, *Batch)
 	return c
 }
 
+// spawn mocks base method.
+func (m *MockbatchRunnerMachine) spawn(ctx context.Context, g *Group, fn CallbackFn) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "spawn", ctx, g, fn)
+}
+
+// spawn indicates an expected call of spawn.
+func (mr *MockbatchRunnerMachineMockRecorder) spawn(ctx, g, fn any) *batchRunnerMachinespawnCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "spawn", reflect.TypeOf((*MockbatchRunnerMachine)(nil).spawn), ctx, g, fn)
+	return &batchRunnerMachinespawnCall{Call: call}
+}
+
+// batchRunnerMachinespawnCall wrap *gomock.Call
+type batchRunnerMachinespawnCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *batchRunnerMachinespawnCall) Return() *batchRunnerMachinespawnCall {
+	c.Call = c.Call.Return()
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *batchRunnerMachinespawnCall) Do(f func(context.Context, *Group, CallbackFn)) *batchRunnerMachinespawnCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *batchRunnerMachinespawnCall) DoAndReturn(f func(context.Context, *Group, CallbackFn)) *batchRunnerMachinespawnCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
+// yield mocks base method.
+func (m *MockbatchRunnerMachine) yield(g *Group) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "yield", g)
+}
+
+// yield indicates an expected call of yield.
+func (mr *MockbatchRunnerMachineMockRecorder) yield(g any) *batchRunnerMachineyieldCall {
+	mr.mock.ctrl.T.Helper()
+	call := mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "yield", reflect.TypeOf((*MockbatchRunnerMachine)(nil).yield), g)
+	return &batchRunnerMachineyieldCall{Call: call}
+}
+
+// batchRunnerMachineyieldCall wrap *gomock.Call
+type batchRunnerMachineyieldCall struct {
+	*gomock.Call
+}
+
+// Return rewrite *gomock.Call.Return
+func (c *batchRunnerMachineyieldCall) Return() *batchRunnerMachineyieldCall {
+	c.Call = c.Call.Return()
+	return c
+}
+
+// Do rewrite *gomock.Call.Do
+func (c *batchRunnerMachineyieldCall) Do(f func(*Group)) *batchRunnerMachineyieldCall {
+	c.Call = c.Call.Do(f)
+	return c
+}
+
+// DoAndReturn rewrite *gomock.Call.DoAndReturn
+func (c *batchRunnerMachineyieldCall) DoAndReturn(f func(*Group)) *batchRunnerMachineyieldCall {
+	c.Call = c.Call.DoAndReturn(f)
+	return c
+}
+
 // MockExt is a mock of Ext interface.
 type MockExt struct {
 	ctrl     *gomock.Controller
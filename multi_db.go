@@ -0,0 +1,145 @@
+package dbbatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// MultiDB holds BatchDB of every shard
+type MultiDB struct {
+	shards map[string]*BatchDB
+}
+
+func NewMultiDB(shards map[string]*BatchDB) *MultiDB {
+	return &MultiDB{
+		shards: shards,
+	}
+}
+
+// Shard returns BatchDB of the shard, nil if there is no such shard
+func (m *MultiDB) Shard(key string) *BatchDB {
+	return m.shards[key]
+}
+
+// shardOf returns the shard of bdb or its copy made by BatchDB.With
+func (m *MultiDB) shardOf(bdb *BatchDB) (*BatchDB, bool) {
+	for _, shard := range m.shards {
+		if shard.originDB() == bdb.originDB() {
+			return shard, true
+		}
+	}
+	return nil, false
+}
+
+// maxConcurrentCallbacks is the least limit of WithMaxConcurrentCallbacks of shards.
+// Callbacks aren't bound to shards, so the least limit holds for every shard
+func (m *MultiDB) maxConcurrentCallbacks() int {
+	limit := 0
+	for _, shard := range m.shards {
+		if n := shard.options.maxConcurrentCallbacks; n > 0 && (limit == 0 || n < limit) {
+			limit = n
+		}
+	}
+	return limit
+}
+
+// SendBatch sends the batch spanning several shards. Callbacks query shards via MultiDB.Shard(key),
+// a callback can query several shards. The batch connection of the shard is opened on its first query.
+// Requests of every touched shard are sent concurrently on its connection in every round,
+// so the cross-shard fan-out costs a single round trip time.
+// Options of the shard apply to its connection: WithoutCancel to its rounds, WithStrictBatching to its queries.
+// The batch runs at most the least WithMaxConcurrentCallbacks of shards callbacks at once
+func (m *MultiDB) SendBatch(ctx context.Context, b *Batch) (err error) {
+	if b == nil {
+		return errors.New("batch must be not nil")
+	}
+	if inBatch(ctx) {
+		return errors.New("don't support nested batch")
+	}
+
+	for _, shard := range m.shards {
+		exit := shard.enterBatch(ctx)
+		defer exit()
+	}
+
+	mc := &multiConns{
+		m:     m,
+		br:    newBatchRunner(nil, m.maxConcurrentCallbacks()),
+		conns: nil,
+	}
+	defer func() {
+		err = errors.Join(err, mc.close())
+	}()
+
+	return mc.br.run(setMultiConnsToContext(ctx, mc), b)
+}
+
+// multiConns are batch connections of shards opened by callbacks of MultiDB.SendBatch, they share the runner
+type multiConns struct {
+	m     *MultiDB
+	br    *batchRunner
+	mu    sync.Mutex
+	conns []*BatchConn
+}
+
+// conn returns the batch connection of the shard bdb, it's opened on the first query of the shard
+func (mc *multiConns) conn(ctx context.Context, bdb *BatchDB) (*BatchConn, error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	for _, bc := range mc.conns {
+		if bc.db.originDB() == bdb.originDB() {
+			return bc, nil
+		}
+	}
+
+	shard, ok := mc.m.shardOf(bdb)
+	if !ok {
+		return nil, fmt.Errorf("%w: BatchDB is not a shard of MultiDB", ErrForeignBatchConn)
+	}
+
+	conn, err := shard.DB.Connx(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("db.Conn(ctx): %w", err)
+	}
+
+	bc := newBatchConn(shard, shard.DB, conn)
+	bc.br = mc.br
+	bc.multi = mc
+	mc.conns = append(mc.conns, bc)
+
+	return bc, nil
+}
+
+func (mc *multiConns) close() (err error) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	for _, bc := range mc.conns {
+		bc.br = nil
+		err = errors.Join(err, bc.Close())
+	}
+	mc.conns = nil
+
+	return err
+}
+
+type contextKeyMultiConnsType struct{}
+
+var contextKeyMultiConns = contextKeyMultiConnsType{}
+
+func multiConnsFromContext(ctx context.Context) *multiConns {
+	mc, _ := ctx.Value(contextKeyMultiConns).(*multiConns)
+	return mc
+}
+
+func setMultiConnsToContext(ctx context.Context, mc *multiConns) context.Context {
+	return context.WithValue(ctx, contextKeyMultiConns, mc)
+}
+
+// inBatch reports whether ctx is the context of a running batch of any BatchDB or MultiDB
+func inBatch(ctx context.Context) bool {
+	return BatchConnFromContext(ctx) != nil || multiConnsFromContext(ctx) != nil
+}
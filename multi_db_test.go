@@ -0,0 +1,132 @@
+package dbbatch
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMultiDB_SendBatch(t *testing.T) {
+	ctx := context.Background()
+
+	shardA, shardB := New(newNoopDB(t)), New(newNoopDB(t))
+	m := NewMultiDB(map[string]*BatchDB{"a": shardA, "b": shardB})
+
+	assert.Same(t, shardA, m.Shard("a"))
+	assert.Nil(t, m.Shard("c"))
+
+	t.Run("nil batch", func(t *testing.T) {
+		err := m.SendBatch(ctx, nil)
+		assert.EqualError(t, err, "batch must be not nil")
+	})
+
+	t.Run("not a shard", func(t *testing.T) {
+		other := New(newNoopDB(t))
+
+		var queryErr error
+		b := &Batch{}
+		b.Add(func(ctx context.Context) error {
+			_, queryErr = other.ExecContext(ctx, "update items set name = $1", "x")
+			return nil
+		})
+
+		err := m.SendBatch(ctx, b)
+		require.NoError(t, err)
+		assert.ErrorIs(t, queryErr, ErrForeignBatchConn)
+	})
+
+	t.Run("shard connections", func(t *testing.T) {
+		var mc *multiConns
+		var connA, connA2, connB *BatchConn
+
+		b := &Batch{}
+		b.Add(func(ctx context.Context) (err error) {
+			mc = multiConnsFromContext(ctx)
+			connA, err = shardA.ownBatchConn(ctx)
+			if err != nil {
+				return err
+			}
+			connA2, err = shardA.With(WithBufferedRows(0)).ownBatchConn(ctx)
+			return err
+		})
+		b.Add(func(ctx context.Context) (err error) {
+			connB, err = m.Shard("b").ownBatchConn(ctx)
+			return err
+		})
+
+		err := m.SendBatch(ctx, b)
+		require.NoError(t, err)
+
+		require.NotNil(t, connA)
+		require.NotNil(t, connB)
+		assert.Same(t, connA, connA2)
+		assert.Same(t, shardA, connA.db)
+		assert.Same(t, shardB, connB.db)
+		assert.True(t, connA.done)
+		assert.True(t, connB.done)
+		assert.Empty(t, mc.conns)
+	})
+
+	t.Run("nested batch", func(t *testing.T) {
+		var nestedErr error
+		b := &Batch{}
+		b.Add(func(ctx context.Context) error {
+			nestedErr = shardA.SendBatch(ctx, &Batch{})
+			return nil
+		})
+
+		err := m.SendBatch(ctx, b)
+		require.NoError(t, err)
+		assert.ErrorIs(t, nestedErr, ErrHasRunningBatch)
+	})
+}
+
+func TestBatchDB_ownBatchConn(t *testing.T) {
+	ctx := context.Background()
+
+	bdb := New(newNoopDB(t))
+	bc := &BatchConn{db: bdb}
+
+	t.Run("own connection", func(t *testing.T) {
+		got, err := bdb.ownBatchConn(SetBatchConnToContext(ctx, bc))
+		require.NoError(t, err)
+		assert.Same(t, bc, got)
+
+		got, err = bdb.With(WithStrictBatching()).ownBatchConn(SetBatchConnToContext(ctx, bc))
+		require.NoError(t, err)
+		assert.Same(t, bc, got)
+	})
+
+	t.Run("without batch", func(t *testing.T) {
+		got, err := bdb.ownBatchConn(ctx)
+		require.NoError(t, err)
+		assert.Nil(t, got)
+	})
+
+	t.Run("connection of another BatchDB", func(t *testing.T) {
+		other := New(bdb.DB)
+		ctx := SetBatchConnToContext(ctx, bc)
+
+		var name string
+		err := other.GetContext(ctx, &name, "select name from items")
+		assert.ErrorIs(t, err, ErrForeignBatchConn)
+
+		_, err = other.ExecContext(ctx, "update items set name = $1", "x")
+		assert.ErrorIs(t, err, ErrForeignBatchConn)
+
+		err = other.QueryRowContext(ctx, "select name from items").Scan(&name)
+		assert.ErrorIs(t, err, ErrForeignBatchConn)
+
+		err = other.QueryRowxContext(ctx, "select name from items").Scan(&name)
+		assert.ErrorIs(t, err, ErrForeignBatchConn)
+
+		err = other.SendBatch(ctx, &Batch{})
+		assert.ErrorIs(t, err, ErrForeignBatchConn)
+
+		_, err = other.BeginTx(ctx, &sql.TxOptions{})
+		assert.ErrorIs(t, err, ErrTxNotSupported)
+	})
+}
@@ -0,0 +1,408 @@
+package multistmt
+
+import (
+	"database/sql/driver"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/inna-maikut/dbbatch"
+)
+
+// markerColumn is the name of the column of the marker result set following every request
+const markerColumn = "dbbatch_marker"
+
+// Dialect builds the multi-statement query of the round and reads results of requests.
+// Use Postgres or MySQL
+type Dialect interface {
+	// interpolate replaces placeholders of the query with literals of args
+	interpolate(query string, args []driver.Value) (string, error)
+	// marker returns the statement returning one row with the index of the request,
+	// its result set separates results of requests
+	marker(i int) string
+	// markerResult returns the result of the request from the row of its marker
+	markerResult(row []driver.Value) (driver.Result, error)
+	// bindType returns the type of placeholders for dbbatch.RegisterDriver
+	bindType() int
+	// rollsBackRound reports whether the error of the request rolls back previous requests of the round
+	rollsBackRound() bool
+	// commitCheck returns the statement queued before COMMIT, which fails in the failed transaction.
+	// Empty if errors don't fail transactions
+	commitCheck() string
+}
+
+var (
+	// Postgres is the dialect of PostgreSQL drivers like lib/pq with $1 placeholders.
+	// Rows affected and last insert id are unknown in the multi-statement query
+	Postgres Dialect = postgres{}
+	// MySQL is the dialect of MySQL drivers like go-sql-driver/mysql with ? placeholders,
+	// the server must allow multi statements. Times are sent in UTC
+	MySQL Dialect = mysql{}
+)
+
+// ErrResultNotSupported is returned by RowsAffected and LastInsertId of the request in Postgres dialect
+var ErrResultNotSupported = errors.New("result of the query is not supported in multi-statement batch")
+
+type postgres struct{}
+
+func (postgres) interpolate(query string, args []driver.Value) (string, error) {
+	var sb strings.Builder
+	sb.Grow(len(query))
+
+	used := 0
+	for i := 0; i < len(query); {
+		c := query[i]
+		end := i + 1
+
+		switch {
+		case c == '\'':
+			escape := i > 0 && (query[i-1] == 'e' || query[i-1] == 'E') && (i < 2 || !isIdentChar(query[i-2]))
+			end = quotedEnd(query, i, '\'', escape)
+		case c == '"':
+			end = quotedEnd(query, i, '"', false)
+		case c == '-' && strings.HasPrefix(query[i:], "--"):
+			end = lineEnd(query, i)
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			end = blockCommentEnd(query, i, true)
+		case c == '$' && (i == 0 || !isIdentChar(query[i-1])):
+			if n, numEnd := placeholder(query, i+1); numEnd > i+1 {
+				if n < 1 || n > len(args) {
+					return "", fmt.Errorf("placeholder $%d of %d args, query: %s", n, len(args), query)
+				}
+				literal, err := postgresLiteral(args[n-1])
+				if err != nil {
+					return "", fmt.Errorf("arg $%d: %w", n, err)
+				}
+				sb.WriteString(literal)
+				if n > used {
+					used = n
+				}
+				i = numEnd
+				continue
+			}
+			end = dollarQuotedEnd(query, i)
+		}
+
+		sb.WriteString(query[i:end])
+		i = end
+	}
+	if used != len(args) {
+		return "", fmt.Errorf("query uses %d of %d args, query: %s", used, len(args), query)
+	}
+
+	return sb.String(), nil
+}
+
+func (postgres) marker(i int) string {
+	return "select " + strconv.Itoa(i) + " as " + markerColumn
+}
+
+func (postgres) markerResult([]driver.Value) (driver.Result, error) {
+	return postgresResult{}, nil
+}
+
+func (postgres) bindType() int {
+	return dbbatch.BindDollar
+}
+
+// rollsBackRound is true, the multi-statement query runs in the implicit transaction
+func (postgres) rollsBackRound() bool {
+	return true
+}
+
+// commitCheck fails in the failed transaction, otherwise COMMIT rolls it back without error,
+// the command tag isn't visible in the multi-statement query
+func (postgres) commitCheck() string {
+	return "select where false"
+}
+
+type postgresResult struct{}
+
+func (postgresResult) LastInsertId() (int64, error) {
+	return 0, ErrResultNotSupported
+}
+
+func (postgresResult) RowsAffected() (int64, error) {
+	return 0, ErrResultNotSupported
+}
+
+// postgresLiteral returns the literal of the value converted by driver.DefaultParameterConverter.
+// Strings are escaped as E'...' literals, so they don't depend on standard_conforming_strings
+func postgresLiteral(v driver.Value) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "null", nil
+	case int64:
+		return signed(strconv.FormatInt(v, 10)), nil
+	case float64:
+		switch {
+		case math.IsNaN(v):
+			return "'NaN'::float8", nil
+		case math.IsInf(v, 1):
+			return "'Infinity'::float8", nil
+		case math.IsInf(v, -1):
+			return "'-Infinity'::float8", nil
+		}
+		return signed(strconv.FormatFloat(v, 'g', -1, 64)), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case []byte:
+		return `E'\\x` + hex.EncodeToString(v) + "'::bytea", nil
+	case string:
+		if strings.IndexByte(v, 0) >= 0 {
+			return "", errors.New("string contains zero byte")
+		}
+		v = strings.ReplaceAll(v, `\`, `\\`)
+		v = strings.ReplaceAll(v, `'`, `''`)
+		return "E'" + v + "'", nil
+	case time.Time:
+		if v.Year() < 1 || v.Year() > 9999 {
+			return "", fmt.Errorf("time %s is out of range", v)
+		}
+		return "'" + v.Format("2006-01-02 15:04:05.999999Z07:00:00") + "'", nil
+	default:
+		return "", fmt.Errorf("unsupported type %T", v)
+	}
+}
+
+type mysql struct{}
+
+func (mysql) interpolate(query string, args []driver.Value) (string, error) {
+	var sb strings.Builder
+	sb.Grow(len(query))
+
+	used := 0
+	for i := 0; i < len(query); {
+		c := query[i]
+		end := i + 1
+
+		switch {
+		case c == '\'' || c == '"':
+			end = quotedEnd(query, i, c, true)
+		case c == '`':
+			end = quotedEnd(query, i, '`', false)
+		case c == '#':
+			end = lineEnd(query, i)
+		case c == '-' && strings.HasPrefix(query[i:], "--") && (i+2 == len(query) || query[i+2] <= ' '):
+			end = lineEnd(query, i)
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			end = blockCommentEnd(query, i, false)
+		case c == '?':
+			if used == len(args) {
+				return "", fmt.Errorf("query has more placeholders than %d args, query: %s", len(args), query)
+			}
+			literal, err := mysqlLiteral(args[used])
+			if err != nil {
+				return "", fmt.Errorf("arg %d: %w", used+1, err)
+			}
+			sb.WriteString(literal)
+			used++
+			i = end
+			continue
+		}
+
+		sb.WriteString(query[i:end])
+		i = end
+	}
+	if used != len(args) {
+		return "", fmt.Errorf("query uses %d of %d args, query: %s", used, len(args), query)
+	}
+
+	return sb.String(), nil
+}
+
+func (mysql) marker(i int) string {
+	return "select " + strconv.Itoa(i) + " as " + markerColumn + ", row_count(), last_insert_id()"
+}
+
+func (mysql) markerResult(row []driver.Value) (driver.Result, error) {
+	if len(row) != 3 {
+		return nil, fmt.Errorf("marker row has %d values, expected 3", len(row))
+	}
+	rowsAffected, err := intValue(row[1])
+	if err != nil {
+		return nil, fmt.Errorf("row_count(): %w", err)
+	}
+	lastInsertID, err := intValue(row[2])
+	if err != nil {
+		return nil, fmt.Errorf("last_insert_id(): %w", err)
+	}
+
+	if rowsAffected < 0 {
+		// row_count() is -1 after a statement returning rows
+		rowsAffected = 0
+	}
+
+	return mysqlResult{rowsAffected: rowsAffected, lastInsertID: lastInsertID}, nil
+}
+
+func (mysql) bindType() int {
+	return dbbatch.BindQuestion
+}
+
+// rollsBackRound is false, every statement of the multi-statement query is committed on its own in autocommit mode
+func (mysql) rollsBackRound() bool {
+	return false
+}
+
+func (mysql) commitCheck() string {
+	return ""
+}
+
+type mysqlResult struct {
+	rowsAffected int64
+	lastInsertID int64
+}
+
+// LastInsertId returns last_insert_id() of the connection after the statement
+func (r mysqlResult) LastInsertId() (int64, error) {
+	return r.lastInsertID, nil
+}
+
+func (r mysqlResult) RowsAffected() (int64, error) {
+	return r.rowsAffected, nil
+}
+
+// mysqlLiteral returns the literal of the value converted by driver.DefaultParameterConverter.
+// Strings are sent as hex literals, so they don't depend on NO_BACKSLASH_ESCAPES
+func mysqlLiteral(v driver.Value) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "null", nil
+	case int64:
+		return signed(strconv.FormatInt(v, 10)), nil
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return "", fmt.Errorf("float %v is not supported", v)
+		}
+		return signed(strconv.FormatFloat(v, 'g', -1, 64)), nil
+	case bool:
+		if v {
+			return "1", nil
+		}
+		return "0", nil
+	case []byte:
+		return "X'" + hex.EncodeToString(v) + "'", nil
+	case string:
+		return "_utf8mb4 X'" + hex.EncodeToString([]byte(v)) + "'", nil
+	case time.Time:
+		if v.IsZero() {
+			return "'0000-00-00'", nil
+		}
+		return "'" + v.UTC().Format("2006-01-02 15:04:05.999999") + "'", nil
+	default:
+		return "", fmt.Errorf("unsupported type %T", v)
+	}
+}
+
+// signed wraps negative numbers in parentheses, so "x-$1" doesn't become a comment
+func signed(s string) string {
+	if strings.HasPrefix(s, "-") {
+		return "(" + s + ")"
+	}
+	return s
+}
+
+func intValue(v driver.Value) (int64, error) {
+	switch v := v.(type) {
+	case int64:
+		return v, nil
+	case []byte:
+		return strconv.ParseInt(string(v), 10, 64)
+	case string:
+		return strconv.ParseInt(v, 10, 64)
+	default:
+		return 0, fmt.Errorf("unexpected type %T", v)
+	}
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// quotedEnd returns the end of the quoted string or identifier starting at i.
+// Doubled quote is the escaped quote, backslash escapes the next char if escape is set
+func quotedEnd(query string, i int, quote byte, escape bool) int {
+	for j := i + 1; j < len(query); j++ {
+		switch {
+		case escape && query[j] == '\\':
+			j++
+		case query[j] == quote:
+			if j+1 < len(query) && query[j+1] == quote {
+				j++
+				continue
+			}
+			return j + 1
+		}
+	}
+	return len(query)
+}
+
+func lineEnd(query string, i int) int {
+	if j := strings.IndexByte(query[i:], '\n'); j >= 0 {
+		return i + j + 1
+	}
+	return len(query)
+}
+
+// blockCommentEnd returns the end of /* */ comment starting at i, PostgreSQL comments can be nested
+func blockCommentEnd(query string, i int, nested bool) int {
+	depth := 0
+	for j := i; j+1 < len(query); j++ {
+		switch {
+		case query[j] == '/' && query[j+1] == '*':
+			if depth == 0 || nested {
+				depth++
+			}
+			j++
+		case query[j] == '*' && query[j+1] == '/':
+			depth--
+			j++
+			if depth == 0 {
+				return j + 1
+			}
+		}
+	}
+	return len(query)
+}
+
+// placeholder parses the number of $N placeholder starting at i
+func placeholder(query string, i int) (n, end int) {
+	end = i
+	for end < len(query) && query[end] >= '0' && query[end] <= '9' {
+		end++
+	}
+	if end == i {
+		return 0, i
+	}
+	n, err := strconv.Atoi(query[i:end])
+	if err != nil {
+		return -1, end
+	}
+	return n, end
+}
+
+// dollarQuotedEnd returns the end of $tag$...$tag$ string starting at i, or i+1 if it's not a dollar quote
+func dollarQuotedEnd(query string, i int) int {
+	j := i + 1
+	for j < len(query) && query[j] != '$' {
+		c := query[j]
+		if !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80 || j > i+1 && c >= '0' && c <= '9') {
+			return i + 1
+		}
+		j++
+	}
+	if j == len(query) {
+		return i + 1
+	}
+
+	tag := query[i : j+1]
+	if k := strings.Index(query[j+1:], tag); k >= 0 {
+		return j + 1 + k + len(tag)
+	}
+	return len(query)
+}
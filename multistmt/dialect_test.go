@@ -0,0 +1,101 @@
+package multistmt
+
+import (
+	"database/sql/driver"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostgres_interpolate(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 10, 20, 30, 123456000, time.FixedZone("", 3*3600))
+
+	tests := []struct {
+		name  string
+		query string
+		args  []driver.Value
+		want  string
+	}{
+		{
+			name:  "values",
+			query: "insert into t values ($1, $2, $3, $4, $5, $6, $7)",
+			args:  []driver.Value{int64(-1), 1.5, true, nil, []byte{0x01, 0xab}, "it's \\", ts},
+			want: `insert into t values ((-1), 1.5, true, null, E'\\x01ab'::bytea, E'it''s \\', ` +
+				`'2024-05-01 10:20:30.123456+03:00:00')`,
+		},
+		{
+			name:  "repeated placeholder",
+			query: "select $1 where $1 > x-$2",
+			args:  []driver.Value{int64(1), int64(-2)},
+			want:  "select 1 where 1 > x-(-2)",
+		},
+		{
+			name:  "float special values",
+			query: "select $1, $2",
+			args:  []driver.Value{math.NaN(), math.Inf(-1)},
+			want:  "select 'NaN'::float8, '-Infinity'::float8",
+		},
+		{
+			name: "placeholders in literals and comments",
+			query: `select '$1', E'\'$1', "$1", $$ $1 $$, $tag$ $1 $tag$, a$1 -- $1
+				/* $1 /* $1 */ $1 */ from t where x = $1`,
+			args: []driver.Value{"v"},
+			want: `select '$1', E'\'$1', "$1", $$ $1 $$, $tag$ $1 $tag$, a$1 -- $1
+				/* $1 /* $1 */ $1 */ from t where x = E'v'`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Postgres.interpolate(tt.query, tt.args)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := Postgres.interpolate("select $2", []driver.Value{int64(1)})
+		assert.EqualError(t, err, "placeholder $2 of 1 args, query: select $2")
+
+		_, err = Postgres.interpolate("select $1", []driver.Value{int64(1), int64(2)})
+		assert.EqualError(t, err, "query uses 1 of 2 args, query: select $1")
+
+		_, err = Postgres.interpolate("select $1", []driver.Value{"a\x00b"})
+		assert.EqualError(t, err, "arg $1: string contains zero byte")
+	})
+}
+
+func TestMySQL_interpolate(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 10, 20, 30, 123456000, time.FixedZone("", 3*3600))
+
+	got, err := MySQL.interpolate(
+		"insert into t values (?, ?, ?, ?, ?, ?, ?) -- ?\n# ?\n/* ? */ on duplicate key update s = '?\\'?', `?` = \"?\"",
+		[]driver.Value{int64(-1), 1.5, true, nil, []byte{0x01, 0xab}, "it's", ts},
+	)
+	require.NoError(t, err)
+	assert.Equal(t,
+		"insert into t values ((-1), 1.5, 1, null, X'01ab', _utf8mb4 X'69742773', '2024-05-01 07:20:30.123456') -- ?\n"+
+			"# ?\n/* ? */ on duplicate key update s = '?\\'?', `?` = \"?\"",
+		got)
+
+	_, err = MySQL.interpolate("select ?, ?", []driver.Value{int64(1)})
+	assert.EqualError(t, err, "query has more placeholders than 1 args, query: select ?, ?")
+
+	_, err = MySQL.interpolate("select ?", []driver.Value{math.Inf(1)})
+	assert.EqualError(t, err, "arg 1: float +Inf is not supported")
+}
+
+func TestMySQL_markerResult(t *testing.T) {
+	res, err := MySQL.markerResult([]driver.Value{[]byte("0"), []byte("-1"), int64(7)})
+	require.NoError(t, err)
+
+	rowsAffected, err := res.RowsAffected()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), rowsAffected)
+
+	lastInsertID, err := res.LastInsertId()
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), lastInsertID)
+}
@@ -0,0 +1,281 @@
+// Package multistmt is the batch driver wrapper for drivers without pipelining, like lib/pq and go-sql-driver/mysql.
+// Requests of the round are interpolated into one multi-statement simple query, so the round costs one round trip
+package multistmt
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/inna-maikut/dbbatch"
+)
+
+var (
+	_ driver.Driver               = &Driver{}
+	_ driver.DriverContext        = &Driver{}
+	_ driver.Conn                 = &Conn{}
+	_ driver.ConnPrepareContext   = &Conn{}
+	_ driver.ConnBeginTx          = &Conn{}
+	_ driver.ExecerContext        = &Conn{}
+	_ driver.QueryerContext       = &Conn{}
+	_ driver.Pinger               = &Conn{}
+	_ driver.SessionResetter      = &Conn{}
+	_ driver.Validator            = &Conn{}
+	_ driver.NamedValueChecker    = &Conn{}
+	_ dbbatch.BatchRequestsSender = &Conn{}
+)
+
+// Register registers the wrapper of the base driver with the name and binds the placeholders of the dialect for sqlx
+//
+//	multistmt.Register("batch_pq", &pq.Driver{}, multistmt.Postgres)
+func Register(name string, base driver.Driver, dialect Dialect) {
+	dbbatch.RegisterDriver(name, Wrap(base, dialect), dialect.bindType())
+}
+
+// Wrap returns the driver sending batches of dbbatch as multi-statement queries of the base driver.
+// Conns of the base driver must implement driver.QueryerContext with rows of driver.RowsNextResultSet
+func Wrap(base driver.Driver, dialect Dialect) *Driver {
+	return &Driver{base: base, dialect: dialect}
+}
+
+type Driver struct {
+	base    driver.Driver
+	dialect Dialect
+}
+
+func (d *Driver) Open(name string) (driver.Conn, error) {
+	conn, err := d.base.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{base: conn, dialect: d.dialect}, nil
+}
+
+func (d *Driver) OpenConnector(name string) (driver.Connector, error) {
+	if baseDriverContext, ok := d.base.(driver.DriverContext); ok {
+		base, err := baseDriverContext.OpenConnector(name)
+		if err != nil {
+			return nil, err
+		}
+		return &connector{base: base, driver: d}, nil
+	}
+
+	return &connector{base: nil, driver: d, name: name}, nil
+}
+
+type connector struct {
+	base   driver.Connector // nil if the base driver isn't driver.DriverContext
+	driver *Driver
+	name   string
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	if c.base == nil {
+		return c.driver.Open(c.name)
+	}
+
+	conn, err := c.base.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{base: conn, dialect: c.driver.dialect}, nil
+}
+
+func (c *connector) Driver() driver.Driver {
+	return c.driver
+}
+
+type Conn struct {
+	base    driver.Conn
+	dialect Dialect
+}
+
+// SendBatchRequests sends requests as one multi-statement query and reads all results into memory
+func (c *Conn) SendBatchRequests(ctx context.Context, requests []dbbatch.Request) (res any, closeFn func() error, err error) {
+	queryer, ok := c.base.(driver.QueryerContext)
+	if !ok {
+		return nil, nil, errors.New("conn of the base driver is not driver.QueryerContext")
+	}
+
+	query, err := c.batchQuery(requests)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	driverRows, err := queryer.QueryContext(ctx, query, nil)
+	if errors.Is(err, driver.ErrBadConn) {
+		return nil, nil, err
+	}
+
+	br := &batchResult{
+		results: readResults(c.dialect, driverRows, err, len(requests)),
+	}
+
+	return br, func() error { return nil }, nil
+}
+
+// batchQuery joins interpolated requests, every request is followed by its marker
+func (c *Conn) batchQuery(requests []dbbatch.Request) (string, error) {
+	var sb strings.Builder
+	for i, request := range requests {
+		if request.Names != nil {
+			return "", fmt.Errorf("named args are not supported in multi-statement batch, query: %s", request.Query)
+		}
+
+		args := make([]driver.Value, len(request.Args))
+		for j, arg := range request.Args {
+			v, err := driver.DefaultParameterConverter.ConvertValue(arg)
+			if err != nil {
+				return "", fmt.Errorf("arg %d: %w, query: %s", j+1, err, request.Query)
+			}
+			args[j] = v
+		}
+
+		query, err := c.dialect.interpolate(request.Query, args)
+		if err != nil {
+			return "", err
+		}
+
+		if check := c.dialect.commitCheck(); check != "" && isCommit(query) {
+			sb.WriteString(check)
+			sb.WriteString(";\n")
+		}
+		// the new line ends a comment in the end of the query, empty statements are errors in MySQL
+		sb.WriteString(strings.TrimRight(query, " \t\r\n;"))
+		sb.WriteString("\n;")
+		sb.WriteString(c.dialect.marker(i))
+		sb.WriteString(";\n")
+	}
+
+	return sb.String(), nil
+}
+
+// isCommit reports whether the query is COMMIT statement
+func isCommit(query string) bool {
+	fields := strings.Fields(strings.TrimRight(query, "; \t\r\n"))
+	return len(fields) > 0 && (strings.EqualFold(fields[0], "commit") || strings.EqualFold(fields[0], "end"))
+}
+
+// batchResult returns the result of the request in the running round of ctx, nil without batch
+func (c *Conn) batchResult(ctx context.Context) (*requestResult, error) {
+	bc := dbbatch.BatchConnFromContext(ctx)
+	if bc == nil || bc.BatchRunner() == nil {
+		return nil, nil
+	}
+
+	res := bc.BatchRunner().Result()
+	br, ok := res.(*batchResult)
+	if !ok {
+		return nil, fmt.Errorf("unknown type of multi-statement batch result: %+v", res)
+	}
+
+	rr, err := br.nextResult()
+	if err != nil {
+		return nil, err
+	}
+	return &rr, nil
+}
+
+func (c *Conn) ExecContext(ctx context.Context, query string, argsV []driver.NamedValue) (driver.Result, error) {
+	rr, err := c.batchResult(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if rr == nil {
+		if execer, ok := c.base.(driver.ExecerContext); ok {
+			return execer.ExecContext(ctx, query, argsV)
+		}
+		return nil, driver.ErrSkip
+	}
+
+	if rr.err != nil {
+		return nil, rr.err
+	}
+	return rr.result, nil
+}
+
+func (c *Conn) QueryContext(ctx context.Context, query string, argsV []driver.NamedValue) (driver.Rows, error) {
+	rr, err := c.batchResult(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if rr == nil {
+		if queryer, ok := c.base.(driver.QueryerContext); ok {
+			return queryer.QueryContext(ctx, query, argsV)
+		}
+		return nil, driver.ErrSkip
+	}
+
+	if rr.err != nil {
+		return nil, rr.err
+	}
+	if rr.rows == nil {
+		// the statement without rows
+		return &rows{}, nil
+	}
+	return rr.rows, nil
+}
+
+func (c *Conn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *Conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if dbbatch.BatchConnFromContext(ctx) != nil {
+		return nil, errors.New("prepared statements not supported in batch")
+	}
+
+	if preparer, ok := c.base.(driver.ConnPrepareContext); ok {
+		return preparer.PrepareContext(ctx, query)
+	}
+	return c.base.Prepare(query)
+}
+
+func (c *Conn) Close() error {
+	return c.base.Close()
+}
+
+func (c *Conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *Conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if dbbatch.BatchConnFromContext(ctx) != nil {
+		return nil, errors.New("transactions are not supported in batch")
+	}
+
+	if beginner, ok := c.base.(driver.ConnBeginTx); ok {
+		return beginner.BeginTx(ctx, opts)
+	}
+	return c.base.Begin() //nolint:staticcheck
+}
+
+func (c *Conn) Ping(ctx context.Context) error {
+	if pinger, ok := c.base.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *Conn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.base.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *Conn) IsValid() bool {
+	if validator, ok := c.base.(driver.Validator); ok {
+		return validator.IsValid()
+	}
+	return true
+}
+
+func (c *Conn) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := c.base.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
@@ -0,0 +1,212 @@
+package multistmt
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/inna-maikut/dbbatch"
+)
+
+// resultSet is the result set of the fake multi-statement query, err is returned after its rows
+type resultSet struct {
+	columns []string
+	values  [][]driver.Value
+	err     error
+}
+
+// fakeDriver answers multi-statement queries with scripted result sets like lib/pq,
+// result sets of statements without rows are skipped
+type fakeDriver struct {
+	mu      sync.Mutex
+	sets    []resultSet
+	queries []string
+}
+
+func (d *fakeDriver) Open(string) (driver.Conn, error) { return &fakeConn{d: d}, nil }
+
+func (d *fakeDriver) script(sets ...resultSet) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.sets = sets
+	d.queries = nil
+}
+
+type fakeConn struct {
+	d *fakeDriver
+}
+
+func (c *fakeConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not implemented") }
+func (c *fakeConn) Close() error                        { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)           { return nil, errors.New("not implemented") }
+
+func (c *fakeConn) QueryContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Rows, error) {
+	c.d.mu.Lock()
+	defer c.d.mu.Unlock()
+	c.d.queries = append(c.d.queries, query)
+	return &fakeRows{sets: c.d.sets}, nil
+}
+
+type fakeRows struct {
+	sets []resultSet
+	row  int
+}
+
+func (r *fakeRows) Columns() []string { return r.sets[0].columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	set := r.sets[0]
+	if r.row < len(set.values) {
+		copy(dest, set.values[r.row])
+		r.row++
+		return nil
+	}
+	if set.err != nil {
+		return set.err
+	}
+	return io.EOF
+}
+
+func (r *fakeRows) HasNextResultSet() bool { return len(r.sets) > 1 }
+
+func (r *fakeRows) NextResultSet() error {
+	if len(r.sets) < 2 {
+		return io.EOF
+	}
+	r.sets = r.sets[1:]
+	r.row = 0
+	return nil
+}
+
+func marker(i int64) resultSet {
+	return resultSet{columns: []string{markerColumn}, values: [][]driver.Value{{i}}}
+}
+
+var pgFake = &fakeDriver{}
+
+func init() {
+	Register("multistmt_fake_pg", pgFake, Postgres)
+}
+
+func TestConn_SendBatchRequests(t *testing.T) {
+	ctx := context.Background()
+
+	sqlxDB, err := sqlx.Open("multistmt_fake_pg", "")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = sqlxDB.Close()
+	})
+	db := dbbatch.New(sqlxDB)
+
+	assert.True(t, db.SupportsBatching())
+
+	t.Run("results", func(t *testing.T) {
+		pgFake.script(
+			marker(0),
+			resultSet{columns: []string{"name"}, values: [][]driver.Value{{"first"}, {"second"}}},
+			marker(1),
+		)
+
+		var names []string
+		b := &dbbatch.Batch{}
+		b.Add(func(ctx context.Context) error {
+			res, err := db.ExecContext(ctx, "update items set name = $1 where id = $2;", "it's", 1)
+			if err != nil {
+				return err
+			}
+			_, err = res.RowsAffected()
+			assert.ErrorIs(t, err, ErrResultNotSupported)
+			return nil
+		})
+		b.Add(func(ctx context.Context) error {
+			return db.SelectContext(ctx, &names, "select name from items -- all")
+		})
+
+		err := db.SendBatch(ctx, b)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"first", "second"}, names)
+		assert.Equal(t, []string{
+			"update items set name = E'it''s' where id = 1\n;select 0 as dbbatch_marker;\n" +
+				"select name from items -- all\n;select 1 as dbbatch_marker;\n",
+		}, pgFake.queries)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		errQuery := errors.New("division by zero")
+		pgFake.script(
+			resultSet{columns: []string{"n"}, values: [][]driver.Value{{int64(1)}}},
+			// the error of the second query comes after the marker of the first one
+			resultSet{columns: []string{markerColumn}, values: [][]driver.Value{{int64(0)}}, err: errQuery},
+		)
+
+		var errs [3]error
+		b := &dbbatch.Batch{}
+		for i := range errs {
+			i := i
+			b.Add(func(ctx context.Context) error {
+				var n int
+				errs[i] = db.GetContext(ctx, &n, "select 1")
+				return nil
+			})
+		}
+
+		err := db.SendBatch(ctx, b)
+		require.NoError(t, err)
+		assert.ErrorIs(t, errs[0], ErrRolledBack)
+		assert.ErrorIs(t, errs[0], errQuery)
+		assert.ErrorIs(t, errs[1], errQuery)
+		assert.NotErrorIs(t, errs[1], ErrRolledBack)
+		assert.NotErrorIs(t, errs[1], ErrSkipped)
+		assert.ErrorIs(t, errs[2], ErrSkipped)
+		assert.ErrorIs(t, errs[2], errQuery)
+	})
+
+	t.Run("interpolation error", func(t *testing.T) {
+		b := &dbbatch.Batch{}
+		b.Add(func(ctx context.Context) error {
+			_, err := db.ExecContext(ctx, "select $1", struct{}{})
+			return err
+		})
+
+		err := db.SendBatch(ctx, b)
+		assert.ErrorContains(t, err, "arg 1: unsupported type struct {}")
+	})
+}
+
+func Test_readResults(t *testing.T) {
+	errQuery := errors.New("duplicate key")
+	driverRows := func() driver.Rows {
+		return &fakeRows{sets: []resultSet{
+			{columns: []string{markerColumn, "row_count()", "last_insert_id()"}, values: [][]driver.Value{{int64(0), int64(1), int64(7)}}},
+			{columns: []string{markerColumn, "row_count()", "last_insert_id()"}, err: errQuery},
+		}}
+	}
+
+	t.Run("mysql commits executed queries", func(t *testing.T) {
+		results := readResults(MySQL, driverRows(), nil, 3)
+		require.Len(t, results, 3)
+		require.NoError(t, results[0].err)
+		rowsAffected, err := results[0].result.RowsAffected()
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), rowsAffected)
+		assert.ErrorIs(t, results[1].err, errQuery)
+		assert.ErrorIs(t, results[2].err, ErrSkipped)
+	})
+
+	t.Run("postgres rolls back executed queries", func(t *testing.T) {
+		results := readResults(Postgres, driverRows(), nil, 3)
+		require.Len(t, results, 3)
+		assert.ErrorIs(t, results[0].err, ErrRolledBack)
+		assert.ErrorIs(t, results[0].err, errQuery)
+		assert.ErrorIs(t, results[1].err, errQuery)
+		assert.ErrorIs(t, results[2].err, ErrSkipped)
+	})
+}
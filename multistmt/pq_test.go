@@ -0,0 +1,158 @@
+package multistmt
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/inna-maikut/dbbatch"
+	"github.com/inna-maikut/dbbatch/internal/pgfake"
+)
+
+func init() {
+	Register("batch_pq", &pq.Driver{}, Postgres)
+}
+
+func pqHandler(query string, _ []any) pgfake.Result {
+	query = strings.TrimSpace(query)
+
+	var i int
+	if _, err := fmt.Sscanf(query, "select %d as dbbatch_marker", &i); err == nil {
+		return pgfake.Result{Columns: []string{markerColumn}, Rows: [][]any{{i}}}
+	}
+
+	switch {
+	case strings.HasPrefix(query, "select name from items where id = "):
+		return pgfake.Result{Columns: []string{"name"}, Rows: [][]any{{"name " + strings.TrimPrefix(query, "select name from items where id = ")}}}
+	case strings.HasPrefix(query, "select name from items"):
+		return pgfake.Result{Columns: []string{"name"}}
+	case strings.HasPrefix(query, "update"):
+		return pgfake.Result{RowsAffected: 2}
+	case strings.HasPrefix(query, "select fail"):
+		return pgfake.Result{Err: &pgfake.Error{Code: "42P01", Message: "relation does not exist"}}
+	}
+	return pgfake.Result{}
+}
+
+func TestDriver_LibPQ(t *testing.T) {
+	ctx := context.Background()
+	server, err := pgfake.Start(pqHandler)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = server.Close()
+	})
+
+	db, err := sqlx.Open("batch_pq", server.DSN())
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	bdb := dbbatch.New(db)
+
+	names := make([]string, 2)
+	var empty []string
+
+	b := &dbbatch.Batch{}
+	b.Add(func(ctx context.Context) error {
+		_, err := bdb.ExecContext(ctx, "update items set name = $1", "x")
+		return err
+	})
+	for i := range names {
+		i := i
+		b.Add(func(ctx context.Context) error {
+			return bdb.GetContext(ctx, &names[i], "select name from items where id = $1", i)
+		})
+	}
+	b.Add(func(ctx context.Context) error {
+		return bdb.SelectContext(ctx, &empty, "select name from items where false")
+	})
+
+	err = bdb.SendBatch(ctx, b)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"name 0", "name 1"}, names)
+	assert.Empty(t, empty)
+	assert.Equal(t, []string{
+		"update items set name = E'x'\n",
+		"select 0 as dbbatch_marker",
+		"\nselect name from items where id = 0\n",
+		"select 1 as dbbatch_marker",
+		"\nselect name from items where id = 1\n",
+		"select 2 as dbbatch_marker",
+		"\nselect name from items where false\n",
+		"select 3 as dbbatch_marker",
+	}, server.Queries())
+
+	t.Run("error", func(t *testing.T) {
+		var name string
+		var errs [3]error
+
+		b := &dbbatch.Batch{}
+		b.Add(func(ctx context.Context) error {
+			errs[0] = bdb.GetContext(ctx, &name, "select name from items where id = $1", 5)
+			return nil
+		})
+		b.Add(func(ctx context.Context) error {
+			_, errs[1] = bdb.ExecContext(ctx, "select fail")
+			return nil
+		})
+		b.Add(func(ctx context.Context) error {
+			_, errs[2] = bdb.ExecContext(ctx, "update items set name = $1", "y")
+			return nil
+		})
+
+		err := bdb.SendBatch(ctx, b)
+		require.NoError(t, err)
+		// the round runs in the implicit transaction, the error rolls back the executed query
+		assert.ErrorIs(t, errs[0], ErrRolledBack)
+
+		var pqErr *pq.Error
+		require.ErrorAs(t, errs[1], &pqErr)
+		assert.Equal(t, pq.ErrorCode("42P01"), pqErr.Code)
+		assert.ErrorIs(t, errs[2], ErrSkipped)
+
+		// the connection is usable after the error
+		err = bdb.GetContext(ctx, &name, "select name from items where id = 6")
+		require.NoError(t, err)
+		assert.Equal(t, "name 6", name)
+	})
+}
+
+func TestDriver_LibPQ_failedTx(t *testing.T) {
+	ctx := context.Background()
+	server, err := pgfake.Start(pqHandler)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = server.Close()
+	})
+
+	db, err := sqlx.Open("batch_pq", server.DSN())
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	bdb := dbbatch.New(db)
+
+	b := &dbbatch.Batch{}
+	b.Add(func(ctx context.Context) error {
+		_, err := bdb.ExecContext(ctx, "update items set name = $1", "x")
+		if err != nil {
+			return err
+		}
+		// the error is ignored, but the transaction is failed on the server
+		_, _ = bdb.ExecContext(ctx, "select fail")
+		return nil
+	})
+
+	// COMMIT of the failed transaction rolls it back without error, the check before COMMIT fails instead
+	err = bdb.SendBatchInTx(ctx, b, nil)
+	var pqErr *pq.Error
+	require.ErrorAs(t, err, &pqErr)
+	assert.Equal(t, pq.ErrorCode("25P02"), pqErr.Code)
+	assert.Equal(t, "rollback", server.Queries()[len(server.Queries())-1])
+}
@@ -0,0 +1,178 @@
+package multistmt
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+var (
+	// ErrSkipped is returned for the request of the round, which wasn't executed after the error of a previous request
+	ErrSkipped = errors.New("query is skipped after the error of a previous query in multi-statement batch")
+	// ErrRolledBack is returned in Postgres dialect for the executed request of the round,
+	// which was rolled back with the implicit transaction after the error of a next request
+	ErrRolledBack = errors.New("query is rolled back after the error of a next query in multi-statement batch")
+)
+
+// requestResult is the result of one request of the round
+type requestResult struct {
+	rows   *rows // nil if the statement returned no rows
+	result driver.Result
+	err    error
+}
+
+// batchResult holds results of all requests of the round in memory
+type batchResult struct {
+	mu      sync.Mutex
+	results []requestResult
+	next    int
+}
+
+// nextResult returns the result of the next request, requests of the round take results in order of queueing
+func (br *batchResult) nextResult() (requestResult, error) {
+	br.mu.Lock()
+	defer br.mu.Unlock()
+
+	if br.next >= len(br.results) {
+		return requestResult{}, errors.New("no result of the query in multi-statement batch")
+	}
+	res := br.results[br.next]
+	br.next++
+
+	return res, nil
+}
+
+// readResults splits result sets of the multi-statement query into results of n requests.
+// Every request is followed by the marker result set, so result sets before the marker belong to the request.
+// Drivers skip result sets of statements without rows, so the marker is the only reliable separator
+func readResults(dialect Dialect, driverRows driver.Rows, queryErr error, n int) []requestResult {
+	results := make([]requestResult, 0, n)
+	fail := func(err error) []requestResult {
+		if dialect.rollsBackRound() {
+			for i := range results {
+				results[i] = requestResult{err: fmt.Errorf("%w: %w", ErrRolledBack, err)}
+			}
+		}
+		results = append(results, requestResult{err: err})
+		for len(results) < n {
+			results = append(results, requestResult{err: fmt.Errorf("%w: %w", ErrSkipped, err)})
+		}
+		return results
+	}
+
+	if queryErr != nil {
+		return fail(queryErr)
+	}
+	defer driverRows.Close()
+
+	multi, ok := driverRows.(driver.RowsNextResultSet)
+	if !ok {
+		return fail(errors.New("driver rows don't support multiple result sets"))
+	}
+
+	var pending *rows
+	for len(results) < n {
+		columns := driverRows.Columns()
+		if len(columns) == 0 || columns[0] != markerColumn {
+			var err error
+			pending, err = bufferRows(driverRows)
+			if err != nil {
+				return fail(err)
+			}
+		} else {
+			marker, err := bufferRows(driverRows)
+			if marker != nil && len(marker.values) == 1 {
+				// the error of the next statement comes while reading the marker
+				result, resultErr := dialect.markerResult(marker.values[0])
+				results = append(results, requestResult{rows: pending, result: result, err: resultErr})
+				pending = nil
+			}
+			if err != nil {
+				return fail(err)
+			}
+			if len(results) == n {
+				break
+			}
+		}
+
+		if err := multi.NextResultSet(); err != nil {
+			if errors.Is(err, io.EOF) {
+				return fail(fmt.Errorf("no result set of the query, %d of %d queries returned results", len(results), n))
+			}
+			return fail(err)
+		}
+	}
+
+	return results
+}
+
+// rows are the rows of one result set in memory, they don't depend on the connection
+type rows struct {
+	columns   []string
+	typeNames []string
+	values    [][]driver.Value
+	next      int
+}
+
+var (
+	_ driver.Rows                           = &rows{}
+	_ driver.RowsColumnTypeDatabaseTypeName = &rows{}
+)
+
+// bufferRows reads the current result set. On error it returns rows read before the error
+func bufferRows(driverRows driver.Rows) (*rows, error) {
+	r := &rows{
+		columns: append([]string(nil), driverRows.Columns()...),
+	}
+	if typed, ok := driverRows.(driver.RowsColumnTypeDatabaseTypeName); ok {
+		r.typeNames = make([]string, len(r.columns))
+		for i := range r.columns {
+			r.typeNames[i] = typed.ColumnTypeDatabaseTypeName(i)
+		}
+	}
+
+	for {
+		dest := make([]driver.Value, len(r.columns))
+		err := driverRows.Next(dest)
+		if errors.Is(err, io.EOF) {
+			return r, nil
+		}
+		if err != nil {
+			return r, err
+		}
+		for i, v := range dest {
+			if b, ok := v.([]byte); ok {
+				// drivers may reuse the buffer
+				dest[i] = append(make([]byte, 0, len(b)), b...)
+			}
+		}
+		r.values = append(r.values, dest)
+	}
+}
+
+func (r *rows) Columns() []string {
+	return r.columns
+}
+
+func (r *rows) ColumnTypeDatabaseTypeName(index int) string {
+	if r.typeNames == nil {
+		return ""
+	}
+	return r.typeNames[index]
+}
+
+func (r *rows) Close() error {
+	r.next = len(r.values)
+	return nil
+}
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.next >= len(r.values) {
+		return io.EOF
+	}
+	copy(dest, r.values[r.next])
+	r.next++
+	return nil
+}
@@ -1,15 +1,72 @@
 package dbbatch
 
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
 type options struct {
-	withoutCancel bool
+	withoutCancel          bool
+	withoutCancelTimeout   time.Duration
+	maxConcurrentCallbacks int
+	replicas               []*sqlx.DB
+	replicaPolicy          ReplicaPolicy
+	bufferedRows           bool
+	bufferedRowsMaxBytes   int
+	hooks                  []Hooks
+	strictBatching         strictBatching
+	sequentialFallback     bool
 }
 
 type Option func(*options)
 
-// WithoutCancel protects all DB methods from cancelling during request
-// Doesn't work for Stmt and Tx
+// WithoutCancel protects all DB methods from cancelling during request.
+// For BatchTx waiting for the connection can be canceled, but after the transaction is started,
+// its statements, batches, commit and rollback use the context without cancel.
+// Doesn't work for methods of sql.Stmt/sqlx.Stmt, only for preparing them
 func WithoutCancel(val bool) Option {
 	return func(o *options) {
 		o.withoutCancel = val
 	}
 }
+
+// WithoutCancelTimeout sets hard cap timeout of the transaction started with WithoutCancel option.
+// Zero value means no timeout
+func WithoutCancelTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.withoutCancelTimeout = timeout
+	}
+}
+
+// WithMaxConcurrentCallbacks limits the number of callbacks running at the same time in one batch.
+// Callbacks beyond the limit start only as earlier ones finish. Zero or negative value means no limit
+func WithMaxConcurrentCallbacks(n int) Option {
+	return func(o *options) {
+		o.maxConcurrentCallbacks = n
+	}
+}
+
+// WithReplicas sets replicas for read batches, see ReadOnly and BatchDB.SendReadBatch
+func WithReplicas(replicas ...*sqlx.DB) Option {
+	return func(o *options) {
+		o.replicas = replicas
+	}
+}
+
+// WithReplicaPolicy sets the policy of choosing the replica for a read batch. ReplicaRoundRobin by default
+func WithReplicaPolicy(policy ReplicaPolicy) Option {
+	return func(o *options) {
+		o.replicaPolicy = policy
+	}
+}
+
+// WithBufferedRows makes the driver read all rows of a batched query into memory,
+// so *sql.Rows stay valid after the callback returns or the round ends.
+// maxBytes limits the size of row values of one query, maxBytes <= 0 means no limit
+func WithBufferedRows(maxBytes int) Option {
+	return func(o *options) {
+		o.bufferedRows = true
+		o.bufferedRowsMaxBytes = maxBytes
+	}
+}
@@ -0,0 +1,30 @@
+package pgx_v4
+
+import (
+	"github.com/jackc/pgproto3/v2"
+	"github.com/jackc/pgx/v4"
+
+	"github.com/inna-maikut/dbbatch/internal/bufrows"
+)
+
+// ErrBufferedRowsTooLarge is returned when rows of the query exceed the limit of dbbatch.WithBufferedRows
+var ErrBufferedRowsTooLarge = bufrows.ErrTooLarge
+
+// driverRows is the part of pgx.Rows used by Rows
+type driverRows = bufrows.Source[pgproto3.FieldDescription]
+
+var (
+	_ driverRows = pgx.Rows(nil)
+	_ driverRows = &bufrows.Rows[pgproto3.FieldDescription]{}
+)
+
+// bufferRows reads all rows into memory and closes them. maxBytes <= 0 means no limit
+func bufferRows(rows pgx.Rows, maxBytes int) (driverRows, error) {
+	return bufrows.Read[pgproto3.FieldDescription](rows, maxBytes, copyField)
+}
+
+// copyField copies Name, it references the buffer of the message
+func copyField(fd pgproto3.FieldDescription) pgproto3.FieldDescription {
+	fd.Name = append([]byte(nil), fd.Name...)
+	return fd
+}
@@ -2,10 +2,10 @@ package pgx_v4
 
 import (
 	"context"
-	"database/sql"
 	"database/sql/driver"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v4"
@@ -16,18 +16,23 @@ import (
 
 var batchPgxDriver *Driver
 
+// ErrNamedArgsNotSupported is returned for sql.NamedArg in batch, pgx v4 has no named args
+var ErrNamedArgsNotSupported = errors.New("named args are not supported by pgx v4")
+
 var (
 	_ driver.DriverContext        = &Driver{}
 	_ driver.Driver               = &Driver{}
 	_ dbbatch.BatchRequestsSender = &Conn{}
+	_ dbbatch.RequestChecker      = &Conn{}
 	_ driver.Conn                 = &Conn{}
 )
 
 func init() {
 	batchPgxDriver = &Driver{}
 
-	sql.Register("batch_pgx", batchPgxDriver)
-	sql.Register("batch_pgx_v4", batchPgxDriver)
+	// sqlx.NewDb(db, "batch_pgx") rebinds queries with $1 placeholders like pgx
+	dbbatch.RegisterDriver("batch_pgx", batchPgxDriver, dbbatch.BindDollar)
+	dbbatch.RegisterDriver("batch_pgx_v4", batchPgxDriver, dbbatch.BindDollar)
 }
 
 // GetDefaultDriver returns the driver initialized in the init function
@@ -95,9 +100,20 @@ type Conn struct {
 	conn *pgx.Conn
 }
 
+// CheckRequest rejects the request before it's queued to the batch, so the error doesn't fail the whole round
+func (c *Conn) CheckRequest(request dbbatch.Request) error {
+	if request.Names != nil {
+		return fmt.Errorf("%w, query: %s", ErrNamedArgsNotSupported, request.Query)
+	}
+	return nil
+}
+
 func (c *Conn) SendBatchRequests(ctx context.Context, requests []dbbatch.Request) (res any, close func() error, err error) {
 	b := pgx.Batch{}
 	for _, request := range requests {
+		if err := c.CheckRequest(request); err != nil {
+			return nil, nil, err
+		}
 		b.Queue(request.Query, request.Args...)
 	}
 
@@ -165,16 +181,11 @@ func (c *Conn) ExecContext(ctx context.Context, query string, argsV []driver.Nam
 		return nil, driver.ErrBadConn
 	}
 
-	args := namedValueToInterface(argsV)
-
 	br := b.BatchRunner()
 	if br == nil {
 		return nil, dbbatch.ErrNoRunningBatch
 	}
-	res := br.Queue(dbbatch.Request{
-		Query: query,
-		Args:  args,
-	})
+	res := br.Result()
 	batchResults, ok := res.(pgx.BatchResults)
 	if !ok {
 		return nil, fmt.Errorf("unknown type of pgx.BatchResults: %+v", res)
@@ -183,6 +194,10 @@ func (c *Conn) ExecContext(ctx context.Context, query string, argsV []driver.Nam
 	if err != nil {
 		return nil, fmt.Errorf("batchResults.Exec: %w", err)
 	}
+	// COMMIT of the failed transaction returns ROLLBACK command tag without error
+	if commandTag.String() == "ROLLBACK" && isCommit(query) {
+		return nil, dbbatch.ErrTxCommitRollback
+	}
 
 	return driver.RowsAffected(commandTag.RowsAffected()), nil
 }
@@ -208,26 +223,29 @@ func (c *Conn) QueryContext(ctx context.Context, query string, argsV []driver.Na
 		return nil, driver.ErrBadConn
 	}
 
-	args := make([]any, 0, len(argsV))
-	args = append(args, namedValueToInterface(argsV)...)
-
 	br := bc.BatchRunner()
 	if br == nil {
 		return nil, dbbatch.ErrNoRunningBatch
 	}
-	res := br.Queue(dbbatch.Request{
-		Query: query,
-		Args:  args,
-	})
+	res := br.Result()
 	batchResults, ok := res.(pgx.BatchResults)
 	if !ok {
 		return nil, fmt.Errorf("unknown type of pgx.BatchResults: %+v", res)
 	}
-	rows, err := batchResults.Query()
+	pgxRows, err := batchResults.Query()
 	if err != nil {
 		return nil, fmt.Errorf("batchResults.Query: %w", err)
 	}
 
+	var rows driverRows = pgxRows
+	if buffered, maxBytes := bc.BufferedRows(); buffered {
+		// rows stay valid after closing of batch results in the end of the round
+		rows, err = bufferRows(pgxRows, maxBytes)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Preload first row because otherwise we won't know what columns are available when database/sql asks.
 	more := rows.Next()
 	if err := rows.Err(); err != nil {
@@ -261,16 +279,10 @@ func (c *Conn) ResetSession(_ context.Context) error {
 
 type rowValueFunc func(src []byte) (driver.Value, error)
 
-func namedValueToInterface(argsV []driver.NamedValue) []any {
-	args := make([]any, 0, len(argsV))
-	for _, v := range argsV {
-		if v.Value != nil {
-			args = append(args, v.Value.(any))
-		} else {
-			args = append(args, nil)
-		}
-	}
-	return args
+// isCommit reports whether the query is COMMIT statement
+func isCommit(query string) bool {
+	fields := strings.Fields(strings.TrimRight(query, "; \t\r\n"))
+	return len(fields) > 0 && (strings.EqualFold(fields[0], "commit") || strings.EqualFold(fields[0], "end"))
 }
 
 func namedValueToDriverValue(argsV []driver.NamedValue) []driver.Value {
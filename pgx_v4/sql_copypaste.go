@@ -11,13 +11,12 @@ import (
 	"time"
 
 	"github.com/jackc/pgtype"
-	"github.com/jackc/pgx/v4"
 )
 
 // Rows is duplicate of pgx/v4/stdlib/sql code. Seems that it's impossible to reuse that code in case of private fields
 type Rows struct {
 	conn         *Conn
-	rows         pgx.Rows
+	rows         driverRows
 	valueFuncs   []rowValueFunc
 	skipNext     bool
 	skipNextMore bool
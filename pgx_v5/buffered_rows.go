@@ -0,0 +1,24 @@
+package pgx_v5
+
+import (
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"github.com/inna-maikut/dbbatch/internal/bufrows"
+)
+
+// ErrBufferedRowsTooLarge is returned when rows of the query exceed the limit of dbbatch.WithBufferedRows
+var ErrBufferedRowsTooLarge = bufrows.ErrTooLarge
+
+// driverRows is the part of pgx.Rows used by Rows
+type driverRows = bufrows.Source[pgconn.FieldDescription]
+
+var (
+	_ driverRows = pgx.Rows(nil)
+	_ driverRows = &bufrows.Rows[pgconn.FieldDescription]{}
+)
+
+// bufferRows reads all rows into memory and closes them. maxBytes <= 0 means no limit
+func bufferRows(rows pgx.Rows, maxBytes int) (driverRows, error) {
+	return bufrows.Read[pgconn.FieldDescription](rows, maxBytes, nil)
+}
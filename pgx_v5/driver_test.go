@@ -0,0 +1,286 @@
+package pgx_v5
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/inna-maikut/dbbatch"
+	"github.com/inna-maikut/dbbatch/internal/pgfake"
+)
+
+func fakeHandler(query string, args []any) pgfake.Result {
+	switch {
+	case strings.HasPrefix(query, "select name"):
+		if args == nil {
+			return pgfake.Result{Columns: []string{"name"}, ParamOIDs: []uint32{pgtype.Int8OID}}
+		}
+		return pgfake.Result{Columns: []string{"name"}, Rows: [][]any{{fmt.Sprintf("name %d", args[0])}}}
+	case strings.HasPrefix(query, "update"):
+		return pgfake.Result{RowsAffected: 2}
+	case strings.HasPrefix(query, "select fail"):
+		return pgfake.Result{Columns: []string{"x"}, Err: &pgfake.Error{Code: "42P01", Message: "relation does not exist"}}
+	}
+	return pgfake.Result{}
+}
+
+func TestDriver_FakeServer(t *testing.T) {
+	ctx := context.Background()
+	server, err := pgfake.Start(fakeHandler)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = server.Close()
+	})
+
+	db, err := sqlx.Open("batch_pgx", server.DSN())
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	bdb := dbbatch.New(db)
+
+	names := make([]string, 3)
+	var affected int64
+
+	b := &dbbatch.Batch{}
+	for i := range names {
+		i := i
+		b.Add(func(ctx context.Context) error {
+			return bdb.GetContext(ctx, &names[i], "select name from items where id = $1", i)
+		})
+	}
+	b.Add(func(ctx context.Context) error {
+		res, err := bdb.ExecContext(ctx, "update items set name = $1", "x")
+		if err != nil {
+			return err
+		}
+		affected, err = res.RowsAffected()
+		return err
+	})
+
+	err = bdb.SendBatch(ctx, b)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"name 0", "name 1", "name 2"}, names)
+	assert.Equal(t, int64(2), affected)
+
+	var name string
+	err = bdb.GetContext(ctx, &name, "select name from items where id = $1", 5)
+	require.NoError(t, err)
+	assert.Equal(t, "name 5", name)
+
+	t.Run("error", func(t *testing.T) {
+		b := &dbbatch.Batch{}
+		b.Add(func(ctx context.Context) error {
+			var x string
+			return bdb.GetContext(ctx, &x, "select fail")
+		})
+
+		err := bdb.SendBatch(ctx, b)
+		assert.ErrorContains(t, err, "relation does not exist (SQLSTATE 42P01)")
+	})
+
+	t.Run("rejected request fails only its callback", func(t *testing.T) {
+		var name string
+		var rejectedErr error
+		b := &dbbatch.Batch{}
+		b.Add(func(ctx context.Context) error {
+			var x string
+			rejectedErr = bdb.GetContext(ctx, &x, "select name from items where id = $1", 1, sql.Named("name", "x"))
+			return nil
+		})
+		b.Add(func(ctx context.Context) error {
+			return bdb.GetContext(ctx, &name, "select name from items where id = $1", 7)
+		})
+
+		err := bdb.SendBatch(ctx, b)
+		require.NoError(t, err)
+		assert.ErrorContains(t, rejectedErr, "mixing named and positional args is not supported")
+		assert.Equal(t, "name 7", name)
+	})
+
+	t.Run("tx", func(t *testing.T) {
+		b := &dbbatch.Batch{}
+		b.Add(func(ctx context.Context) error {
+			_, err := bdb.ExecContext(ctx, "update items set name = $1", "y")
+			return err
+		})
+
+		err := bdb.SendBatchInTx(ctx, b, nil)
+		require.NoError(t, err)
+	})
+
+	t.Run("buffered rows are read after the batch", func(t *testing.T) {
+		bdb := dbbatch.New(db, dbbatch.WithBufferedRows(0))
+
+		rows := make([]*sql.Rows, 2)
+
+		b := &dbbatch.Batch{}
+		for i := range rows {
+			i := i
+			b.Add(func(ctx context.Context) (err error) {
+				rows[i], err = bdb.QueryContext(ctx, "select name from items where id = $1", i)
+				return err
+			})
+		}
+
+		err := bdb.SendBatch(ctx, b)
+		require.NoError(t, err)
+		// rows are read from memory, the connection of the batch is back in the pool
+		assert.Equal(t, 0, db.Stats().InUse)
+
+		for i, r := range rows {
+			require.True(t, r.Next())
+			var name string
+			require.NoError(t, r.Scan(&name))
+			assert.Equal(t, fmt.Sprintf("name %d", i), name)
+			require.NoError(t, r.Close())
+		}
+	})
+}
+
+func TestDriver_FakeServer_commitFails(t *testing.T) {
+	ctx := context.Background()
+	rollbackErr := &pgfake.Error{}
+	server, err := pgfake.Start(func(query string, args []any) pgfake.Result {
+		switch query {
+		case "commit":
+			return pgfake.Result{Err: &pgfake.Error{Code: "40001", Message: "could not serialize access"}}
+		case "rollback":
+			return pgfake.Result{Err: rollbackErr}
+		}
+		return fakeHandler(query, args)
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = server.Close()
+	})
+
+	db, err := sqlx.Open("batch_pgx", server.DSN())
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	bdb := dbbatch.New(db)
+
+	b := &dbbatch.Batch{}
+	b.Add(func(ctx context.Context) error {
+		_, err := bdb.ExecContext(ctx, "update items set name = $1", "x")
+		return err
+	})
+
+	t.Run("rolled back", func(t *testing.T) {
+		rollbackErr = nil
+
+		err := bdb.SendBatchInTx(ctx, b, nil)
+		require.ErrorContains(t, err, "could not serialize access")
+		assert.Equal(t, "rollback", server.Queries()[len(server.Queries())-1])
+		assert.Equal(t, 1, db.Stats().OpenConnections)
+	})
+
+	t.Run("connection is discarded if rollback fails", func(t *testing.T) {
+		rollbackErr = &pgfake.Error{Code: "08006", Message: "connection failure"}
+
+		err := bdb.SendBatchInTx(ctx, b, nil)
+		require.ErrorContains(t, err, "rollback: ")
+		assert.Equal(t, 0, db.Stats().OpenConnections)
+	})
+}
+
+func TestDriver_FakeServer_failedTx(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	server, err := pgfake.Start(fakeHandler)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = server.Close()
+	})
+
+	db, err := sqlx.Open("batch_pgx", server.DSN())
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	bdb := dbbatch.New(db)
+
+	t.Run("ignored error of the query", func(t *testing.T) {
+		b := &dbbatch.Batch{}
+		b.Add(func(ctx context.Context) error {
+			// the error is ignored, but the transaction is failed on the server
+			_, _ = bdb.ExecContext(ctx, "select fail")
+			return nil
+		})
+
+		err := bdb.SendBatchInTx(ctx, b, nil)
+		require.ErrorContains(t, err, "relation does not exist (SQLSTATE 42P01)")
+		assert.Equal(t, "rollback", server.Queries()[len(server.Queries())-1])
+	})
+
+	t.Run("commit rolls back", func(t *testing.T) {
+		bc, err := bdb.BatchConn(ctx)
+		require.NoError(t, err)
+		defer func() {
+			_ = bc.Close()
+		}()
+
+		_, err = bc.ExecContext(ctx, "begin")
+		require.NoError(t, err)
+		_, err = bc.ExecContext(ctx, "select fail")
+		require.Error(t, err)
+
+		b := &dbbatch.Batch{}
+		b.Add(func(ctx context.Context) error {
+			_, err := bc.ExecContext(ctx, "commit")
+			return err
+		})
+
+		err = bc.SendBatch(ctx, b)
+		require.ErrorIs(t, err, dbbatch.ErrTxCommitRollback)
+	})
+}
+
+func TestDriver_FakeServer_failedLastQuery(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	server, err := pgfake.Start(fakeHandler)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = server.Close()
+	})
+
+	db, err := sqlx.Open("batch_pgx", server.DSN())
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	// the only conn must be unlocked after the failed batch
+	db.SetMaxOpenConns(1)
+	bdb := dbbatch.New(db)
+
+	b := &dbbatch.Batch{}
+	b.Add(func(ctx context.Context) error {
+		_, err := bdb.ExecContext(ctx, "update items set name = $1", "x")
+		return err
+	})
+	b.Add(func(ctx context.Context) error {
+		var x string
+		return bdb.GetContext(ctx, &x, "select fail")
+	})
+
+	err = bdb.SendBatch(ctx, b)
+	require.ErrorContains(t, err, "relation does not exist (SQLSTATE 42P01)")
+
+	var name string
+	err = bdb.GetContext(ctx, &name, "select name from items where id = $1", 3)
+	require.NoError(t, err)
+	assert.Equal(t, "name 3", name)
+}
@@ -2,10 +2,10 @@ package pgx_v5
 
 import (
 	"context"
-	"database/sql"
 	"database/sql/driver"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v5"
@@ -20,14 +20,16 @@ var (
 	_ driver.DriverContext        = &Driver{}
 	_ driver.Driver               = &Driver{}
 	_ dbbatch.BatchRequestsSender = &Conn{}
+	_ dbbatch.RequestChecker      = &Conn{}
 	_ driver.Conn                 = &Conn{}
 )
 
 func init() {
 	batchPgxDriver = &Driver{}
 
-	sql.Register("batch_pgx", batchPgxDriver)
-	sql.Register("batch_pgx_v5", batchPgxDriver)
+	// sqlx.NewDb(db, "batch_pgx") rebinds queries with $1 placeholders like pgx
+	dbbatch.RegisterDriver("batch_pgx", batchPgxDriver, dbbatch.BindDollar)
+	dbbatch.RegisterDriver("batch_pgx_v5", batchPgxDriver, dbbatch.BindDollar)
 }
 
 // GetDefaultDriver returns the driver initialized in the init function
@@ -95,15 +97,53 @@ type Conn struct {
 	conn *pgx.Conn
 }
 
+// CheckRequest rejects the request before it's queued to the batch, so the error doesn't fail the whole round
+func (c *Conn) CheckRequest(request dbbatch.Request) error {
+	_, err := queueArgs(request)
+	return err
+}
+
 func (c *Conn) SendBatchRequests(ctx context.Context, requests []dbbatch.Request) (res any, close func() error, err error) {
 	b := pgx.Batch{}
 	for _, request := range requests {
-		b.Queue(request.Query, request.Args...)
+		args, err := queueArgs(request)
+		if err != nil {
+			return nil, nil, err
+		}
+		b.Queue(request.Query, args...)
 	}
 
 	batchResults := c.conn.SendBatch(ctx, &b)
 
-	return batchResults, batchResults.Close, nil
+	closeFn := func() error {
+		err := batchResults.Close()
+		if err != nil {
+			// pgx returns the error of the last rows without closing the pipeline and the conn stays locked,
+			// the second Close closes the pipeline
+			_ = batchResults.Close()
+		}
+		return err
+	}
+
+	return batchResults, closeFn, nil
+}
+
+// queueArgs returns args of the request for pgx.Batch. Named args are passed as pgx.NamedArgs,
+// so pgx rewrites @name placeholders like in the queries without batch
+func queueArgs(request dbbatch.Request) ([]any, error) {
+	if request.Names == nil {
+		return request.Args, nil
+	}
+
+	namedArgs := make(pgx.NamedArgs, len(request.Args))
+	for i, name := range request.Names {
+		if name == "" {
+			return nil, fmt.Errorf("mixing named and positional args is not supported, query: %s", request.Query)
+		}
+		namedArgs[name] = request.Args[i]
+	}
+
+	return []any{namedArgs}, nil
 }
 
 func (c *Conn) Prepare(query string) (driver.Stmt, error) {
@@ -165,12 +205,7 @@ func (c *Conn) ExecContext(ctx context.Context, query string, argsV []driver.Nam
 		return nil, driver.ErrBadConn
 	}
 
-	args := namedValueToInterface(argsV)
-
-	res := b.BatchRunner().Queue(dbbatch.Request{
-		Query: query,
-		Args:  args,
-	})
+	res := b.BatchRunner().Result()
 	batchResults, ok := res.(pgx.BatchResults)
 	if !ok {
 		return nil, fmt.Errorf("unknown type of pgx.BatchResults: %+v", res)
@@ -179,6 +214,10 @@ func (c *Conn) ExecContext(ctx context.Context, query string, argsV []driver.Nam
 	if err != nil {
 		return nil, fmt.Errorf("batchResults.Exec: %w", err)
 	}
+	// COMMIT of the failed transaction returns ROLLBACK command tag without error
+	if commandTag.String() == "ROLLBACK" && isCommit(query) {
+		return nil, dbbatch.ErrTxCommitRollback
+	}
 
 	return driver.RowsAffected(commandTag.RowsAffected()), nil
 }
@@ -204,22 +243,25 @@ func (c *Conn) QueryContext(ctx context.Context, query string, argsV []driver.Na
 		return nil, driver.ErrBadConn
 	}
 
-	args := make([]any, 0, len(argsV))
-	args = append(args, namedValueToInterface(argsV)...)
-
-	res := bc.BatchRunner().Queue(dbbatch.Request{
-		Query: query,
-		Args:  args,
-	})
+	res := bc.BatchRunner().Result()
 	batchResults, ok := res.(pgx.BatchResults)
 	if !ok {
 		return nil, fmt.Errorf("unknown type of pgx.BatchResults: %+v", res)
 	}
-	rows, err := batchResults.Query()
+	pgxRows, err := batchResults.Query()
 	if err != nil {
 		return nil, fmt.Errorf("batchResults.Query: %w", err)
 	}
 
+	var rows driverRows = pgxRows
+	if buffered, maxBytes := bc.BufferedRows(); buffered {
+		// rows stay valid after closing of batch results in the end of the round
+		rows, err = bufferRows(pgxRows, maxBytes)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// Preload first row because otherwise we won't know what columns are available when database/sql asks.
 	more := rows.Next()
 	if err := rows.Err(); err != nil {
@@ -253,16 +295,10 @@ func (c *Conn) ResetSession(_ context.Context) error {
 
 type rowValueFunc func(src []byte) (driver.Value, error)
 
-func namedValueToInterface(argsV []driver.NamedValue) []any {
-	args := make([]any, 0, len(argsV))
-	for _, v := range argsV {
-		if v.Value != nil {
-			args = append(args, v.Value.(any))
-		} else {
-			args = append(args, nil)
-		}
-	}
-	return args
+// isCommit reports whether the query is COMMIT statement
+func isCommit(query string) bool {
+	fields := strings.Fields(strings.TrimRight(query, "; \t\r\n"))
+	return len(fields) > 0 && (strings.EqualFold(fields[0], "commit") || strings.EqualFold(fields[0], "end"))
 }
 
 func namedValueToDriverValue(argsV []driver.NamedValue) []driver.Value {
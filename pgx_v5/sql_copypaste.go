@@ -10,14 +10,13 @@ import (
 	"strings"
 	"time"
 
-	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
 // Rows is duplicate of pgx/v5/stdlib/sql code. Seems that it's impossible to reuse that code in case of private fields
 type Rows struct {
 	conn         *Conn
-	rows         pgx.Rows
+	rows         driverRows
 	valueFuncs   []rowValueFunc
 	skipNext     bool
 	skipNextMore bool
@@ -0,0 +1,234 @@
+package dbbatch
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/inna-maikut/dbbatch/internal/fakedriver"
+)
+
+// PlanResult is a scripted result of the request in Plan
+type PlanResult struct {
+	Columns      []string
+	Rows         [][]any
+	RowsAffected int64
+	Err          error
+}
+
+// PlanResults returns the scripted result of the request queued by the callback with index.
+// nil PlanResults or nil result means an empty result: no rows, 0 rows affected
+type PlanResults func(callback int, request Request) *PlanResult
+
+// BatchPlan is the queries of the batch by rounds
+type BatchPlan struct {
+	Rounds []PlanRound `json:"rounds"`
+}
+
+type PlanRound struct {
+	Requests []PlannedRequest `json:"requests"`
+}
+
+// PlannedRequest is the request queued by the callback with index Callback in order of adding to the batch.
+// Children of Group have the index of the parent callback
+type PlannedRequest struct {
+	Callback int      `json:"callback"`
+	Query    string   `json:"query"`
+	Args     []any    `json:"args,omitempty"`
+	Names    []string `json:"names,omitempty"`
+}
+
+// String returns stable text format of the plan for snapshot tests
+func (p *BatchPlan) String() string {
+	var sb strings.Builder
+	for i, round := range p.Rounds {
+		fmt.Fprintf(&sb, "round %d\n", i+1)
+		for _, r := range round.Requests {
+			fmt.Fprintf(&sb, "  callback %d: %s", r.Callback, r.Query)
+			if len(r.Args) > 0 {
+				fmt.Fprintf(&sb, " %v", r.Args)
+			}
+			if len(r.Names) > 0 {
+				fmt.Fprintf(&sb, " names %v", r.Names)
+			}
+			sb.WriteString("\n")
+		}
+	}
+	return sb.String()
+}
+
+// Plan runs callbacks of the batch without database and records the queries by rounds.
+// Queries get results from fakeResults. The plan is returned with the error of the batch,
+// e.g. sql.ErrNoRows of GetContext with empty result
+func Plan(ctx context.Context, b *Batch, fakeResults PlanResults) (*BatchPlan, error) {
+	if b == nil {
+		return nil, errors.New("batch must be not nil")
+	}
+
+	sqlDB := sql.OpenDB(planConnector{})
+	defer sqlDB.Close()
+
+	db := sqlx.NewDb(sqlDB, "pgx")
+	conn, err := db.Connx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// the connection isn't bound to BatchDB, so queries of any BatchDB in callbacks go to it
+	bc := newBatchConn(nil, db, conn)
+	defer bc.Close()
+
+	pr := &planRunner{
+		plan:        &BatchPlan{},
+		fakeResults: fakeResults,
+	}
+	pr.batchRunner = newBatchRunner(pr, 0)
+
+	bc.br = pr
+	err = pr.run(bc.setInCtx(ctx), b)
+	bc.br = nil
+
+	return pr.plan, err
+}
+
+// planRunner records the callback of every queued request
+type planRunner struct {
+	*batchRunner
+	plan        *BatchPlan
+	fakeResults PlanResults
+	callbacks   []int // callbacks of the requests of the next round
+}
+
+func (pr *planRunner) Queue(request Request) {
+	pr.callbacks = append(pr.callbacks, pr.currentItem.i)
+	pr.batchRunner.Queue(request)
+}
+
+func (pr *planRunner) SendBatchRequests(_ context.Context, requests []Request) (res any, closeFn func() error, err error) {
+	round := PlanRound{
+		Requests: make([]PlannedRequest, 0, len(requests)),
+	}
+	roundResult := &planRoundResult{}
+	roundResult.Results = make([]*PlanResult, 0, len(requests))
+	for i, request := range requests {
+		round.Requests = append(round.Requests, PlannedRequest{
+			Callback: pr.callbacks[i],
+			Query:    request.Query,
+			Args:     request.Args,
+			Names:    request.Names,
+		})
+
+		var result *PlanResult
+		if pr.fakeResults != nil {
+			result = pr.fakeResults(pr.callbacks[i], request)
+		}
+		roundResult.Results = append(roundResult.Results, result)
+	}
+	pr.plan.Rounds = append(pr.plan.Rounds, round)
+	pr.callbacks = pr.callbacks[:0]
+
+	return roundResult, func() error { return nil }, nil
+}
+
+// planRoundResult gives results in order of requests like pgx.BatchResults
+type planRoundResult struct {
+	fakedriver.Round[*PlanResult]
+}
+
+func (rr *planRoundResult) nextResult() (*PlanResult, error) {
+	res, err := rr.Next()
+	if err != nil {
+		return nil, fmt.Errorf("plan: %w", err)
+	}
+
+	if res == nil {
+		return &PlanResult{}, nil
+	}
+	return res, res.Err
+}
+
+// planConnector is the driver of Plan, it works only in the batch of Plan
+type planConnector struct{}
+
+func (planConnector) Connect(context.Context) (driver.Conn, error) {
+	return planConn{}, nil
+}
+
+func (planConnector) Driver() driver.Driver {
+	return planDriver{}
+}
+
+type planDriver struct{}
+
+func (planDriver) Open(string) (driver.Conn, error) {
+	return planConn{}, nil
+}
+
+type planConn struct{}
+
+var (
+	_ driver.QueryerContext    = planConn{}
+	_ driver.ExecerContext     = planConn{}
+	_ driver.NamedValueChecker = planConn{}
+)
+
+var errPlanOutsideBatch = errors.New("plan: only batched queries are supported")
+
+func (planConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errPlanOutsideBatch
+}
+
+func (planConn) Close() error {
+	return nil
+}
+
+func (planConn) Begin() (driver.Tx, error) {
+	return nil, errPlanOutsideBatch
+}
+
+func (planConn) CheckNamedValue(*driver.NamedValue) error {
+	return nil
+}
+
+func planRoundResultFromContext(ctx context.Context) (*planRoundResult, error) {
+	bc := BatchConnFromContext(ctx)
+	if bc == nil || bc.BatchRunner() == nil {
+		return nil, errPlanOutsideBatch
+	}
+
+	rr, ok := bc.BatchRunner().Result().(*planRoundResult)
+	if !ok {
+		return nil, errPlanOutsideBatch
+	}
+	return rr, nil
+}
+
+func (planConn) ExecContext(ctx context.Context, _ string, _ []driver.NamedValue) (driver.Result, error) {
+	rr, err := planRoundResultFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := rr.nextResult()
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(res.RowsAffected), nil
+}
+
+func (planConn) QueryContext(ctx context.Context, _ string, _ []driver.NamedValue) (driver.Rows, error) {
+	rr, err := planRoundResultFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := rr.nextResult()
+	if err != nil {
+		return nil, err
+	}
+	return &fakedriver.Rows{Cols: res.Columns, Values: res.Rows}, nil
+}
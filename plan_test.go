@@ -0,0 +1,79 @@
+package dbbatch
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlan(t *testing.T) {
+	ctx := context.Background()
+
+	// callbacks use any BatchDB, the batch connection of Plan comes from the context
+	db := New(newNoopDB(t))
+
+	b := &Batch{}
+	h := b.Add(func(ctx context.Context) error {
+		var name string
+		err := db.GetContext(ctx, &name, "select name from items where id = $1", 1)
+		if err != nil {
+			return err
+		}
+
+		_, err = db.ExecContext(ctx, "update items set name = $1 where id = $2", name+"!", 1)
+		return err
+	})
+	b.AddAfter([]Handle{h}, func(ctx context.Context) error {
+		var names []string
+		return db.SelectContext(ctx, &names, "select name from items where user_id = $1", sql.Named("user_id", 10))
+	})
+	b.Add(func(ctx context.Context) error {
+		g := NewGroup(ctx)
+		for _, id := range []int{2, 3} {
+			id := id
+			g.Go(func(ctx context.Context) error {
+				_, err := db.ExecContext(ctx, "delete from items where id = $1", id)
+				return err
+			})
+		}
+		return g.Wait()
+	})
+
+	plan, err := Plan(ctx, b, func(callback int, request Request) *PlanResult {
+		if request.Query == "select name from items where id = $1" {
+			return &PlanResult{Columns: []string{"name"}, Rows: [][]any{{"first"}}}
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, `round 1
+  callback 0: select name from items where id = $1 [1]
+  callback 2: delete from items where id = $1 [2]
+  callback 2: delete from items where id = $1 [3]
+round 2
+  callback 0: update items set name = $1 where id = $2 [first! 1]
+round 3
+  callback 1: select name from items where user_id = $1 [10] names [user_id]
+`, plan.String())
+
+	data, err := json.Marshal(plan.Rounds[1])
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"requests":[{"callback":0,"query":"update items set name = $1 where id = $2","args":["first!",1]}]}`, string(data))
+
+	t.Run("error of the batch", func(t *testing.T) {
+		b := &Batch{}
+		b.Add(func(ctx context.Context) error {
+			var name string
+			return db.GetContext(ctx, &name, "select name from items where id = $1", 1)
+		})
+
+		plan, err := Plan(ctx, b, nil)
+		assert.ErrorIs(t, err, sql.ErrNoRows)
+		assert.Len(t, plan.Rounds, 1)
+	})
+}
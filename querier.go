@@ -0,0 +1,56 @@
+package dbbatch
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Querier is the common query API of BatchDB, BatchConn, BatchTx and SeqBatcher.
+// Repositories may accept it to run on a plain DB, a batch connection, a transaction or a stub in tests
+type Querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	Exec(query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	QueryRow(query string, args ...any) *sql.Row
+
+	QueryxContext(ctx context.Context, query string, args ...any) (*sqlx.Rows, error)
+	Queryx(query string, args ...any) (*sqlx.Rows, error)
+	QueryRowxContext(ctx context.Context, query string, args ...any) *sqlx.Row
+	QueryRowx(query string, args ...any) *sqlx.Row
+	MustExecContext(ctx context.Context, query string, args ...any) sql.Result
+	MustExec(query string, args ...any) sql.Result
+
+	GetContext(ctx context.Context, dest any, query string, args ...any) error
+	Get(dest any, query string, args ...any) error
+	SelectContext(ctx context.Context, dest any, query string, args ...any) error
+	Select(dest any, query string, args ...any) error
+
+	NamedQueryContext(ctx context.Context, query string, arg any) (*sqlx.Rows, error)
+	NamedQuery(query string, arg any) (*sqlx.Rows, error)
+	NamedExecContext(ctx context.Context, query string, arg any) (sql.Result, error)
+	NamedExec(query string, arg any) (sql.Result, error)
+}
+
+// Batcher sends batches
+type Batcher interface {
+	SendBatch(ctx context.Context, b *Batch) error
+}
+
+var (
+	_ Querier = &BatchDB{}
+	_ Querier = &BatchConn{}
+	_ Querier = &BatchTx{}
+	_ Querier = &SeqBatcher{}
+
+	_ Batcher = &BatchDB{}
+	_ Batcher = &BatchConn{}
+	_ Batcher = &BatchTx{}
+	_ Batcher = &SeqBatcher{}
+	_ Batcher = &SQLDB{}
+	_ Batcher = &SQLConn{}
+	_ Batcher = &SQLTx{}
+)
@@ -0,0 +1,69 @@
+package dbbatch
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ReplicaPolicy chooses the replica for a read batch
+type ReplicaPolicy int
+
+const (
+	// ReplicaRoundRobin chooses replicas one by one
+	ReplicaRoundRobin ReplicaPolicy = iota
+	// ReplicaLeastLoaded chooses the replica with the least count of connections in use
+	ReplicaLeastLoaded
+)
+
+type contextKeyReadOnlyType struct{}
+
+var contextKeyReadOnly = contextKeyReadOnlyType{}
+
+// ReadOnly marks ctx, so SendBatch with it sends the batch to a replica.
+// All callbacks of such batch must issue only reads
+func ReadOnly(ctx context.Context) context.Context {
+	return context.WithValue(ctx, contextKeyReadOnly, true)
+}
+
+// IsReadOnly reports whether ctx is marked by ReadOnly
+func IsReadOnly(ctx context.Context) bool {
+	readOnly, _ := ctx.Value(contextKeyReadOnly).(bool)
+	return readOnly
+}
+
+// NewWithReplicas creates BatchDB sending read batches to replicas, see ReadOnly and SendReadBatch.
+// Other batches, queries and transactions always use primary
+func NewWithReplicas(primary *sqlx.DB, replicas ...*sqlx.DB) *BatchDB {
+	return New(primary, WithReplicas(replicas...))
+}
+
+// SendReadBatch sends batch to a replica. All callbacks of the batch must issue only reads
+func (bdb *BatchDB) SendReadBatch(ctx context.Context, b *Batch) (err error) {
+	defer bdb.enterBatch(ctx)()
+
+	return bdb.SendBatch(ReadOnly(ctx), b)
+}
+
+// batchDB returns db for the batch: replica for the read only batch if replicas are set, primary otherwise
+func (bdb *BatchDB) batchDB(ctx context.Context) *sqlx.DB {
+	replicas := bdb.options.replicas
+	if len(replicas) == 0 || !IsReadOnly(ctx) {
+		return bdb.DB
+	}
+
+	switch bdb.options.replicaPolicy {
+	case ReplicaLeastLoaded:
+		least := replicas[0]
+		leastInUse := least.Stats().InUse
+		for _, replica := range replicas[1:] {
+			if inUse := replica.Stats().InUse; inUse < leastInUse {
+				least, leastInUse = replica, inUse
+			}
+		}
+		return least
+	default:
+		i := bdb.replicaNext.Add(1) - 1
+		return replicas[i%uint32(len(replicas))]
+	}
+}
@@ -0,0 +1,82 @@
+package dbbatch
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type noopDriver struct{}
+
+func (noopDriver) Open(string) (driver.Conn, error) { return noopConn{}, nil }
+
+type noopConn struct{}
+
+func (noopConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not implemented") }
+func (noopConn) Close() error                        { return nil }
+func (noopConn) Begin() (driver.Tx, error)           { return nil, errors.New("not implemented") }
+
+func init() {
+	sql.Register("dbbatch_noop", noopDriver{})
+}
+
+func newNoopDB(t *testing.T) *sqlx.DB {
+	db, err := sqlx.Open("dbbatch_noop", "")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+
+	return db
+}
+
+func TestReadOnly(t *testing.T) {
+	ctx := context.Background()
+	assert.False(t, IsReadOnly(ctx))
+	assert.True(t, IsReadOnly(ReadOnly(ctx)))
+}
+
+func TestBatchDB_batchDB(t *testing.T) {
+	ctx := context.Background()
+	readCtx := ReadOnly(ctx)
+
+	primary, replica1, replica2 := newNoopDB(t), newNoopDB(t), newNoopDB(t)
+
+	t.Run("no replicas", func(t *testing.T) {
+		bdb := New(primary)
+		assert.Same(t, primary, bdb.batchDB(ctx))
+		assert.Same(t, primary, bdb.batchDB(readCtx))
+	})
+
+	t.Run("round robin", func(t *testing.T) {
+		bdb := NewWithReplicas(primary, replica1, replica2)
+		assert.Same(t, primary, bdb.batchDB(ctx))
+		assert.Same(t, replica1, bdb.batchDB(readCtx))
+		assert.Same(t, replica2, bdb.batchDB(readCtx))
+		assert.Same(t, replica1, bdb.batchDB(readCtx))
+
+		// the copy continues the round of bdb
+		assert.Same(t, replica2, bdb.With().batchDB(readCtx))
+		assert.Same(t, replica1, bdb.batchDB(readCtx))
+	})
+
+	t.Run("least loaded", func(t *testing.T) {
+		bdb := New(primary, WithReplicas(replica1, replica2), WithReplicaPolicy(ReplicaLeastLoaded))
+		assert.Same(t, primary, bdb.batchDB(ctx))
+		assert.Same(t, replica1, bdb.batchDB(readCtx))
+
+		conn, err := replica1.Conn(ctx)
+		require.NoError(t, err)
+		defer func() {
+			_ = conn.Close()
+		}()
+
+		assert.Same(t, replica2, bdb.batchDB(readCtx))
+	})
+}
@@ -1,13 +1,152 @@
 package dbbatch
 
-import "context"
+import (
+	"context"
+	"database/sql"
+	"errors"
 
-type SeqBatcher struct{}
+	"github.com/jmoiron/sqlx"
+)
 
+// SeqBatcher runs callbacks of the batch sequentially without batching.
+// Created by NewSeqBatcherWithExt it's a complete Querier + Batcher stub over any Ext
+type SeqBatcher struct {
+	ext Ext
+}
+
+var errSeqBatcherNoExt = errors.New("seq batcher has no ext, use NewSeqBatcherWithExt")
+
+// NewSeqBatcher creates SeqBatcher only for SendBatch, queries return errSeqBatcherNoExt
 func NewSeqBatcher() *SeqBatcher {
 	return &SeqBatcher{}
 }
 
+// NewSeqBatcherWithExt creates SeqBatcher running queries with ext, e.g. *sqlx.DB, *sqlx.Tx or *BatchDB
+func NewSeqBatcherWithExt(ext Ext) *SeqBatcher {
+	return &SeqBatcher{
+		ext: ext,
+	}
+}
+
 func (sb *SeqBatcher) SendBatch(ctx context.Context, b *Batch) (err error) {
 	return b.RunSequential(ctx)
 }
+
+func (sb *SeqBatcher) bindNamed(query string, arg any) (string, []any, error) {
+	if binder, ok := sb.ext.(interface {
+		BindNamed(query string, arg any) (string, []any, error)
+	}); ok {
+		return binder.BindNamed(query, arg)
+	}
+
+	return sqlx.BindNamed(sqlx.DOLLAR, query, arg)
+}
+
+func (sb *SeqBatcher) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	if sb.ext == nil {
+		return nil, errSeqBatcherNoExt
+	}
+	return sb.ext.QueryContext(ctx, query, args...)
+}
+
+func (sb *SeqBatcher) Query(query string, args ...any) (*sql.Rows, error) {
+	return sb.QueryContext(context.Background(), query, args...)
+}
+
+func (sb *SeqBatcher) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	if sb.ext == nil {
+		return nil, errSeqBatcherNoExt
+	}
+	return sb.ext.ExecContext(ctx, query, args...)
+}
+
+func (sb *SeqBatcher) Exec(query string, args ...any) (sql.Result, error) {
+	return sb.ExecContext(context.Background(), query, args...)
+}
+
+func (sb *SeqBatcher) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	if sb.ext == nil {
+		return errorRow(errSeqBatcherNoExt)
+	}
+	return sb.ext.QueryRowContext(ctx, query, args...)
+}
+
+func (sb *SeqBatcher) QueryRow(query string, args ...any) *sql.Row {
+	return sb.QueryRowContext(context.Background(), query, args...)
+}
+
+func (sb *SeqBatcher) QueryxContext(ctx context.Context, query string, args ...any) (*sqlx.Rows, error) {
+	if sb.ext == nil {
+		return nil, errSeqBatcherNoExt
+	}
+	return sb.ext.QueryxContext(ctx, query, args...)
+}
+
+func (sb *SeqBatcher) Queryx(query string, args ...any) (*sqlx.Rows, error) {
+	return sb.QueryxContext(context.Background(), query, args...)
+}
+
+func (sb *SeqBatcher) QueryRowxContext(ctx context.Context, query string, args ...any) *sqlx.Row {
+	if sb.ext == nil {
+		return errorRowx(errSeqBatcherNoExt)
+	}
+	return sb.ext.QueryRowxContext(ctx, query, args...)
+}
+
+func (sb *SeqBatcher) QueryRowx(query string, args ...any) *sqlx.Row {
+	return sb.QueryRowxContext(context.Background(), query, args...)
+}
+
+func (sb *SeqBatcher) MustExecContext(ctx context.Context, query string, args ...any) sql.Result {
+	return sqlx.MustExecContext(ctx, sb, query, args...)
+}
+
+func (sb *SeqBatcher) MustExec(query string, args ...any) sql.Result {
+	return sb.MustExecContext(context.Background(), query, args...)
+}
+
+func (sb *SeqBatcher) GetContext(ctx context.Context, dest any, query string, args ...any) error {
+	if sb.ext == nil {
+		return errSeqBatcherNoExt
+	}
+	return sb.ext.GetContext(ctx, dest, query, args...)
+}
+
+func (sb *SeqBatcher) Get(dest any, query string, args ...any) error {
+	return sb.GetContext(context.Background(), dest, query, args...)
+}
+
+func (sb *SeqBatcher) SelectContext(ctx context.Context, dest any, query string, args ...any) error {
+	if sb.ext == nil {
+		return errSeqBatcherNoExt
+	}
+	return sb.ext.SelectContext(ctx, dest, query, args...)
+}
+
+func (sb *SeqBatcher) Select(dest any, query string, args ...any) error {
+	return sb.SelectContext(context.Background(), dest, query, args...)
+}
+
+func (sb *SeqBatcher) NamedQueryContext(ctx context.Context, query string, arg any) (*sqlx.Rows, error) {
+	q, args, err := sb.bindNamed(query, arg)
+	if err != nil {
+		return nil, err
+	}
+	return sb.QueryxContext(ctx, q, args...)
+}
+
+func (sb *SeqBatcher) NamedQuery(query string, arg any) (*sqlx.Rows, error) {
+	return sb.NamedQueryContext(context.Background(), query, arg)
+}
+
+func (sb *SeqBatcher) NamedExecContext(ctx context.Context, query string, arg any) (sql.Result, error) {
+	q, args, err := sb.bindNamed(query, arg)
+	if err != nil {
+		return nil, err
+	}
+	return sb.ExecContext(ctx, q, args...)
+}
+
+func (sb *SeqBatcher) NamedExec(query string, arg any) (sql.Result, error) {
+	return sb.NamedExecContext(context.Background(), query, arg)
+}
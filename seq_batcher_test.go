@@ -0,0 +1,78 @@
+package dbbatch
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestSeqBatcher(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("SendBatch", func(t *testing.T) {
+		var calls []int
+
+		b := &Batch{}
+		b.Add(func(ctx context.Context) error {
+			calls = append(calls, 1)
+			return nil
+		})
+		b.Add(func(ctx context.Context) error {
+			calls = append(calls, 2)
+			return nil
+		})
+
+		err := NewSeqBatcher().SendBatch(ctx, b)
+		require.NoError(t, err)
+		assert.Equal(t, []int{1, 2}, calls)
+	})
+
+	t.Run("without ext", func(t *testing.T) {
+		sb := NewSeqBatcher()
+
+		_, err := sb.ExecContext(ctx, "query")
+		assert.ErrorIs(t, err, errSeqBatcherNoExt)
+
+		err = sb.Select(&[]int{}, "query")
+		assert.ErrorIs(t, err, errSeqBatcherNoExt)
+
+		var dest int
+		err = sb.QueryRow("query").Scan(&dest)
+		assert.ErrorIs(t, err, errSeqBatcherNoExt)
+		err = sb.QueryRowxContext(ctx, "query").Scan(&dest)
+		assert.ErrorIs(t, err, errSeqBatcherNoExt)
+
+		// the stub without ext is a Querier, all its methods return the error
+		var q Querier = sb
+		_, err = q.QueryxContext(ctx, "query")
+		assert.ErrorIs(t, err, errSeqBatcherNoExt)
+	})
+
+	t.Run("with ext", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		extMock := NewMockExt(ctrl)
+
+		sb := NewSeqBatcherWithExt(extMock)
+
+		extMock.EXPECT().ExecContext(ctx, "query", 1).Return(driver.RowsAffected(1), nil)
+		_, err := sb.Exec("query", 1)
+		require.NoError(t, err)
+
+		extMock.EXPECT().GetContext(ctx, gomock.Any(), "query", 1).Return(nil)
+		var dest int
+		err = sb.GetContext(ctx, &dest, "query", 1)
+		require.NoError(t, err)
+
+		extMock.EXPECT().ExecContext(ctx, "update items set name = $1 where id = $2", "name", 1).
+			Return(driver.RowsAffected(1), nil)
+		_, err = sb.NamedExecContext(ctx, "update items set name = :name where id = :id", map[string]any{
+			"name": "name",
+			"id":   1,
+		})
+		require.NoError(t, err)
+	})
+}
@@ -0,0 +1,222 @@
+package dbbatch
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// SQLDB is BatchDB for database/sql users, there are no sqlx types in its API.
+// It shares the batch runner and drivers with BatchDB
+type SQLDB struct {
+	bdb *BatchDB
+}
+
+// NewSQL creates SQLDB over *sql.DB opened with the batch driver registered by RegisterDriver.
+// The driver name sets placeholders of Rebind and In queries, for other drivers use NewSQLWithDriverName
+func NewSQL(db *sql.DB, opts ...Option) *SQLDB {
+	return NewSQLWithDriverName(db, registeredDriverName(db.Driver()), opts...)
+}
+
+// NewSQLWithDriverName creates SQLDB over *sql.DB opened with the driver registered by driverName
+func NewSQLWithDriverName(db *sql.DB, driverName string, opts ...Option) *SQLDB {
+	return &SQLDB{
+		bdb: New(sqlx.NewDb(db, driverName), opts...),
+	}
+}
+
+// DB returns the underlying *sql.DB
+func (sdb *SQLDB) DB() *sql.DB {
+	return sdb.bdb.DB.DB
+}
+
+func (sdb *SQLDB) SQLConn(ctx context.Context) (*SQLConn, error) {
+	bc, err := sdb.bdb.BatchConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SQLConn{bc: bc}, nil
+}
+
+func (sdb *SQLDB) BeginBatchTx(ctx context.Context, opts *sql.TxOptions) (*SQLTx, error) {
+	btx, err := sdb.bdb.BeginBatchTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SQLTx{btx: btx}, nil
+}
+
+func (sdb *SQLDB) SendBatch(ctx context.Context, b *Batch) error {
+	return sdb.bdb.SendBatch(ctx, b)
+}
+
+func (sdb *SQLDB) SendBatchInTx(ctx context.Context, b *Batch, opts *sql.TxOptions) error {
+	return sdb.bdb.SendBatchInTx(ctx, b, opts)
+}
+
+// SendReadBatch sends batch to a replica, see BatchDB.SendReadBatch
+func (sdb *SQLDB) SendReadBatch(ctx context.Context, b *Batch) error {
+	return sdb.bdb.SendReadBatch(ctx, b)
+}
+
+// RunInBatchTx runs fn in the transaction with retries, see BatchDB.RunInBatchTx
+func (sdb *SQLDB) RunInBatchTx(
+	ctx context.Context,
+	opts *sql.TxOptions,
+	fn func(tx *SQLTx) error,
+	retryPolicy RetryPolicy,
+) error {
+	return sdb.bdb.RunInBatchTx(ctx, opts, func(btx *BatchTx) error {
+		return fn(&SQLTx{btx: btx})
+	}, retryPolicy)
+}
+
+func (sdb *SQLDB) SupportsBatching() bool {
+	return sdb.bdb.SupportsBatching()
+}
+
+func (sdb *SQLDB) PingContext(ctx context.Context) error {
+	return sdb.bdb.PingContext(ctx)
+}
+
+func (sdb *SQLDB) Close() error {
+	return sdb.bdb.Close()
+}
+
+func (sdb *SQLDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return sdb.bdb.QueryContext(ctx, query, args...)
+}
+
+func (sdb *SQLDB) Query(query string, args ...any) (*sql.Rows, error) {
+	return sdb.QueryContext(context.Background(), query, args...)
+}
+
+func (sdb *SQLDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return sdb.bdb.ExecContext(ctx, query, args...)
+}
+
+func (sdb *SQLDB) Exec(query string, args ...any) (sql.Result, error) {
+	return sdb.ExecContext(context.Background(), query, args...)
+}
+
+func (sdb *SQLDB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return sdb.bdb.QueryRowContext(ctx, query, args...)
+}
+
+func (sdb *SQLDB) QueryRow(query string, args ...any) *sql.Row {
+	return sdb.QueryRowContext(context.Background(), query, args...)
+}
+
+func (sdb *SQLDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	return sdb.bdb.BeginTx(ctx, opts)
+}
+
+func (sdb *SQLDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return sdb.bdb.PrepareContext(ctx, query)
+}
+
+// SQLConn is BatchConn for database/sql users. Must call SQLConn.Close() in the end
+type SQLConn struct {
+	bc *BatchConn
+}
+
+func (sc *SQLConn) BeginBatchTx(ctx context.Context, opts *sql.TxOptions) (*SQLTx, error) {
+	btx, err := sc.bc.BeginBatchTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SQLTx{btx: btx}, nil
+}
+
+func (sc *SQLConn) SendBatch(ctx context.Context, b *Batch) error {
+	return sc.bc.SendBatch(ctx, b)
+}
+
+func (sc *SQLConn) Close() error {
+	return sc.bc.Close()
+}
+
+func (sc *SQLConn) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return sc.bc.QueryContext(ctx, query, args...)
+}
+
+func (sc *SQLConn) Query(query string, args ...any) (*sql.Rows, error) {
+	return sc.QueryContext(context.Background(), query, args...)
+}
+
+func (sc *SQLConn) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return sc.bc.ExecContext(ctx, query, args...)
+}
+
+func (sc *SQLConn) Exec(query string, args ...any) (sql.Result, error) {
+	return sc.ExecContext(context.Background(), query, args...)
+}
+
+func (sc *SQLConn) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return sc.bc.QueryRowContext(ctx, query, args...)
+}
+
+func (sc *SQLConn) QueryRow(query string, args ...any) *sql.Row {
+	return sc.QueryRowContext(context.Background(), query, args...)
+}
+
+func (sc *SQLConn) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	return sc.bc.BeginTx(ctx, opts)
+}
+
+func (sc *SQLConn) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return sc.bc.PrepareContext(ctx, query)
+}
+
+// SQLTx is BatchTx for database/sql users
+type SQLTx struct {
+	btx *BatchTx
+}
+
+func (stx *SQLTx) SendBatch(ctx context.Context, b *Batch) error {
+	return stx.btx.SendBatch(ctx, b)
+}
+
+func (stx *SQLTx) SendBatchAtomic(ctx context.Context, b *Batch) error {
+	return stx.btx.SendBatchAtomic(ctx, b)
+}
+
+func (stx *SQLTx) Commit() error {
+	return stx.btx.Commit()
+}
+
+func (stx *SQLTx) Rollback() error {
+	return stx.btx.Rollback()
+}
+
+func (stx *SQLTx) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return stx.btx.QueryContext(ctx, query, args...)
+}
+
+func (stx *SQLTx) Query(query string, args ...any) (*sql.Rows, error) {
+	return stx.QueryContext(context.Background(), query, args...)
+}
+
+func (stx *SQLTx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return stx.btx.ExecContext(ctx, query, args...)
+}
+
+func (stx *SQLTx) Exec(query string, args ...any) (sql.Result, error) {
+	return stx.ExecContext(context.Background(), query, args...)
+}
+
+func (stx *SQLTx) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return stx.btx.QueryRowContext(ctx, query, args...)
+}
+
+func (stx *SQLTx) QueryRow(query string, args ...any) *sql.Row {
+	return stx.QueryRowContext(context.Background(), query, args...)
+}
+
+func (stx *SQLTx) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return stx.btx.PrepareContext(ctx, query)
+}
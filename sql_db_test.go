@@ -0,0 +1,77 @@
+package dbbatch
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLDB(t *testing.T) {
+	ctx := context.Background()
+	db := newNoopDB(t)
+
+	sdb := NewSQL(db.DB, WithoutCancel(true))
+	assert.Same(t, db.DB, sdb.DB())
+	assert.True(t, sdb.bdb.options.withoutCancel)
+
+	t.Run("driver name", func(t *testing.T) {
+		registeredDB, err := sql.Open("dbbatch_registered", "")
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			_ = registeredDB.Close()
+		})
+
+		assert.Equal(t, "dbbatch_registered", NewSQL(registeredDB).bdb.DriverName())
+		assert.Equal(t, "select $1", NewSQL(registeredDB).bdb.Rebind("select ?"))
+		assert.Equal(t, "dbbatch_noop", NewSQLWithDriverName(db.DB, "dbbatch_noop").bdb.DriverName())
+	})
+
+	t.Run("SQLConn", func(t *testing.T) {
+		sc, err := sdb.SQLConn(ctx)
+		require.NoError(t, err)
+		require.NoError(t, sc.Close())
+		assert.ErrorIs(t, sc.Close(), sql.ErrConnDone)
+	})
+
+	t.Run("in batch", func(t *testing.T) {
+		var bc *BatchConn
+
+		b := &Batch{}
+		b.Add(func(ctx context.Context) error {
+			bc = BatchConnFromContext(ctx)
+
+			_, err := sdb.BeginTx(ctx, nil)
+			assert.ErrorIs(t, err, ErrTxNotSupported)
+
+			_, err = sdb.PrepareContext(ctx, "")
+			assert.ErrorIs(t, err, ErrStmtNotSupported)
+
+			return nil
+		})
+
+		err := sdb.SendBatch(ctx, b)
+		require.NoError(t, err)
+		require.NotNil(t, bc)
+		assert.Same(t, sdb.bdb, bc.db)
+	})
+
+	t.Run("SendReadBatch", func(t *testing.T) {
+		replica := newNoopDB(t)
+		sdb := NewSQL(db.DB, WithReplicas(replica))
+
+		var bc *BatchConn
+		b := &Batch{}
+		b.Add(func(ctx context.Context) error {
+			bc = BatchConnFromContext(ctx)
+			return nil
+		})
+
+		err := sdb.SendReadBatch(ctx, b)
+		require.NoError(t, err)
+		require.NotNil(t, bc)
+		assert.Same(t, replica, bc.binder)
+	})
+}
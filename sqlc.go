@@ -0,0 +1,64 @@
+package dbbatch
+
+import (
+	"context"
+	"database/sql"
+)
+
+// DBTX is the interface of sqlc generated code
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// SQLCQuerier is implemented by BatchDB, BatchConn, BatchTx, SQLDB, SQLConn, SQLTx and SeqBatcher
+type SQLCQuerier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+type sqlcDB struct {
+	db SQLCQuerier
+}
+
+var (
+	_ DBTX = &sqlcDB{}
+
+	_ SQLCQuerier = &BatchDB{}
+	_ SQLCQuerier = &BatchConn{}
+	_ SQLCQuerier = &BatchTx{}
+	_ SQLCQuerier = &SQLDB{}
+	_ SQLCQuerier = &SQLConn{}
+	_ SQLCQuerier = &SQLTx{}
+	_ SQLCQuerier = &SeqBatcher{}
+)
+
+// SQLC adapts db for sqlc generated Queries, so they work inside batch callbacks.
+// PrepareContext returns nil stmt without error: Queries created by the generated Prepare
+// (emit_prepared_queries) fall back to the methods of db, which are batched inside callbacks.
+// pgx caches prepared statements of the connection itself
+func SQLC(db SQLCQuerier) DBTX {
+	return &sqlcDB{
+		db: db,
+	}
+}
+
+func (s *sqlcDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return s.db.ExecContext(ctx, query, args...)
+}
+
+// PrepareContext returns nil stmt, so the generated code uses ExecContext, QueryContext, QueryRowContext
+func (s *sqlcDB) PrepareContext(context.Context, string) (*sql.Stmt, error) {
+	return nil, nil
+}
+
+func (s *sqlcDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return s.db.QueryContext(ctx, query, args...)
+}
+
+func (s *sqlcDB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return s.db.QueryRowContext(ctx, query, args...)
+}
@@ -0,0 +1,27 @@
+package dbbatch
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/mock/gomock"
+)
+
+func TestSQLC(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	ctx := context.Background()
+
+	extMock := NewMockExt(ctrl)
+	db := SQLC(extMock)
+
+	stmt, err := db.PrepareContext(ctx, "query")
+	require.NoError(t, err)
+	assert.Nil(t, stmt)
+
+	extMock.EXPECT().ExecContext(ctx, "query", 1).Return(driver.RowsAffected(1), nil)
+	_, err = db.ExecContext(ctx, "query", 1)
+	require.NoError(t, err)
+}
@@ -0,0 +1,121 @@
+package dbbatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// ErrBypassedBatch is returned in strict batching mode for the query of BatchDB
+// without the batch connection in the context from a callback of the running batch of the same BatchDB
+var ErrBypassedBatch = errors.New("query bypassed the running batch")
+
+type strictBatching int
+
+const (
+	strictBatchingOff strictBatching = iota
+	strictBatchingError
+	strictBatchingWarn
+)
+
+// WithStrictBatching rejects queries of BatchDB with ErrBypassedBatch, if the context has no batch connection
+// and it's the context passed to SendBatch of the running batch of the BatchDB, or derived from it by context.WithValue.
+// Usually it's a callback calling BatchDB with the context captured from outside instead of its own one.
+// Queries of other goroutines with the same context are rejected too, e.g. methods without context
+// while the batch is sent with context.Background(), so the mode is for tests and development
+func WithStrictBatching() Option {
+	return func(o *options) {
+		o.strictBatching = strictBatchingError
+	}
+}
+
+// WithStrictBatchingWarnOnly reports bypassed batch through Hooks.BypassedBatch and sends the query
+func WithStrictBatchingWarnOnly() Option {
+	return func(o *options) {
+		o.strictBatching = strictBatchingWarn
+	}
+}
+
+// beforeQuery checks strict batching and calls hooks of the query sent without batch
+func (bdb *BatchDB) beforeQuery(ctx context.Context, query string) error {
+	if bdb.options.strictBatching != strictBatchingOff && bdb.batchCtxs != nil && bdb.batchCtxs.owns(ctx) {
+		bdb.bypassedBatchHook(ctx, query)
+		if bdb.options.strictBatching == strictBatchingError {
+			return fmt.Errorf("%w, query: %s", ErrBypassedBatch, query)
+		}
+	}
+
+	bdb.queryHook(ctx, query)
+
+	return nil
+}
+
+// batchContexts are contexts passed to SendBatch of running batches of BatchDB, tracked in strict batching mode.
+// Callbacks get the context with the batch connection, so the query with the context of SendBatch is made
+// by a callback, which calls BatchDB with the context captured from outside instead of its own one
+type batchContexts struct {
+	mu   sync.Mutex
+	keys map[any]int
+}
+
+func newBatchContexts() *batchContexts {
+	return &batchContexts{
+		keys: map[any]int{},
+	}
+}
+
+// contextKey identifies ctx and contexts derived from it by context.WithValue: it's the Done channel,
+// or ctx itself if it's never canceled like context.Background(). False if ctx can't be identified
+func contextKey(ctx context.Context) (any, bool) {
+	if done := ctx.Done(); done != nil {
+		return done, true
+	}
+	if !reflect.ValueOf(ctx).Comparable() {
+		return nil, false
+	}
+	return ctx, true
+}
+
+// enter marks ctx as the context of the running batch, the returned func unmarks it
+func (bc *batchContexts) enter(ctx context.Context) (exit func()) {
+	key, ok := contextKey(ctx)
+	if !ok {
+		return func() {}
+	}
+
+	bc.mu.Lock()
+	bc.keys[key]++
+	bc.mu.Unlock()
+
+	return func() {
+		bc.mu.Lock()
+		defer bc.mu.Unlock()
+
+		bc.keys[key]--
+		if bc.keys[key] == 0 {
+			delete(bc.keys, key)
+		}
+	}
+}
+
+// owns reports whether ctx is the context of a running batch
+func (bc *batchContexts) owns(ctx context.Context) bool {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	if len(bc.keys) == 0 {
+		return false
+	}
+	key, ok := contextKey(ctx)
+	return ok && bc.keys[key] > 0
+}
+
+// enterBatch marks ctx as the context of the running batch in strict batching mode, the returned func unmarks it
+func (bdb *BatchDB) enterBatch(ctx context.Context) (exit func()) {
+	if bdb.options.strictBatching == strictBatchingOff || bdb.batchCtxs == nil {
+		return func() {}
+	}
+	return bdb.batchCtxs.enter(ctx)
+}
@@ -0,0 +1,133 @@
+package dbbatch
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchDB_StrictBatching(t *testing.T) {
+	ctx := context.Background()
+
+	var bypassed []string
+	hooks := WithHooks(Hooks{
+		BypassedBatch: func(_ context.Context, query string) {
+			bypassed = append(bypassed, query)
+		},
+	})
+
+	t.Run("error", func(t *testing.T) {
+		bypassed = nil
+		bdb := New(newNoopDB(t), WithStrictBatching(), hooks)
+
+		_, err := bdb.ExecContext(ctx, "query 1")
+		assert.NotErrorIs(t, err, ErrBypassedBatch)
+
+		exit := bdb.batchCtxs.enter(ctx)
+		_, err = bdb.ExecContext(ctx, "query 2")
+		assert.ErrorIs(t, err, ErrBypassedBatch)
+		err = bdb.Select(&[]int{}, "query 3")
+		assert.ErrorIs(t, err, ErrBypassedBatch)
+		assert.PanicsWithError(t, "query bypassed the running batch, query: query 4", func() {
+			bdb.MustExec("query 4")
+		})
+
+		// copy shares running batches
+		_, err = bdb.With().QueryContext(ctx, "query 5")
+		assert.ErrorIs(t, err, ErrBypassedBatch)
+
+		var x int
+		err = bdb.QueryRowContext(ctx, "query 6").Scan(&x)
+		assert.ErrorIs(t, err, ErrBypassedBatch)
+		err = bdb.QueryRowxContext(ctx, "query 7").Scan(&x)
+		assert.ErrorIs(t, err, ErrBypassedBatch)
+
+		// other contexts aren't contexts of the batch
+		otherCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		_, err = bdb.ExecContext(otherCtx, "query 8")
+		assert.NotErrorIs(t, err, ErrBypassedBatch)
+
+		exit()
+		_, err = bdb.Exec("query 9")
+		assert.NotErrorIs(t, err, ErrBypassedBatch)
+
+		assert.Equal(t, []string{"query 2", "query 3", "query 4", "query 5", "query 6", "query 7"}, bypassed)
+	})
+
+	t.Run("callback with wrong context", func(t *testing.T) {
+		bypassed = nil
+		bdb := New(newSenderDB(t), WithStrictBatching(), hooks)
+
+		batchCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		otherCtx, cancelOther := context.WithCancel(ctx)
+		defer cancelOther()
+
+		var callbackErr, derivedErr, otherErr error
+		b := &Batch{}
+		b.Add(func(_ context.Context) error {
+			done := make(chan error)
+			go func() {
+				_, err := bdb.ExecContext(otherCtx, "other context")
+				done <- err
+			}()
+			otherErr = <-done
+
+			_, callbackErr = bdb.ExecContext(batchCtx, "wrong context")
+			_, derivedErr = bdb.ExecContext(ReadOnly(batchCtx), "derived context")
+			return nil
+		})
+
+		err := bdb.SendBatch(batchCtx, b)
+		assert.NoError(t, err)
+		assert.ErrorIs(t, callbackErr, ErrBypassedBatch)
+		assert.ErrorIs(t, derivedErr, ErrBypassedBatch)
+		assert.NotErrorIs(t, otherErr, ErrBypassedBatch)
+		assert.Equal(t, []string{"wrong context", "derived context"}, bypassed)
+
+		// the batch is finished
+		_, err = bdb.ExecContext(batchCtx, "after batch")
+		assert.NotErrorIs(t, err, ErrBypassedBatch)
+	})
+
+	t.Run("methods without context", func(t *testing.T) {
+		bypassed = nil
+		bdb := New(newSenderDB(t), WithStrictBatching(), hooks)
+
+		var callbackErr error
+		b := &Batch{}
+		b.Add(func(_ context.Context) error {
+			callbackErr = bdb.Get(new(int), "without context")
+			return nil
+		})
+
+		err := bdb.SendBatch(context.Background(), b)
+		assert.NoError(t, err)
+		assert.ErrorIs(t, callbackErr, ErrBypassedBatch)
+		assert.Equal(t, []string{"without context"}, bypassed)
+	})
+
+	t.Run("warn only", func(t *testing.T) {
+		bypassed = nil
+		bdb := New(newNoopDB(t), WithStrictBatchingWarnOnly(), hooks)
+
+		defer bdb.batchCtxs.enter(ctx)()
+		_, err := bdb.ExecContext(ctx, "query 1")
+		assert.NotErrorIs(t, err, ErrBypassedBatch)
+		_ = bdb.QueryRowContext(ctx, "query 2")
+
+		assert.Equal(t, []string{"query 1", "query 2"}, bypassed)
+	})
+
+	t.Run("off", func(t *testing.T) {
+		bypassed = nil
+		bdb := New(newNoopDB(t), hooks)
+
+		defer bdb.enterBatch(ctx)()
+		_, err := bdb.ExecContext(ctx, "query 1")
+		assert.NotErrorIs(t, err, ErrBypassedBatch)
+		assert.Empty(t, bypassed)
+	})
+}
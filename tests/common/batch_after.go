@@ -0,0 +1,62 @@
+//go:build integration
+
+package common
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/inna-maikut/dbbatch"
+)
+
+func BatchAfter(ctx context.Context, t *testing.T, db *dbbatch.BatchDB) {
+	err := PrepareDB(ctx, db)
+	require.NoError(t, err)
+
+	const userID int64 = 101800
+
+	queryAll := "select id, name, user_id, create_time from items where user_id = $1 order by id"
+	execInsert := "insert into items (name, user_id) values ($1, $2)"
+
+	var items, otherItems []Item
+
+	b := &dbbatch.Batch{}
+	inserted := b.Add(func(ctx context.Context) error {
+		_, err := db.ExecContext(ctx, execInsert, "first", userID)
+		return err
+	})
+	b.AddAfter([]dbbatch.Handle{inserted}, func(ctx context.Context) error {
+		return db.SelectContext(ctx, &items, queryAll, userID)
+	})
+	b.Add(func(ctx context.Context) error {
+		return db.SelectContext(ctx, &otherItems, queryAll, userID+1)
+	})
+
+	err = db.SendBatch(ctx, b)
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, "first", items[0].Name)
+	assert.Empty(t, otherItems)
+
+	t.Run("dependent is skipped", func(t *testing.T) {
+		someErr := errors.New("some error")
+		called := false
+
+		b := &dbbatch.Batch{}
+		failed := b.Add(func(ctx context.Context) error {
+			return someErr
+		})
+		b.AddAfter([]dbbatch.Handle{failed}, func(ctx context.Context) error {
+			called = true
+			return nil
+		})
+
+		err := db.SendBatch(ctx, b)
+		require.ErrorIs(t, err, someErr)
+		assert.False(t, called)
+	})
+}
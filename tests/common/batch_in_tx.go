@@ -0,0 +1,82 @@
+//go:build integration
+
+package common
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/inna-maikut/dbbatch"
+)
+
+func BatchInTx(ctx context.Context, t *testing.T, db *dbbatch.BatchDB) {
+	err := PrepareDB(ctx, db)
+	require.NoError(t, err)
+
+	const (
+		nameFirst        = "first"
+		nameSecond       = "second"
+		userID     int64 = 100800
+	)
+
+	queryAll := "select id, name, user_id, create_time from items where user_id = $1 order by id"
+	execInsert := "insert into items (name, user_id) values ($1, $2)"
+
+	newBatch := func(cbErr error) *dbbatch.Batch {
+		b := &dbbatch.Batch{}
+
+		b.Add(func(ctx context.Context) error {
+			_, err := db.ExecContext(ctx, execInsert, nameFirst, userID)
+			if err != nil {
+				return err
+			}
+
+			var items []Item
+			err = db.SelectContext(ctx, &items, queryAll, userID)
+			if err != nil {
+				return err
+			}
+			assert.NotEmpty(t, items)
+
+			return nil
+		})
+
+		b.Add(func(ctx context.Context) error {
+			_, err := db.ExecContext(ctx, execInsert, nameSecond, userID)
+			if err != nil {
+				return err
+			}
+
+			return cbErr
+		})
+
+		return b
+	}
+
+	t.Run("rollback", func(t *testing.T) {
+		someErr := errors.New("some error")
+
+		err := db.SendBatchInTx(ctx, newBatch(someErr), &sql.TxOptions{Isolation: sql.LevelSerializable})
+		require.ErrorIs(t, err, someErr)
+
+		var items []Item
+		err = db.SelectContext(ctx, &items, queryAll, userID)
+		require.NoError(t, err)
+		assert.Empty(t, items)
+	})
+
+	t.Run("commit", func(t *testing.T) {
+		err := db.SendBatchInTx(ctx, newBatch(nil), &sql.TxOptions{})
+		require.NoError(t, err)
+
+		var items []Item
+		err = db.SelectContext(ctx, &items, queryAll, userID)
+		require.NoError(t, err)
+		require.Len(t, items, 2)
+	})
+}
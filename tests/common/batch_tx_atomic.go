@@ -0,0 +1,66 @@
+//go:build integration
+
+package common
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/inna-maikut/dbbatch"
+)
+
+func BatchTxAtomic(ctx context.Context, t *testing.T, db *dbbatch.BatchDB) {
+	err := PrepareDB(ctx, db)
+	require.NoError(t, err)
+
+	const (
+		nameFirst        = "first"
+		nameSecond       = "second"
+		nameThird        = "third"
+		userID     int64 = 100700
+	)
+
+	queryAll := "select id, name, user_id, create_time from items where user_id = $1 order by id"
+	execInsert := "insert into items (name, user_id) values ($1, $2)"
+
+	btx, err := db.BeginBatchTx(ctx, &sql.TxOptions{})
+	require.NoError(t, err)
+
+	_, err = btx.ExecContext(ctx, execInsert, nameFirst, userID)
+	require.NoError(t, err)
+
+	b := &dbbatch.Batch{}
+
+	b.Add(func(ctx context.Context) error {
+		_, err := btx.ExecContext(ctx, execInsert, nameSecond, userID)
+		return err
+	})
+
+	b.Add(func(ctx context.Context) error {
+		// division by zero fails during execution of the pipeline
+		_, err := btx.ExecContext(ctx, "insert into items (name, user_id) values ($1, 1 / $2::bigint)", nameSecond, 0)
+		return err
+	})
+
+	err = btx.SendBatchAtomic(ctx, b)
+	require.Error(t, err)
+
+	// all changes of the batch are rolled back, transaction is still usable
+	_, err = btx.ExecContext(ctx, execInsert, nameThird, userID)
+	require.NoError(t, err)
+
+	err = btx.Commit()
+	require.NoError(t, err)
+
+	var items []Item
+	err = db.SelectContext(ctx, &items, queryAll, userID)
+	require.NoError(t, err)
+
+	require.Len(t, items, 2)
+	assert.Equal(t, nameFirst, items[0].Name)
+	assert.Equal(t, nameThird, items[1].Name)
+}
@@ -0,0 +1,84 @@
+//go:build integration
+
+package common
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/inna-maikut/dbbatch"
+)
+
+func BufferedRows(ctx context.Context, t *testing.T, db *dbbatch.BatchDB) {
+	err := PrepareDB(ctx, db)
+	require.NoError(t, err)
+
+	const userID int64 = 101600
+
+	names := []string{"first", "second", "third"}
+	for _, name := range names {
+		_, err = db.ExecContext(ctx, "insert into items (name, user_id) values ($1, $2)", name, userID)
+		require.NoError(t, err)
+	}
+
+	queryNames := "select name from items where user_id = $1 order by id"
+
+	scanNames := func(t *testing.T, rows *sql.Rows) []string {
+		defer rows.Close()
+
+		var res []string
+		for rows.Next() {
+			var name string
+			require.NoError(t, rows.Scan(&name))
+			res = append(res, name)
+		}
+		require.NoError(t, rows.Err())
+
+		return res
+	}
+
+	t.Run("rows are read after the batch", func(t *testing.T) {
+		bdb := dbbatch.New(db.DB, dbbatch.WithBufferedRows(0))
+
+		var rows1, rows2 *sql.Rows
+
+		b := &dbbatch.Batch{}
+		b.Add(func(ctx context.Context) (err error) {
+			rows1, err = bdb.QueryContext(ctx, queryNames, userID)
+			return err
+		})
+		b.Add(func(ctx context.Context) (err error) {
+			rows2, err = bdb.QueryContext(ctx, queryNames, userID)
+			return err
+		})
+
+		err := bdb.SendBatch(ctx, b)
+		require.NoError(t, err)
+
+		assert.Equal(t, names, scanNames(t, rows2))
+		assert.Equal(t, names, scanNames(t, rows1))
+	})
+
+	t.Run("max bytes", func(t *testing.T) {
+		bdb := dbbatch.New(db.DB, dbbatch.WithBufferedRows(len("first")+len("second")))
+
+		var res2 []string
+
+		b := &dbbatch.Batch{}
+		b.Add(func(ctx context.Context) error {
+			var res []string
+			return bdb.SelectContext(ctx, &res, queryNames, userID)
+		})
+		b.Add(func(ctx context.Context) error {
+			return bdb.SelectContext(ctx, &res2, queryNames+" limit 2", userID)
+		})
+
+		err := bdb.SendBatch(ctx, b)
+		require.ErrorContains(t, err, "buffered rows are too large")
+		assert.Equal(t, names[:2], res2)
+	})
+}
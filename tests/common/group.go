@@ -0,0 +1,66 @@
+//go:build integration
+
+package common
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/inna-maikut/dbbatch"
+)
+
+func Group(ctx context.Context, t *testing.T, db *dbbatch.BatchDB) {
+	err := PrepareDB(ctx, db)
+	require.NoError(t, err)
+
+	const userID int64 = 101700
+
+	names := []string{"first", "second", "third"}
+	for _, name := range names {
+		_, err = db.ExecContext(ctx, "insert into items (name, user_id) values ($1, $2)", name, userID)
+		require.NoError(t, err)
+	}
+
+	queryCount := "select count(*) from items where user_id = $1 and name = $2"
+
+	counts := make([]int, len(names))
+	var total int
+
+	b := &dbbatch.Batch{}
+	b.Add(func(ctx context.Context) error {
+		g := dbbatch.NewGroup(ctx)
+		for i, name := range names {
+			i, name := i, name
+			g.Go(func(ctx context.Context) error {
+				return db.GetContext(ctx, &counts[i], queryCount, userID, name)
+			})
+		}
+		if err := g.Wait(); err != nil {
+			return err
+		}
+
+		return db.GetContext(ctx, &total, "select count(*) from items where user_id = $1", userID)
+	})
+
+	err = db.SendBatch(ctx, b)
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 1, 1}, counts)
+	assert.Equal(t, 3, total)
+
+	t.Run("without batch", func(t *testing.T) {
+		counts := make([]int, len(names))
+
+		g := dbbatch.NewGroup(ctx)
+		for i, name := range names {
+			i, name := i, name
+			g.Go(func(ctx context.Context) error {
+				return db.GetContext(ctx, &counts[i], queryCount, userID, name)
+			})
+		}
+		require.NoError(t, g.Wait())
+		assert.Equal(t, []int{1, 1, 1}, counts)
+	})
+}
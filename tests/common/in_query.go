@@ -0,0 +1,73 @@
+//go:build integration
+
+package common
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/inna-maikut/dbbatch"
+)
+
+func InQuery(ctx context.Context, t *testing.T, db *dbbatch.BatchDB) {
+	err := PrepareDB(ctx, db)
+	require.NoError(t, err)
+
+	const userID int64 = 101400
+
+	names := []string{"first", "second", "third"}
+	for _, name := range names {
+		_, err = db.ExecContext(ctx, "insert into items (name, user_id) values ($1, $2)", name, userID)
+		require.NoError(t, err)
+	}
+
+	querySelect := "select id, name, user_id, create_time from items where user_id = ? and name in (?) order by id"
+	queryCount := "select count(*) from items where user_id = ? and name in (?)"
+
+	var (
+		items1, items2 []Item
+		count          int
+	)
+
+	b := &dbbatch.Batch{}
+	b.Add(func(ctx context.Context) error {
+		return db.InSelectContext(ctx, &items1, querySelect, userID, names[:2])
+	})
+	b.Add(func(ctx context.Context) error {
+		return db.InSelectContext(ctx, &items2, querySelect, userID, names[1:])
+	})
+	b.Add(func(ctx context.Context) error {
+		return db.InGetContext(ctx, &count, queryCount, userID, names)
+	})
+
+	err = db.SendBatch(ctx, b)
+	require.NoError(t, err)
+
+	require.Len(t, items1, 2)
+	assert.Equal(t, "first", items1[0].Name)
+	require.Len(t, items2, 2)
+	assert.Equal(t, "third", items2[1].Name)
+	assert.Equal(t, 3, count)
+
+	t.Run("tx", func(t *testing.T) {
+		tx, err := db.BeginBatchTx(ctx, nil)
+		require.NoError(t, err)
+		defer func() {
+			_ = tx.Rollback()
+		}()
+
+		var items []Item
+
+		b := &dbbatch.Batch{}
+		b.Add(func(ctx context.Context) error {
+			return tx.InSelectContext(ctx, &items, querySelect, userID, names)
+		})
+
+		err = tx.SendBatch(ctx, b)
+		require.NoError(t, err)
+		assert.Len(t, items, 3)
+	})
+}
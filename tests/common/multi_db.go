@@ -0,0 +1,91 @@
+//go:build integration
+
+package common
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/inna-maikut/dbbatch"
+)
+
+func MultiDB(ctx context.Context, t *testing.T, db *dbbatch.BatchDB) {
+	err := PrepareDB(ctx, db)
+	require.NoError(t, err)
+
+	const userID int64 = 101100
+
+	queryAll := "select id, name, user_id, create_time from items where user_id = $1 order by id"
+	execInsert := "insert into items (name, user_id) values ($1, $2)"
+
+	// both shards are in the same database, but use separate batch connections
+	multi := dbbatch.NewMultiDB(map[string]*dbbatch.BatchDB{
+		"first":  dbbatch.New(db.DB),
+		"second": dbbatch.New(db.DB),
+	})
+
+	b := &dbbatch.Batch{}
+	for _, key := range []string{"first", "second"} {
+		key := key
+		b.Add(func(ctx context.Context) error {
+			_, err := multi.Shard(key).ExecContext(ctx, execInsert, key, userID)
+			return err
+		})
+	}
+
+	err = multi.SendBatch(ctx, b)
+	require.NoError(t, err)
+
+	var items []Item
+	err = db.SelectContext(ctx, &items, queryAll, userID)
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+
+	t.Run("callback queries several shards", func(t *testing.T) {
+		var first, second []Item
+
+		b := &dbbatch.Batch{}
+		b.Add(func(ctx context.Context) error {
+			err := multi.Shard("first").SelectContext(ctx, &first, queryAll, userID)
+			if err != nil {
+				return err
+			}
+			return multi.Shard("second").SelectContext(ctx, &second, queryAll, userID)
+		})
+
+		err := multi.SendBatch(ctx, b)
+		require.NoError(t, err)
+		assert.Len(t, first, 2)
+		assert.Len(t, second, 2)
+	})
+
+	t.Run("errors of callbacks are joined", func(t *testing.T) {
+		b := &dbbatch.Batch{}
+		b.Add(func(ctx context.Context) error {
+			_, err := multi.Shard("first").ExecContext(ctx, "select 1/0")
+			return err
+		})
+		b.Add(func(ctx context.Context) error {
+			var items []Item
+			return multi.Shard("second").SelectContext(ctx, &items, queryAll, userID)
+		})
+
+		err := multi.SendBatch(ctx, b)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "division by zero")
+	})
+
+	t.Run("query of another shard in the batch of a shard", func(t *testing.T) {
+		b := &dbbatch.Batch{}
+		b.Add(func(ctx context.Context) error {
+			_, err := multi.Shard("second").ExecContext(ctx, execInsert, "wrong", userID)
+			return err
+		})
+
+		err := multi.Shard("first").SendBatch(ctx, b)
+		require.ErrorIs(t, err, dbbatch.ErrForeignBatchConn)
+	})
+}
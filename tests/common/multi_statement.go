@@ -0,0 +1,73 @@
+//go:build integration
+
+package common
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/inna-maikut/dbbatch"
+	"github.com/inna-maikut/dbbatch/multistmt"
+)
+
+// MultiStatement checks batches of db opened with the multistmt driver over lib/pq
+func MultiStatement(ctx context.Context, t *testing.T, db *dbbatch.BatchDB) {
+	err := PrepareDB(ctx, db)
+	require.NoError(t, err)
+
+	const userID int64 = 102300
+
+	queryAll := "select id, name, user_id, create_time from items where user_id = $1 order by id"
+	execInsert := "insert into items (name, user_id) values ($1, $2)"
+
+	var items []Item
+	b := &dbbatch.Batch{}
+	first := b.Add(func(ctx context.Context) error {
+		_, err := db.ExecContext(ctx, execInsert, "first", userID)
+		return err
+	})
+	second := b.Add(func(ctx context.Context) error {
+		_, err := db.ExecContext(ctx, execInsert, "it's \\ second", userID)
+		return err
+	})
+	b.AddAfter([]dbbatch.Handle{first, second}, func(ctx context.Context) error {
+		return db.SelectContext(ctx, &items, queryAll, userID)
+	})
+
+	err = db.SendBatch(ctx, b)
+	require.NoError(t, err)
+	require.Len(t, items, 2)
+	assert.Equal(t, "first", items[0].Name)
+	assert.Equal(t, "it's \\ second", items[1].Name)
+
+	t.Run("error", func(t *testing.T) {
+		var errs [3]error
+		b := &dbbatch.Batch{}
+		b.Add(func(ctx context.Context) error {
+			_, errs[0] = db.ExecContext(ctx, execInsert, "third", userID)
+			return nil
+		})
+		b.Add(func(ctx context.Context) error {
+			_, errs[1] = db.ExecContext(ctx, "select * from missing_table")
+			return nil
+		})
+		b.Add(func(ctx context.Context) error {
+			_, errs[2] = db.ExecContext(ctx, execInsert, "fourth", userID)
+			return nil
+		})
+
+		err := db.SendBatch(ctx, b)
+		require.NoError(t, err)
+		assert.ErrorIs(t, errs[0], multistmt.ErrRolledBack)
+		assert.ErrorContains(t, errs[1], "missing_table")
+		assert.ErrorIs(t, errs[2], multistmt.ErrSkipped)
+
+		// the round runs in the implicit transaction, the first insert is rolled back
+		err = db.SelectContext(ctx, &items, queryAll, userID)
+		require.NoError(t, err)
+		assert.Len(t, items, 2)
+	})
+}
@@ -0,0 +1,95 @@
+//go:build integration
+
+package common
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/inna-maikut/dbbatch"
+)
+
+// NamedArgs checks sql.Named and pgx.NamedArgs args in batch, pgxNamedArgs creates pgx.NamedArgs
+func NamedArgs(ctx context.Context, t *testing.T, db *dbbatch.BatchDB, pgxNamedArgs func(args map[string]any) any) {
+	err := PrepareDB(ctx, db)
+	require.NoError(t, err)
+
+	const userID int64 = 101500
+
+	execInsert := "insert into items (name, user_id) values (@name, @user_id)"
+	queryCount := "select count(*) from items where user_id = @user_id and name = @name"
+
+	var count1, count2 int
+
+	b := &dbbatch.Batch{}
+	b.Add(func(ctx context.Context) error {
+		_, err := db.ExecContext(ctx, execInsert, sql.Named("user_id", userID), sql.Named("name", "first"))
+		if err != nil {
+			return err
+		}
+
+		return db.GetContext(ctx, &count1, queryCount, sql.Named("name", "first"), sql.Named("user_id", userID))
+	})
+	b.Add(func(ctx context.Context) error {
+		_, err := db.ExecContext(ctx, execInsert, pgxNamedArgs(map[string]any{"name": "second", "user_id": userID}))
+		if err != nil {
+			return err
+		}
+
+		return db.GetContext(ctx, &count2, queryCount, pgxNamedArgs(map[string]any{"name": "second", "user_id": userID}))
+	})
+
+	err = db.SendBatch(ctx, b)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count1)
+	assert.Equal(t, 1, count2)
+
+	t.Run("mixed named and positional", func(t *testing.T) {
+		var count int
+		var mixedErr error
+		b := &dbbatch.Batch{}
+		b.Add(func(ctx context.Context) error {
+			var count int
+			mixedErr = db.GetContext(ctx, &count, "select count(*) from items where user_id = $1 and name = @name",
+				userID, sql.Named("name", "first"))
+			return nil
+		})
+		b.Add(func(ctx context.Context) error {
+			return db.GetContext(ctx, &count, queryCount, sql.Named("name", "first"), sql.Named("user_id", userID))
+		})
+
+		// the request is rejected before queueing, other requests of the round are sent
+		err := db.SendBatch(ctx, b)
+		require.NoError(t, err)
+		require.ErrorContains(t, mixedErr, "mixing named and positional args is not supported")
+		assert.Equal(t, 1, count)
+	})
+}
+
+// NamedArgsUnsupported checks that the driver rejects sql.Named args in batch
+func NamedArgsUnsupported(ctx context.Context, t *testing.T, db *dbbatch.BatchDB) {
+	err := PrepareDB(ctx, db)
+	require.NoError(t, err)
+
+	var count int
+	var namedErr error
+	b := &dbbatch.Batch{}
+	b.Add(func(ctx context.Context) error {
+		var count int
+		namedErr = db.GetContext(ctx, &count, "select count(*) from items where user_id = @user_id",
+			sql.Named("user_id", 1))
+		return nil
+	})
+	b.Add(func(ctx context.Context) error {
+		return db.GetContext(ctx, &count, "select count(*) from items where user_id = $1", 1)
+	})
+
+	// only the query with named args fails, other requests of the round are sent
+	err = db.SendBatch(ctx, b)
+	require.NoError(t, err)
+	require.ErrorContains(t, namedErr, "named args are not supported")
+}
@@ -214,3 +214,35 @@ func Perf(ctx context.Context, t *testing.T, db *dbbatch.BatchDB, iterationCount
 		res.SeqBatchRate,
 	)
 }
+
+// BenchBatch measures sending of one batch with execCount update callbacks per benchmark iteration.
+// Allocations are reported, so the versions can be compared with benchstat.
+func BenchBatch(ctx context.Context, b *testing.B, db *dbbatch.BatchDB, execCount int) {
+	err := PrepareDB(ctx, db)
+	require.NoError(b, err)
+
+	const (
+		nameFirst       = "first"
+		userID    int64 = 100600
+	)
+
+	items := make([]Item, 0, execCount)
+	for i := int64(0); i < int64(execCount); i++ {
+		items = append(items, Item{
+			Name:   nameFirst,
+			UserID: userID + i,
+		})
+	}
+	_, err = db.NamedExec("insert into items (name, user_id) values (:name, :user_id)", items)
+	require.NoError(b, err)
+
+	var duration time.Duration
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for j := 0; j < b.N; j++ {
+		err = measureBatch(ctx, db, &duration, execCount, userID)
+		require.NoError(b, err)
+	}
+}
@@ -0,0 +1,90 @@
+//go:build integration
+
+package common
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/inna-maikut/dbbatch"
+)
+
+// ReadReplicas expects replica with default_transaction_read_only = on
+func ReadReplicas(ctx context.Context, t *testing.T, db *dbbatch.BatchDB, replica *sqlx.DB) {
+	err := PrepareDB(ctx, db)
+	require.NoError(t, err)
+
+	const (
+		nameFirst       = "first"
+		userID    int64 = 101000
+	)
+
+	queryAll := "select id, name, user_id, create_time from items where user_id = $1 order by id"
+	execInsert := "insert into items (name, user_id) values ($1, $2)"
+
+	_, err = db.ExecContext(ctx, execInsert, nameFirst, userID)
+	require.NoError(t, err)
+
+	for _, policy := range []dbbatch.ReplicaPolicy{dbbatch.ReplicaRoundRobin, dbbatch.ReplicaLeastLoaded} {
+		rdb := dbbatch.New(db.DB, dbbatch.WithReplicas(replica), dbbatch.WithReplicaPolicy(policy))
+
+		t.Run("read batch", func(t *testing.T) {
+			var items1, items2 []Item
+
+			b := &dbbatch.Batch{}
+			b.Add(func(ctx context.Context) error {
+				return rdb.SelectContext(ctx, &items1, queryAll, userID)
+			})
+			b.Add(func(ctx context.Context) error {
+				return rdb.SelectContext(ctx, &items2, queryAll, userID)
+			})
+
+			err := rdb.SendReadBatch(ctx, b)
+			require.NoError(t, err)
+
+			require.Len(t, items1, 1)
+			assert.Equal(t, nameFirst, items1[0].Name)
+			assert.Equal(t, items1, items2)
+		})
+
+		t.Run("write in read batch goes to replica", func(t *testing.T) {
+			b := &dbbatch.Batch{}
+			b.Add(func(ctx context.Context) error {
+				_, err := rdb.ExecContext(ctx, execInsert, nameFirst, userID)
+				return err
+			})
+
+			err := rdb.SendBatch(dbbatch.ReadOnly(ctx), b)
+			require.Error(t, err)
+		})
+
+		t.Run("write batch goes to primary", func(t *testing.T) {
+			b := &dbbatch.Batch{}
+			b.Add(func(ctx context.Context) error {
+				_, err := rdb.ExecContext(ctx, execInsert, nameFirst, userID)
+				return err
+			})
+
+			err := rdb.SendBatch(ctx, b)
+			require.NoError(t, err)
+
+			_, err = db.ExecContext(ctx, "delete from items where user_id = $1 and id > (select min(id) from items where user_id = $1)", userID)
+			require.NoError(t, err)
+		})
+
+		t.Run("tx goes to primary", func(t *testing.T) {
+			tx, err := rdb.BeginBatchTx(dbbatch.ReadOnly(ctx), nil)
+			require.NoError(t, err)
+			defer func() {
+				_ = tx.Rollback()
+			}()
+
+			_, err = tx.ExecContext(ctx, execInsert, nameFirst, userID)
+			require.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,64 @@
+//go:build integration
+
+package common
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/inna-maikut/dbbatch"
+	"github.com/inna-maikut/dbbatch/dbbatchtest"
+)
+
+// RecordReplay records the batch against the database and replays it offline with the same results
+func RecordReplay(ctx context.Context, t *testing.T, db *dbbatch.BatchDB, driverName, dsn string) {
+	err := PrepareDB(ctx, db)
+	require.NoError(t, err)
+
+	const userID int64 = 102000
+
+	for i := int64(0); i < 2; i++ {
+		_, err = db.ExecContext(ctx, "insert into items (name, user_id) values ($1, $2)", "first", userID+i)
+		require.NoError(t, err)
+	}
+
+	scenario := func(db *dbbatch.BatchDB) ([][]Item, error) {
+		items := make([][]Item, 3)
+
+		b := &dbbatch.Batch{}
+		for i := range items {
+			i := i
+			b.Add(func(ctx context.Context) error {
+				_, err := db.ExecContext(ctx, "update items set name = $1 where user_id = $2", "second", userID+int64(i))
+				if err != nil {
+					return err
+				}
+				return db.SelectContext(ctx, &items[i],
+					"select id, name, user_id, create_time from items where user_id = $1 order by id", userID+int64(i))
+			})
+		}
+
+		err := db.SendBatchInTx(ctx, b, nil)
+		return items, err
+	}
+
+	path := filepath.Join(t.TempDir(), "batch.jsonl")
+	recorder, err := dbbatchtest.Record(driverName, dsn, path)
+	require.NoError(t, err)
+
+	recorded, err := scenario(dbbatch.New(recorder.DB()))
+	require.NoError(t, err)
+	require.NoError(t, recorder.Close())
+	require.Len(t, recorded[0], 1)
+	assert.Equal(t, "second", recorded[0][0].Name)
+	assert.Empty(t, recorded[2])
+
+	fake := dbbatchtest.Replay(t, path)
+	replayed, err := scenario(fake.BatchDB())
+	require.NoError(t, err)
+	assert.Equal(t, recorded, replayed)
+}
@@ -0,0 +1,59 @@
+//go:build integration
+
+package common
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/inna-maikut/dbbatch"
+	"github.com/inna-maikut/dbbatch/dbbatchtest"
+)
+
+func RoundTrips(ctx context.Context, t *testing.T, db *dbbatch.BatchDB) {
+	err := PrepareDB(ctx, db)
+	require.NoError(t, err)
+
+	const userID int64 = 101900
+
+	queryAll := "select id, name, user_id, create_time from items where user_id = $1 order by id"
+	execInsert := "insert into items (name, user_id) values ($1, $2)"
+
+	counter := dbbatchtest.CountRoundTrips(db)
+	cdb := counter.DB()
+
+	items := make([][]Item, 3)
+
+	b := &dbbatch.Batch{}
+	for i := range items {
+		i := i
+		b.Add(func(ctx context.Context) error {
+			if _, err := cdb.ExecContext(ctx, execInsert, "item", userID+int64(i)); err != nil {
+				return err
+			}
+			// any BatchDB in the callback uses the batch connection from the context
+			return db.SelectContext(ctx, &items[i], queryAll, userID+int64(i))
+		})
+	}
+
+	err = cdb.SendBatch(ctx, b)
+	require.NoError(t, err)
+	for i := range items {
+		assert.Len(t, items[i], 1)
+	}
+	assert.Equal(t, 2, counter.RoundTrips())
+	counter.AssertMaxRoundTrips(t, 2)
+	counter.AssertAllBatched(t)
+
+	// N+1 regression: loading without batch
+	counter.Reset()
+	for i := range items {
+		err = cdb.SelectContext(ctx, &items[i], queryAll, userID+int64(i))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 3, counter.RoundTrips())
+	assert.Len(t, counter.NotBatched(), 3)
+}
@@ -0,0 +1,67 @@
+//go:build integration
+
+package common
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/inna-maikut/dbbatch"
+)
+
+type serializationFailure struct{}
+
+func (serializationFailure) Error() string {
+	return "could not serialize access due to concurrent update"
+}
+
+func (serializationFailure) SQLState() string {
+	return "40001"
+}
+
+func RunInBatchTx(ctx context.Context, t *testing.T, db *dbbatch.BatchDB) {
+	err := PrepareDB(ctx, db)
+	require.NoError(t, err)
+
+	const (
+		nameFirst       = "first"
+		userID    int64 = 100900
+	)
+
+	queryAll := "select id, name, user_id, create_time from items where user_id = $1 order by id"
+	execInsert := "insert into items (name, user_id) values ($1, $2)"
+
+	attempts := 0
+
+	err = db.RunInBatchTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable}, func(tx *dbbatch.BatchTx) error {
+		attempts++
+
+		b := &dbbatch.Batch{}
+		b.Add(func(ctx context.Context) error {
+			_, err := tx.ExecContext(ctx, execInsert, nameFirst, userID)
+			return err
+		})
+
+		err := tx.SendBatch(ctx, b)
+		if err != nil {
+			return err
+		}
+
+		if attempts == 1 {
+			return serializationFailure{}
+		}
+
+		return nil
+	}, dbbatch.RetryPolicy{MaxAttempts: 3})
+	require.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+
+	var items []Item
+	err = db.SelectContext(ctx, &items, queryAll, userID)
+	require.NoError(t, err)
+	assert.Len(t, items, 1)
+}
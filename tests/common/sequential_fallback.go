@@ -0,0 +1,57 @@
+//go:build integration
+
+package common
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/inna-maikut/dbbatch"
+)
+
+// SequentialFallback checks batches over plainDB opened with the driver without batch sending
+func SequentialFallback(ctx context.Context, t *testing.T, plainDB *sqlx.DB) {
+	const userID int64 = 102200
+
+	queryAll := "select id, name, user_id, create_time from items where user_id = $1 order by id"
+	execInsert := "insert into items (name, user_id) values ($1, $2)"
+
+	db := dbbatch.New(plainDB)
+	err := PrepareDB(ctx, db)
+	require.NoError(t, err)
+
+	assert.False(t, db.SupportsBatching())
+
+	newBatch := func(items *[]Item) *dbbatch.Batch {
+		b := &dbbatch.Batch{}
+		insert := b.Add(func(ctx context.Context) error {
+			_, err := db.ExecContext(ctx, execInsert, "first", userID)
+			return err
+		})
+		b.AddAfter([]dbbatch.Handle{insert}, func(ctx context.Context) error {
+			return db.SelectContext(ctx, items, queryAll, userID)
+		})
+		return b
+	}
+
+	var items []Item
+	err = db.SendBatch(ctx, newBatch(&items))
+	require.ErrorIs(t, err, dbbatch.ErrBatchingNotSupported)
+
+	fallbacks := 0
+	db = db.With(dbbatch.WithSequentialFallback(), dbbatch.WithHooks(dbbatch.Hooks{
+		SequentialFallback: func(ctx context.Context) {
+			fallbacks++
+		},
+	}))
+
+	err = db.SendBatchInTx(ctx, newBatch(&items), nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, fallbacks)
+	require.Len(t, items, 1)
+	assert.Equal(t, "first", items[0].Name)
+}
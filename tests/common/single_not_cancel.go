@@ -58,4 +58,34 @@ func SingleNotCancel(ctx context.Context, t *testing.T, db *dbbatch.BatchDB) {
 
 		assert.Greater(t, time.Since(startTime), 100*time.Millisecond)
 	})
+
+	t.Run("BatchTx_no_cancel", func(t *testing.T) {
+		const userIDTx int64 = 100110
+
+		cancelCtx, cancel := context.WithCancel(ctx)
+
+		btx, err := db.BeginBatchTx(cancelCtx, &sql.TxOptions{})
+		require.NoError(t, err)
+
+		cancel()
+
+		_, err = btx.ExecContext(cancelCtx, "insert into items (name, user_id) values ($1, $2)", nameFirst, userIDTx)
+		require.NoError(t, err)
+
+		b := &dbbatch.Batch{}
+		b.Add(func(ctx context.Context) error {
+			_, err := btx.ExecContext(ctx, "insert into items (name, user_id) values ($1, $2)", nameSecond, userIDTx)
+			return err
+		})
+		err = btx.SendBatch(cancelCtx, b)
+		require.NoError(t, err)
+
+		err = btx.Commit()
+		require.NoError(t, err)
+
+		var items []Item
+		err = db.SelectContext(ctx, &items, "select * from items where user_id = $1", userIDTx)
+		require.NoError(t, err)
+		assert.Len(t, items, 2)
+	})
 }
@@ -0,0 +1,70 @@
+//go:build integration
+
+package common
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/inna-maikut/dbbatch"
+)
+
+func SQLDB(ctx context.Context, t *testing.T, db *sql.DB) {
+	sdb := dbbatch.NewSQL(db)
+
+	const userID int64 = 101200
+
+	queryCount := "select count(*) from items where user_id = $1"
+	execInsert := "insert into items (name, user_id) values ($1, $2)"
+
+	t.Run("batch", func(t *testing.T) {
+		var count1, count2 int
+
+		b := &dbbatch.Batch{}
+		b.Add(func(ctx context.Context) error {
+			_, err := sdb.ExecContext(ctx, execInsert, "first", userID)
+			if err != nil {
+				return err
+			}
+
+			return sdb.QueryRowContext(ctx, queryCount, userID).Scan(&count1)
+		})
+		b.Add(func(ctx context.Context) error {
+			_, err := sdb.ExecContext(ctx, execInsert, "second", userID)
+			if err != nil {
+				return err
+			}
+
+			return sdb.QueryRowContext(ctx, queryCount, userID).Scan(&count2)
+		})
+
+		err := sdb.SendBatch(ctx, b)
+		require.NoError(t, err)
+		assert.Equal(t, 2, count1)
+		assert.Equal(t, 2, count2)
+	})
+
+	t.Run("batch tx", func(t *testing.T) {
+		tx, err := sdb.BeginBatchTx(ctx, nil)
+		require.NoError(t, err)
+
+		b := &dbbatch.Batch{}
+		b.Add(func(ctx context.Context) error {
+			_, err := tx.ExecContext(ctx, execInsert, "third", userID)
+			return err
+		})
+
+		err = tx.SendBatch(ctx, b)
+		require.NoError(t, err)
+		require.NoError(t, tx.Rollback())
+
+		var count int
+		err = sdb.QueryRowContext(ctx, queryCount, userID).Scan(&count)
+		require.NoError(t, err)
+		assert.Equal(t, 2, count)
+	})
+}
@@ -0,0 +1,74 @@
+//go:build integration
+
+package common
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/inna-maikut/dbbatch"
+	"github.com/inna-maikut/dbbatch/tests/common/sqlcgen"
+)
+
+func SQLC(ctx context.Context, t *testing.T, db *dbbatch.BatchDB) {
+	err := PrepareDB(ctx, db)
+	require.NoError(t, err)
+
+	const userID int64 = 101300
+
+	run := func(t *testing.T, q *sqlcgen.Queries, userID int64) {
+		var (
+			items []sqlcgen.Item
+			count int64
+		)
+
+		b := &dbbatch.Batch{}
+		b.Add(func(ctx context.Context) error {
+			err := q.CreateItem(ctx, sqlcgen.CreateItemParams{
+				Name:   sql.NullString{String: "first", Valid: true},
+				UserID: userID,
+			})
+			if err != nil {
+				return err
+			}
+
+			items, err = q.ListItemsByUser(ctx, userID)
+			return err
+		})
+		b.Add(func(ctx context.Context) error {
+			err := q.CreateItem(ctx, sqlcgen.CreateItemParams{
+				Name:   sql.NullString{String: "second", Valid: true},
+				UserID: userID,
+			})
+			if err != nil {
+				return err
+			}
+
+			count, err = q.CountItemsByUser(ctx, userID)
+			return err
+		})
+
+		err := db.SendBatch(ctx, b)
+		require.NoError(t, err)
+		assert.Len(t, items, 2)
+		assert.Equal(t, int64(2), count)
+	}
+
+	t.Run("queries", func(t *testing.T) {
+		run(t, sqlcgen.New(dbbatch.SQLC(db)), userID)
+	})
+
+	t.Run("prepared queries", func(t *testing.T) {
+		q, err := sqlcgen.Prepare(ctx, dbbatch.SQLC(db))
+		require.NoError(t, err)
+		defer func() {
+			_ = q.Close()
+		}()
+
+		run(t, q, userID+1)
+	})
+}
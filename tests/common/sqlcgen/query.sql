@@ -0,0 +1,8 @@
+-- name: CreateItem :exec
+insert into items (name, user_id) values ($1, $2);
+
+-- name: ListItemsByUser :many
+select id, name, user_id, create_time from items where user_id = $1 order by id;
+
+-- name: CountItemsByUser :one
+select count(*) from items where user_id = $1;
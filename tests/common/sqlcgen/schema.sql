@@ -0,0 +1,6 @@
+create table items (
+    id bigserial primary key,
+    name text,
+    user_id bigint not null,
+    create_time timestamp with time zone default now()
+);
@@ -0,0 +1,73 @@
+//go:build integration
+
+package common
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/inna-maikut/dbbatch"
+)
+
+func StrictBatching(ctx context.Context, t *testing.T, db *dbbatch.BatchDB) {
+	err := PrepareDB(ctx, db)
+	require.NoError(t, err)
+
+	const userID int64 = 102100
+
+	queryAll := "select id, name, user_id, create_time from items where user_id = $1 order by id"
+	execInsert := "insert into items (name, user_id) values ($1, $2)"
+
+	strict := db.With(dbbatch.WithStrictBatching())
+
+	var items []Item
+	b := &dbbatch.Batch{}
+	b.Add(func(ctx context.Context) error {
+		_, err := strict.ExecContext(ctx, execInsert, "first", userID)
+		return err
+	})
+	b.Add(func(ctx context.Context) error {
+		return strict.SelectContext(ctx, &items, queryAll, userID)
+	})
+
+	err = strict.SendBatch(ctx, b)
+	require.NoError(t, err)
+
+	t.Run("bypassed", func(t *testing.T) {
+		b := &dbbatch.Batch{}
+		// callbacks use ctx of SendBatch instead of their own one
+		b.Add(func(context.Context) error {
+			return strict.SelectContext(ctx, &items, queryAll, userID)
+		})
+		var rowErr error
+		b.Add(func(context.Context) error {
+			var name string
+			rowErr = strict.QueryRowxContext(dbbatch.LastQuery(ctx), "select name from items where user_id = $1", userID).
+				Scan(&name)
+			return nil
+		})
+
+		err := strict.SendBatch(ctx, b)
+		assert.ErrorIs(t, err, dbbatch.ErrBypassedBatch)
+		assert.ErrorIs(t, rowErr, dbbatch.ErrBypassedBatch)
+
+		// methods without context use context.Background() like the batch
+		b = &dbbatch.Batch{}
+		b.Add(func(context.Context) error {
+			_, err := strict.Exec(execInsert, "second", userID)
+			return err
+		})
+
+		err = strict.SendBatch(context.Background(), b)
+		assert.ErrorIs(t, err, dbbatch.ErrBypassedBatch)
+
+		// no running batch
+		err = strict.SelectContext(ctx, &items, queryAll, userID)
+		require.NoError(t, err)
+		require.Len(t, items, 1)
+		assert.Equal(t, "first", items[0].Name)
+	})
+}
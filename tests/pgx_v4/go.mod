@@ -8,6 +8,7 @@ require (
 	github.com/inna-maikut/dbbatch v0.3.5
 	github.com/jackc/pgx/v4 v4.18.1
 	github.com/jmoiron/sqlx v1.3.5
+	github.com/lib/pq v1.10.2
 	github.com/stretchr/testify v1.8.2
 )
 
@@ -5,6 +5,8 @@ package pgx_v4
 import (
 	"testing"
 
+	"github.com/stretchr/testify/require"
+
 	"github.com/inna-maikut/dbbatch/tests/common"
 )
 
@@ -26,6 +28,116 @@ func TestPgxV4_BatchTx(t *testing.T) {
 	common.BatchTx(ctx, t, db)
 }
 
+func TestPgxV4_BatchTxAtomic(t *testing.T) {
+	ctx, db := setup(t, false)
+
+	common.BatchTxAtomic(ctx, t, db)
+}
+
+func TestPgxV4_BatchInTx(t *testing.T) {
+	ctx, db := setup(t, false)
+
+	common.BatchInTx(ctx, t, db)
+}
+
+func TestPgxV4_RunInBatchTx(t *testing.T) {
+	ctx, db := setup(t, false)
+
+	common.RunInBatchTx(ctx, t, db)
+}
+
+func TestPgxV4_ReadReplicas(t *testing.T) {
+	ctx, db := setup(t, false)
+
+	replica, err := connectReplica()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = replica.Close()
+	})
+
+	common.ReadReplicas(ctx, t, db, replica)
+}
+
+func TestPgxV4_MultiDB(t *testing.T) {
+	ctx, db := setup(t, false)
+
+	common.MultiDB(ctx, t, db)
+}
+
+func TestPgxV4_SQLDB(t *testing.T) {
+	ctx, db := setup(t, false)
+
+	common.SQLDB(ctx, t, db.DB.DB)
+}
+
+func TestPgxV4_SQLC(t *testing.T) {
+	ctx, db := setup(t, false)
+
+	common.SQLC(ctx, t, db)
+}
+
+func TestPgxV4_InQuery(t *testing.T) {
+	ctx, db := setup(t, false)
+
+	common.InQuery(ctx, t, db)
+}
+
+func TestPgxV4_NamedArgsUnsupported(t *testing.T) {
+	ctx, db := setup(t, false)
+
+	common.NamedArgsUnsupported(ctx, t, db)
+}
+
+func TestPgxV4_BufferedRows(t *testing.T) {
+	ctx, db := setup(t, false)
+
+	common.BufferedRows(ctx, t, db)
+}
+
+func TestPgxV4_Group(t *testing.T) {
+	ctx, db := setup(t, false)
+
+	common.Group(ctx, t, db)
+}
+
+func TestPgxV4_BatchAfter(t *testing.T) {
+	ctx, db := setup(t, false)
+
+	common.BatchAfter(ctx, t, db)
+}
+
+func TestPgxV4_RoundTrips(t *testing.T) {
+	ctx, db := setup(t, false)
+
+	common.RoundTrips(ctx, t, db)
+}
+
+func TestPgxV4_RecordReplay(t *testing.T) {
+	ctx, db := setup(t, false)
+	dsn, err := registerConfig(nil)
+	require.NoError(t, err)
+
+	common.RecordReplay(ctx, t, db, "batch_pgx", dsn)
+}
+
+func TestPgxV4_StrictBatching(t *testing.T) {
+	ctx, db := setup(t, false)
+
+	common.StrictBatching(ctx, t, db)
+}
+
+func TestPgxV4_SequentialFallback(t *testing.T) {
+	ctx, _ := setup(t, false)
+
+	common.SequentialFallback(ctx, t, connectWithoutBatching(t))
+}
+
+func TestPgxV4_MultiStatement(t *testing.T) {
+	ctx, _ := setup(t, false)
+
+	common.MultiStatement(ctx, t, connectMultiStatement(t))
+}
+
 func TestPgxV4_BatchManyTimes(t *testing.T) {
 	ctx, db := setup(t, false)
 
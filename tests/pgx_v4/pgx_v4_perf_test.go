@@ -91,3 +91,21 @@ func TestPgxV4_Perf_Big_1000x100(t *testing.T) {
 
 	common.Perf(ctx, t, db, 1000, 100)
 }
+
+func BenchmarkPgxV4_Batch_10(b *testing.B) {
+	ctx, db := setup(b, false)
+
+	common.BenchBatch(ctx, b, db, 10)
+}
+
+func BenchmarkPgxV4_Batch_100(b *testing.B) {
+	ctx, db := setup(b, false)
+
+	common.BenchBatch(ctx, b, db, 100)
+}
+
+func BenchmarkPgxV4_Batch_1000(b *testing.B) {
+	ctx, db := setup(b, false)
+
+	common.BenchBatch(ctx, b, db, 1000)
+}
@@ -0,0 +1,419 @@
+//go:build integration
+
+package pgx_v5
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+
+	"github.com/inna-maikut/dbbatch"
+	"github.com/inna-maikut/dbbatch/internal/pgfake"
+	"github.com/inna-maikut/dbbatch/tests/common"
+)
+
+// setupFake is setup on the fake server without database, so scenarios without transactions
+// and server side functions run in CI
+func setupFake(t *testing.T) (context.Context, *dbbatch.BatchDB) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	server, err := pgfake.Start((&fakeItems{}).handle)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = server.Close()
+	})
+
+	db, err := sqlx.Open("batch_pgx", server.DSN())
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	db.SetMaxOpenConns(5)
+
+	bdb := dbbatch.New(db)
+	require.NoError(t, common.PrepareDB(ctx, bdb))
+
+	return ctx, bdb
+}
+
+func TestPgxV4_Fake_BatchOneStep(t *testing.T) {
+	ctx, db := setupFake(t)
+
+	common.BatchOneStep(ctx, t, db)
+}
+
+func TestPgxV4_Fake_BatchMultiStep(t *testing.T) {
+	ctx, db := setupFake(t)
+
+	common.BatchMultiStep(ctx, t, db)
+}
+
+func TestPgxV4_Fake_BatchManyTimes(t *testing.T) {
+	ctx, db := setupFake(t)
+
+	common.BatchManyTimes(ctx, t, db)
+}
+
+func TestPgxV4_Fake_InQuery(t *testing.T) {
+	ctx, db := setupFake(t)
+
+	common.InQuery(ctx, t, db)
+}
+
+func TestPgxV4_Fake_BufferedRows(t *testing.T) {
+	ctx, db := setupFake(t)
+
+	common.BufferedRows(ctx, t, db)
+}
+
+func TestPgxV4_Fake_Group(t *testing.T) {
+	ctx, db := setupFake(t)
+
+	common.Group(ctx, t, db)
+}
+
+func TestPgxV4_Fake_BatchAfter(t *testing.T) {
+	ctx, db := setupFake(t)
+
+	common.BatchAfter(ctx, t, db)
+}
+
+func TestPgxV4_Fake_RoundTrips(t *testing.T) {
+	ctx, db := setupFake(t)
+
+	common.RoundTrips(ctx, t, db)
+}
+
+func TestPgxV4_Fake_StrictBatching(t *testing.T) {
+	ctx, db := setupFake(t)
+
+	common.StrictBatching(ctx, t, db)
+}
+
+// fakeItems is the items table of tests/common scenarios in memory of pgfake.Server.
+// It knows only the queries of the scenarios, transactions aren't isolated and are never rolled back
+type fakeItems struct {
+	mu     sync.Mutex
+	rows   []fakeItem
+	nextID int64
+}
+
+type fakeItem struct {
+	id         int64
+	name       any // string or nil
+	userID     int64
+	createTime time.Time
+}
+
+var fakeColumnOIDs = map[string]uint32{
+	"id":          pgfake.Int8OID,
+	"name":        0,
+	"user_id":     pgfake.Int8OID,
+	"create_time": pgfake.TimestamptzOID,
+	"count":       pgfake.Int8OID,
+}
+
+var (
+	fakeInsertRe = regexp.MustCompile(`^insert into items \(([\w, ]+)\) values (.+)$`)
+	fakeSelectRe = regexp.MustCompile(`^select (.+?) from items(?: where (.+?))?(?: order by id)?(?: limit (\d+))?$`)
+	fakeUpdateRe = regexp.MustCompile(`^update items set name = \$(\d+) where (.+)$`)
+	fakeDeleteRe = regexp.MustCompile(`^delete from items where (.+)$`)
+	fakeEqRe     = regexp.MustCompile(`^(\w+) = \$(\d+)$`)
+	fakeInRe     = regexp.MustCompile(`^(\w+) in \(([$\d, ]+)\)$`)
+	fakeParamRe  = regexp.MustCompile(`\$(\d+)`)
+)
+
+func (fi *fakeItems) handle(query string, args []any) pgfake.Result {
+	query = strings.Join(strings.Fields(query), " ")
+	lower := strings.ToLower(query)
+
+	switch {
+	case strings.HasPrefix(lower, "drop table"), strings.HasPrefix(lower, "create table"):
+		if args != nil {
+			fi.mu.Lock()
+			fi.rows, fi.nextID = nil, 0
+			fi.mu.Unlock()
+		}
+		return pgfake.Result{}
+	case strings.HasPrefix(lower, "begin"), strings.HasPrefix(lower, "commit"), strings.HasPrefix(lower, "rollback"),
+		strings.HasPrefix(lower, "savepoint"), strings.HasPrefix(lower, "release"), strings.HasPrefix(lower, "set "):
+		return pgfake.Result{}
+	}
+
+	if m := fakeInsertRe.FindStringSubmatch(query); m != nil {
+		return fi.insert(strings.Split(m[1], ", "), m[2], args)
+	}
+	if m := fakeSelectRe.FindStringSubmatch(query); m != nil {
+		return fi.selectRows(m[1], m[2], m[3], args)
+	}
+	if m := fakeUpdateRe.FindStringSubmatch(query); m != nil {
+		return fi.update(m[1], m[2], args)
+	}
+	if m := fakeDeleteRe.FindStringSubmatch(query); m != nil {
+		return fi.delete(m[1], args)
+	}
+
+	return errorResult("42601", "fake items: unknown query: "+query)
+}
+
+func (fi *fakeItems) insert(columns []string, values string, args []any) pgfake.Result {
+	params := fakeParamRe.FindAllStringSubmatch(values, -1)
+	if len(params) == 0 || len(params)%len(columns) != 0 {
+		return errorResult("42601", "fake items: unknown values: "+values)
+	}
+
+	paramOIDs := make([]uint32, len(params))
+	for i := range params {
+		paramOIDs[i] = fakeColumnOIDs[columns[i%len(columns)]]
+	}
+	if args == nil {
+		return pgfake.Result{ParamOIDs: paramOIDs}
+	}
+
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+
+	for i := 0; i < len(params); i += len(columns) {
+		fi.nextID++
+		item := fakeItem{id: fi.nextID, createTime: time.Now().UTC().Truncate(time.Microsecond)}
+		for j, column := range columns {
+			n, _ := strconv.Atoi(params[i+j][1])
+			arg := args[n-1]
+			switch column {
+			case "name":
+				item.name = arg
+			case "user_id":
+				userID, err := toInt64(arg)
+				if err != nil {
+					return errorResult("22P02", err.Error())
+				}
+				item.userID = userID
+			}
+		}
+		fi.rows = append(fi.rows, item)
+	}
+
+	return pgfake.Result{RowsAffected: int64(len(params) / len(columns))}
+}
+
+func (fi *fakeItems) selectRows(what, where, limit string, args []any) pgfake.Result {
+	var columns []string
+	switch what {
+	case "*":
+		columns = []string{"id", "name", "user_id", "create_time"}
+	case "count(*)":
+		columns = []string{"count"}
+	default:
+		columns = strings.Split(what, ", ")
+	}
+
+	res := pgfake.Result{Columns: columns, ColumnOIDs: make([]uint32, len(columns))}
+	for i, column := range columns {
+		oid, ok := fakeColumnOIDs[column]
+		if !ok {
+			return errorResult("42703", fmt.Sprintf("column %q does not exist", column))
+		}
+		res.ColumnOIDs[i] = oid
+	}
+
+	match, paramOIDs, err := fakeWhere(where, args)
+	if err != nil {
+		return errorResult("42601", err.Error())
+	}
+	res.ParamOIDs = paramOIDs
+	if args == nil {
+		return res
+	}
+
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+
+	var found []fakeItem
+	for _, item := range fi.rows {
+		if match(item) {
+			found = append(found, item)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].id < found[j].id
+	})
+	if limit != "" {
+		n, _ := strconv.Atoi(limit)
+		if n < len(found) {
+			found = found[:n]
+		}
+	}
+
+	if what == "count(*)" {
+		res.Rows = [][]any{{int64(len(found))}}
+		return res
+	}
+	for _, item := range found {
+		row := make([]any, len(columns))
+		for i, column := range columns {
+			switch column {
+			case "id":
+				row[i] = item.id
+			case "name":
+				row[i] = item.name
+			case "user_id":
+				row[i] = item.userID
+			case "create_time":
+				row[i] = item.createTime
+			}
+		}
+		res.Rows = append(res.Rows, row)
+	}
+
+	return res
+}
+
+func (fi *fakeItems) update(nameParam, where string, args []any) pgfake.Result {
+	match, paramOIDs, err := fakeWhere(where, args)
+	if err != nil {
+		return errorResult("42601", err.Error())
+	}
+	n, _ := strconv.Atoi(nameParam)
+	for len(paramOIDs) < n {
+		paramOIDs = append(paramOIDs, 0)
+	}
+	paramOIDs[n-1] = 0
+	if args == nil {
+		return pgfake.Result{ParamOIDs: paramOIDs}
+	}
+
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+
+	var affected int64
+	for i := range fi.rows {
+		if match(fi.rows[i]) {
+			fi.rows[i].name = args[n-1]
+			affected++
+		}
+	}
+
+	return pgfake.Result{RowsAffected: affected}
+}
+
+func (fi *fakeItems) delete(where string, args []any) pgfake.Result {
+	match, paramOIDs, err := fakeWhere(where, args)
+	if err != nil {
+		return errorResult("42601", err.Error())
+	}
+	if args == nil {
+		return pgfake.Result{ParamOIDs: paramOIDs}
+	}
+
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+
+	kept := fi.rows[:0]
+	var affected int64
+	for _, item := range fi.rows {
+		if match(item) {
+			affected++
+			continue
+		}
+		kept = append(kept, item)
+	}
+	fi.rows = kept
+
+	return pgfake.Result{RowsAffected: affected}
+}
+
+// fakeWhere parses conditions joined by "and": "column = $n", "column in ($n, ...)" and "true".
+// Returns the matcher of rows and types of params
+func fakeWhere(where string, args []any) (func(fakeItem) bool, []uint32, error) {
+	var (
+		paramOIDs []uint32
+		matchers  []func(fakeItem) bool
+	)
+	setOID := func(param string, column string) int {
+		n, _ := strconv.Atoi(strings.TrimPrefix(strings.TrimSpace(param), "$"))
+		for len(paramOIDs) < n {
+			paramOIDs = append(paramOIDs, 0)
+		}
+		paramOIDs[n-1] = fakeColumnOIDs[column]
+		return n
+	}
+
+	if where != "" && where != "true" {
+		for _, cond := range strings.Split(where, " and ") {
+			if m := fakeEqRe.FindStringSubmatch(cond); m != nil {
+				column, n := m[1], setOID(m[2], m[1])
+				matchers = append(matchers, func(item fakeItem) bool {
+					return fakeEqual(item, column, args[n-1])
+				})
+				continue
+			}
+			if m := fakeInRe.FindStringSubmatch(cond); m != nil {
+				column := m[1]
+				var ns []int
+				for _, param := range strings.Split(m[2], ",") {
+					ns = append(ns, setOID(param, column))
+				}
+				matchers = append(matchers, func(item fakeItem) bool {
+					for _, n := range ns {
+						if fakeEqual(item, column, args[n-1]) {
+							return true
+						}
+					}
+					return false
+				})
+				continue
+			}
+			return nil, nil, fmt.Errorf("fake items: unknown condition: %s", cond)
+		}
+	}
+
+	return func(item fakeItem) bool {
+		for _, match := range matchers {
+			if !match(item) {
+				return false
+			}
+		}
+		return true
+	}, paramOIDs, nil
+}
+
+func fakeEqual(item fakeItem, column string, arg any) bool {
+	switch column {
+	case "id", "user_id":
+		n, err := toInt64(arg)
+		if err != nil {
+			return false
+		}
+		if column == "id" {
+			return item.id == n
+		}
+		return item.userID == n
+	case "name":
+		return item.name != nil && arg != nil && fmt.Sprint(item.name) == fmt.Sprint(arg)
+	}
+	return false
+}
+
+func toInt64(arg any) (int64, error) {
+	switch v := arg.(type) {
+	case int64:
+		return v, nil
+	case string:
+		return strconv.ParseInt(v, 10, 64)
+	}
+	return 0, fmt.Errorf("invalid bigint value %v", arg)
+}
+
+func errorResult(code, message string) pgfake.Result {
+	return pgfake.Result{Err: &pgfake.Error{Code: code, Message: message}}
+}
@@ -37,3 +37,21 @@ func TestPgxV4_Perf_5000x2(t *testing.T) {
 
 	common.Perf(ctx, t, db, 5000, 2)
 }
+
+func BenchmarkPgxV5_Batch_10(b *testing.B) {
+	ctx, db := setup(b, false)
+
+	common.BenchBatch(ctx, b, db, 10)
+}
+
+func BenchmarkPgxV5_Batch_100(b *testing.B) {
+	ctx, db := setup(b, false)
+
+	common.BenchBatch(ctx, b, db, 100)
+}
+
+func BenchmarkPgxV5_Batch_1000(b *testing.B) {
+	ctx, db := setup(b, false)
+
+	common.BenchBatch(ctx, b, db, 1000)
+}
@@ -0,0 +1,144 @@
+package dbbatch
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	sqlStateSerializationFailure = "40001"
+	sqlStateDeadlockDetected     = "40P01"
+)
+
+// RetryPolicy describes retries of RunInBatchTx
+type RetryPolicy struct {
+	// MaxAttempts is the max count of runs, values less than 1 mean one run without retries
+	MaxAttempts int
+	// Backoff returns delay before the next attempt, attempt starts from 1. Nil means no delay
+	Backoff func(attempt int) time.Duration
+	// Retryable reports whether the error of an attempt must be retried. Nil means IsRetryableError
+	Retryable func(err error) bool
+}
+
+// ExponentialBackoff returns backoff doubling the delay from base on every attempt up to max
+func ExponentialBackoff(base, max time.Duration) func(attempt int) time.Duration {
+	return func(attempt int) time.Duration {
+		delay := base
+		for i := 1; i < attempt && delay < max; i++ {
+			delay *= 2
+		}
+		if delay > max {
+			delay = max
+		}
+		return delay
+	}
+}
+
+// TxAttemptsError is returned by RunInBatchTx when all attempts failed
+type TxAttemptsError struct {
+	Attempts int
+	Err      error
+}
+
+func (e *TxAttemptsError) Error() string {
+	return fmt.Sprintf("batch tx failed, attempts %d: %v", e.Attempts, e.Err)
+}
+
+func (e *TxAttemptsError) Unwrap() error {
+	return e.Err
+}
+
+// IsRetryableError reports whether err is a serialization failure or a deadlock.
+// Works with pgconn.PgError of pgx v4 and pgx v5.
+func IsRetryableError(err error) bool {
+	var sqlStateErr interface {
+		SQLState() string
+	}
+	if !errors.As(err, &sqlStateErr) {
+		return false
+	}
+
+	switch sqlStateErr.SQLState() {
+	case sqlStateSerializationFailure, sqlStateDeadlockDetected:
+		return true
+	default:
+		return false
+	}
+}
+
+// RunInBatchTx runs fn in the transaction. The transaction is committed if fn returns nil,
+// otherwise or on panic it's rolled back. Serialization failures and deadlocks are retried
+// with the retryPolicy. The count of attempts is returned in *TxAttemptsError.
+func (bdb *BatchDB) RunInBatchTx(
+	ctx context.Context,
+	opts *sql.TxOptions,
+	fn func(tx *BatchTx) error,
+	retryPolicy RetryPolicy,
+) error {
+	return retry(ctx, retryPolicy, func() error {
+		return bdb.runInBatchTx(ctx, opts, fn)
+	})
+}
+
+func (bdb *BatchDB) runInBatchTx(ctx context.Context, opts *sql.TxOptions, fn func(tx *BatchTx) error) (err error) {
+	tx, err := bdb.BeginBatchTx(ctx, opts)
+	if err != nil {
+		return fmt.Errorf("bdb.BeginBatchTx: %w", err)
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	err = fn(tx)
+	if err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			return errors.Join(err, fmt.Errorf("rollback: %w", rollbackErr))
+		}
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+
+	return nil
+}
+
+func retry(ctx context.Context, policy RetryPolicy, fn func() error) error {
+	retryable := policy.Retryable
+	if retryable == nil {
+		retryable = IsRetryableError
+	}
+
+	attempt := 0
+	for {
+		attempt++
+
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		if attempt >= policy.MaxAttempts || !retryable(err) {
+			return &TxAttemptsError{Attempts: attempt, Err: err}
+		}
+
+		var delay time.Duration
+		if policy.Backoff != nil {
+			delay = policy.Backoff(attempt)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return &TxAttemptsError{Attempts: attempt, Err: errors.Join(err, ctx.Err())}
+		case <-timer.C:
+		}
+	}
+}
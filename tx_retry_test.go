@@ -0,0 +1,130 @@
+package dbbatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	pgconnv4 "github.com/jackc/pgconn"
+	pgconnv5 "github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsRetryableError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "nil", err: nil, want: false},
+		{name: "other", err: errors.New("some error"), want: false},
+		{name: "pgx v4 serialization failure", err: &pgconnv4.PgError{Code: "40001"}, want: true},
+		{name: "pgx v4 deadlock", err: &pgconnv4.PgError{Code: "40P01"}, want: true},
+		{name: "pgx v4 unique violation", err: &pgconnv4.PgError{Code: "23505"}, want: false},
+		{name: "pgx v5 serialization failure", err: &pgconnv5.PgError{Code: "40001"}, want: true},
+		{name: "pgx v5 deadlock", err: &pgconnv5.PgError{Code: "40P01"}, want: true},
+		{
+			name: "wrapped pgx v5 serialization failure",
+			err:  fmt.Errorf("batchResults.Exec: %w", &pgconnv5.PgError{Code: "40001"}),
+			want: true,
+		},
+		{
+			name: "joined pgx v4 deadlock",
+			err:  errors.Join(errors.New("some error"), &pgconnv4.PgError{Code: "40P01"}),
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, IsRetryableError(tt.err))
+		})
+	}
+}
+
+func TestRetry(t *testing.T) {
+	ctx := context.Background()
+	retryableErr := &pgconnv5.PgError{Code: "40001"}
+
+	t.Run("success after retries", func(t *testing.T) {
+		attempts := 0
+		var delays []int
+
+		err := retry(ctx, RetryPolicy{
+			MaxAttempts: 3,
+			Backoff: func(attempt int) time.Duration {
+				delays = append(delays, attempt)
+				return 0
+			},
+		}, func() error {
+			attempts++
+			if attempts < 3 {
+				return retryableErr
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 3, attempts)
+		assert.Equal(t, []int{1, 2}, delays)
+	})
+
+	t.Run("max attempts", func(t *testing.T) {
+		attempts := 0
+
+		err := retry(ctx, RetryPolicy{MaxAttempts: 2}, func() error {
+			attempts++
+			return retryableErr
+		})
+
+		var attemptsErr *TxAttemptsError
+		require.ErrorAs(t, err, &attemptsErr)
+		assert.Equal(t, 2, attemptsErr.Attempts)
+		assert.ErrorIs(t, err, retryableErr)
+		assert.Equal(t, 2, attempts)
+	})
+
+	t.Run("not retryable", func(t *testing.T) {
+		someErr := errors.New("some error")
+		attempts := 0
+
+		err := retry(ctx, RetryPolicy{MaxAttempts: 5}, func() error {
+			attempts++
+			return someErr
+		})
+
+		var attemptsErr *TxAttemptsError
+		require.ErrorAs(t, err, &attemptsErr)
+		assert.Equal(t, 1, attemptsErr.Attempts)
+		assert.ErrorIs(t, err, someErr)
+		assert.EqualError(t, err, "batch tx failed, attempts 1: some error")
+	})
+
+	t.Run("context canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+
+		err := retry(ctx, RetryPolicy{
+			MaxAttempts: 5,
+			Backoff:     ExponentialBackoff(time.Hour, time.Hour),
+		}, func() error {
+			return retryableErr
+		})
+
+		var attemptsErr *TxAttemptsError
+		require.ErrorAs(t, err, &attemptsErr)
+		assert.Equal(t, 1, attemptsErr.Attempts)
+		assert.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	backoff := ExponentialBackoff(10*time.Millisecond, 50*time.Millisecond)
+
+	assert.Equal(t, 10*time.Millisecond, backoff(1))
+	assert.Equal(t, 20*time.Millisecond, backoff(2))
+	assert.Equal(t, 40*time.Millisecond, backoff(3))
+	assert.Equal(t, 50*time.Millisecond, backoff(4))
+	assert.Equal(t, 50*time.Millisecond, backoff(10))
+}
@@ -36,3 +36,17 @@ func (withoutCancelCtx) Err() error {
 func (c withoutCancelCtx) Value(key any) any {
 	return c.c.Value(key)
 }
+
+// contextWithLifetime returns a context with values of parent, deadline and cancellation of lifetime.
+func contextWithLifetime(parent, lifetime context.Context) context.Context {
+	return lifetimeCtx{Context: lifetime, values: parent}
+}
+
+type lifetimeCtx struct {
+	context.Context
+	values context.Context
+}
+
+func (c lifetimeCtx) Value(key any) any {
+	return c.values.Value(key)
+}